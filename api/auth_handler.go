@@ -35,8 +35,8 @@ type AuthResponse struct {
 
 func (h *AuthHandler) HandleAuthenticate(c *fiber.Ctx) error {
 	var params AuthParams
-	if err := c.BodyParser(&params); err != nil {
-		return myErrors.ErrBadRequest()
+	if err := parseBody(c, &params); err != nil {
+		return err
 	}
 
 	user, err := h.userStore.GetUserByEmail(c.Context(), params.Email)
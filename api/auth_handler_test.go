@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
 	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/ratelimit"
+	"github.com/rtsoy/hotel-reservation/types"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -96,3 +100,44 @@ func TestAuthenticateWithWrongPasswordFailure(t *testing.T) {
 		t.Fatal("the error does not match an expected error")
 	}
 }
+
+func TestAuthenticateRateLimited(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+	// Requests are rejected before reaching the handler, so it doesn't need a database
+	app.Post("/auth", middleware.RateLimit(ratelimit.NewMemoryStore(), "auth", ratelimit.PerMinute(3)),
+		func(c *fiber.Ctx) error {
+			return c.SendStatus(http.StatusOK)
+		})
+
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/auth", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected http status code %d but got %d", http.StatusOK, resp.StatusCode)
+		}
+		if remaining := resp.Header.Get(middleware.RateLimitRemainingHeader); remaining != strconv.Itoa(2-i) {
+			t.Fatalf("expected %d remaining requests but got %s", 2-i, remaining)
+		}
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/auth", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected http status code %d but got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+	if resp.Header.Get(fiber.HeaderRetryAfter) != "20" {
+		t.Fatalf("expected to retry after 20 seconds but got %s", resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+
+	var apiError errors.Error
+	if err := json.NewDecoder(resp.Body).Decode(&apiError); err != nil {
+		t.Fatal(err)
+	}
+	if apiError.ErrorCode != types.CodeTooManyRequests {
+		t.Fatalf("expected error code %s but got %s", types.CodeTooManyRequests, apiError.ErrorCode)
+	}
+}
@@ -1,22 +1,34 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/currency"
 	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/http"
+	"time"
 )
 
 type BookingHandler struct {
-	store *db.Store
+	store    *db.Store
+	rates    currency.RateProvider
+	payments payment.PaymentProvider
 }
 
-func NewBookingHandler(store *db.Store) *BookingHandler {
+func NewBookingHandler(store *db.Store, rates currency.RateProvider, payments payment.PaymentProvider) *BookingHandler {
 	return &BookingHandler{
-		store: store,
+		store:    store,
+		rates:    rates,
+		payments: payments,
 	}
 }
 
@@ -46,16 +58,363 @@ func (h *BookingHandler) HandleCancelBooking(c *fiber.Ctx) error {
 		return myErrors.ErrForbidden()
 	}
 
+	if booking.Canceled {
+		return c.JSON(map[string]string{
+			"updated": id,
+		})
+	}
+	if booking.CheckedOut {
+		return myErrors.ErrBookingNotCancelable("A checked out booking can't be canceled")
+	}
+	if !time.Now().Before(booking.FromDate) {
+		return myErrors.ErrBookingNotCancelable("A booking can't be canceled once the stay started")
+	}
+
+	// The cancel is claimed first, so of concurrent cancels only one refunds and gives back
+	// the promo code and the loyalty points, the others find the booking canceled already
+	filter := bson.M{"_id": booking.ID, "canceled": false, "checkedOut": false}
+	claim := bson.M{
+		"$set": bson.M{"canceled": true},
+	}
+	if err := h.store.Booking.UpdateBooking(c.Context(), filter, claim); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.JSON(map[string]string{
+				"updated": id,
+			})
+		}
+
+		return err
+	}
+
+	if err := h.cancelFolio(c.Context(), booking); err != nil {
+		// Gives the claim back, so the cancel can be retried
+		unclaim := bson.M{
+			"$set": bson.M{"canceled": false},
+		}
+		if err := h.store.Booking.UpdateBooking(c.Context(), bson.M{"_id": booking.ID, "canceled": true}, unclaim); err != nil {
+			log.Printf("failed to give back the cancel of booking %s: %v", booking.ID.Hex(), err)
+		}
+
+		return err
+	}
+
+	if booking.Payment != nil {
+		update := bson.M{
+			"$set": bson.M{"payment": booking.Payment},
+		}
+		if err := h.store.Booking.UpdateBooking(c.Context(), bson.M{"_id": booking.ID}, update); err != nil {
+			return err
+		}
+	}
+
+	if !booking.PromoCodeID.IsZero() {
+		if err := h.store.PromoCode.ReleasePromoCode(c.Context(), booking.PromoCodeID, booking.UserID); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+	if booking.LoyaltyPoints > 0 {
+		if err := reverseLoyaltyPoints(c.Context(), h.store, booking, "Booking canceled"); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(map[string]string{
+		"updated": id,
+	})
+}
+
+// cancelFolio settles the payment of a canceled booking and posts it to the folio:
+// only the cancellation penalty stays charged, and an invoice issued before is credited.
+func (h *BookingHandler) cancelFolio(ctx context.Context, booking *types.Booking) error {
+	// The folio is opened before the payment changes, so that it is not posted twice
+	folio, err := getOrCreateFolio(ctx, h.store, booking)
+	if err != nil {
+		return err
+	}
+
+	var penalty int64
+	if booking.Price != nil {
+		hotel, err := h.store.Hotel.GetHotelByID(ctx, booking.HotelID)
+		if err != nil {
+			return err
+		}
+
+		penalty = hotel.PaymentPolicy.CancellationPenalty(booking.Price.Total, booking.FromDate, time.Now())
+	}
+
+	lines := []types.FolioLine{}
+	if charges := folio.ChargesTotal(); charges != penalty {
+		lines = append(lines, types.FolioLine{
+			Type:        types.FolioCancellation,
+			Description: "Cancellation",
+			Amount:      penalty - charges,
+			Date:        time.Now().UTC(),
+		})
+	}
+
+	if booking.Payment != nil {
+		captured, refunded := booking.Payment.Captured, booking.Payment.Refunded
+
+		if err := h.refundCancellation(ctx, booking, penalty); err != nil {
+			return err
+		}
+
+		if amount := booking.Payment.Captured - captured; amount > 0 {
+			lines = append(lines, types.NewPaymentFolioLine(amount))
+		}
+		if amount := booking.Payment.Refunded - refunded; amount > 0 {
+			lines = append(lines, types.NewPaymentFolioLine(-amount))
+		}
+	}
+
+	if len(lines) > 0 {
+		if err := h.store.Folio.AddFolioLines(ctx, folio.ID, lines...); err != nil {
+			return err
+		}
+	}
+
+	return creditActiveInvoice(ctx, h.store, booking.ID)
+}
+
+// refundCancellation keeps the cancellation penalty and refunds the rest of the captured amount
+func (h *BookingHandler) refundCancellation(ctx context.Context, booking *types.Booking, penalty int64) error {
+	bookingPayment := booking.Payment
+
+	if penalty > bookingPayment.Authorized {
+		penalty = bookingPayment.Authorized
+	}
+
+	if penalty > bookingPayment.Captured {
+		if err := h.payments.Capture(ctx, bookingPayment.PaymentID, penalty-bookingPayment.Captured); err != nil {
+			return err
+		}
+
+		bookingPayment.Captured = penalty
+	}
+
+	if refund := bookingPayment.Captured - bookingPayment.Refunded - penalty; refund > 0 {
+		if err := h.payments.Refund(ctx, bookingPayment.PaymentID, refund); err != nil {
+			return err
+		}
+
+		bookingPayment.Refunded += refund
+	}
+
+	// Nothing more is captured from a canceled booking, so the hold on the rest is released
+	if remainder := bookingPayment.Authorized - bookingPayment.Captured - bookingPayment.Voided; remainder > 0 {
+		if err := h.payments.Void(ctx, bookingPayment.PaymentID); err != nil {
+			return err
+		}
+
+		bookingPayment.Voided += remainder
+	}
+
+	return nil
+}
+
+func (h *BookingHandler) HandleAssignRoom(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	var params types.AssignRoomParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	booking, err := h.store.Booking.GetBookingByID(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	if booking.Canceled {
+		return myErrors.NewError(http.StatusBadRequest, "Cannot assign a room to a canceled booking")
+	}
+
+	room, err := h.store.Room.GetRoomByID(c.Context(), params.RoomID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	// Bookings made before room types refer to their hotel through their room
+	hotelID, err := bookingHotelID(c.Context(), h.store, booking)
+	if err != nil {
+		return err
+	}
+
+	if room.HotelID != hotelID || room.RoomTypeID != booking.RoomTypeID {
+		return myErrors.NewError(http.StatusBadRequest, "Room does not match the booked room type")
+	}
+
+	if room.ID == booking.RoomID {
+		return c.JSON(booking)
+	}
+
+	// Room type bookings are only checked against the restrictions of the hotel, the room ones apply now
+	if err := checkRoomRestrictions(c.Context(), h.store.Restriction, room, booking); err != nil {
+		return err
+	}
+
+	bookRoomParams := types.BookRoomParams{
+		FromDate:   booking.FromDate,
+		TillDate:   booking.TillDate,
+		NumPersons: booking.NumPersons,
+	}
+
+	available, err := IsRoomAvailableForBooking(c.Context(), h.store, room.ID, bookRoomParams)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return myErrors.NewError(http.StatusBadRequest, fmt.Sprintf("Room %s is already booked", room.ID.Hex()))
+	}
+
 	filter := bson.M{"_id": booking.ID}
 	update := bson.M{
 		"$set": bson.M{
-			"canceled": true,
+			"roomID": room.ID,
+		},
+	}
+	if err := h.store.Booking.UpdateBooking(c.Context(), filter, update); err != nil {
+		return err
+	}
+
+	// The room may have been given to another booking since the check, the assignment that sees
+	// the other one backs off, so two concurrent assignments never both keep the room
+	overlapping, err := h.overlappingBookings(c.Context(), room.ID, booking)
+	if err != nil {
+		return err
+	}
+	if overlapping {
+		filter := bson.M{"_id": booking.ID, "roomID": room.ID}
+		update := bson.M{"$set": bson.M{"roomID": booking.RoomID}}
+		if booking.RoomID.IsZero() {
+			update = bson.M{"$unset": bson.M{"roomID": ""}}
+		}
+		// The booking was reassigned in the meantime otherwise, that assignment stands
+		if err := h.store.Booking.UpdateBooking(c.Context(), filter, update); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+
+		return myErrors.NewError(http.StatusConflict, fmt.Sprintf("Room %s was booked in the meantime", room.ID.Hex()))
+	}
+
+	booking.RoomID = room.ID
+
+	return c.JSON(booking)
+}
+
+// overlappingBookings reports whether an active booking other than the given one has the room during its stay
+func (h *BookingHandler) overlappingBookings(ctx context.Context, roomID primitive.ObjectID, booking *types.Booking) (bool, error) {
+	canceled := false
+
+	bookingQueryParams := db.BookingQueryParams{
+		Pagination: db.Pagination{
+			Limit: 2,
+		},
+		RoomID:   roomID,
+		FromDate: booking.FromDate,
+		TillDate: booking.TillDate,
+		Canceled: &canceled,
+	}
+
+	bookings, err := h.store.Booking.GetBookings(ctx, &bookingQueryParams, &bookingQueryParams.Pagination)
+	if err != nil {
+		return false, err
+	}
+
+	for _, other := range bookings {
+		if other.ID != booking.ID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// HandleCheckOutBooking checks the guest out and marks the room as dirty
+func (h *BookingHandler) HandleCheckOutBooking(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	booking, err := h.store.Booking.GetBookingByID(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	hotelID, err := bookingHotelID(c.Context(), h.store, booking)
+	if err != nil {
+		return err
+	}
+	if err := checkStaffHotel(c, hotelID); err != nil {
+		return err
+	}
+
+	if booking.Canceled {
+		return myErrors.NewError(http.StatusBadRequest, "Cannot check out a canceled booking")
+	}
+	if booking.CheckedOut {
+		return myErrors.NewError(http.StatusBadRequest, "Booking is already checked out")
+	}
+	if booking.RoomID.IsZero() {
+		return myErrors.NewError(http.StatusBadRequest, "No room is assigned to the booking")
+	}
+
+	// Of concurrent checkouts (or a cancel) only the one updating the booking goes on,
+	// so the room is marked dirty and the points are earned once
+	filter := bson.M{"_id": booking.ID, "checkedOut": false, "canceled": false, "roomID": booking.RoomID}
+	update := bson.M{
+		"$set": bson.M{
+			"checkedOut":     true,
+			"loyaltyPending": true,
 		},
 	}
 	if err := h.store.Booking.UpdateBooking(c.Context(), filter, update); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.NewError(http.StatusConflict, "Booking was checked out, canceled or reassigned in the meantime")
+		}
+
+		return err
+	}
+
+	filter = bson.M{"_id": booking.RoomID}
+	update = bson.M{
+		"$set": bson.M{
+			"housekeepingStatus": types.HousekeepingDirty,
+		},
+	}
+	if err := h.store.Room.UpdateRoom(c.Context(), filter, update); err != nil {
 		return err
 	}
 
+	// The guest is checked out anyway, RetryLoyaltyEarnings grants the points later
+	if err := earnLoyaltyPoints(c.Context(), h.store, h.rates, booking); err != nil {
+		log.Println("failed to earn loyalty points:", err)
+	}
+
 	return c.JSON(map[string]string{
 		"updated": id,
 	})
@@ -63,24 +422,30 @@ func (h *BookingHandler) HandleCancelBooking(c *fiber.Ctx) error {
 
 func (h *BookingHandler) HandleGetBookings(c *fiber.Ctx) error {
 	var bookingQueryParams db.BookingQueryParams
-	if err := c.QueryParser(&bookingQueryParams); err != nil {
-		return myErrors.ErrBadRequest()
+	if err := parseQuery(c, &bookingQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&bookingQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	shape, err := parseShape(c, types.Booking{}, bookingExpandable...)
+	if err != nil {
+		return err
 	}
 
 	bookings, err := h.store.Booking.GetBookings(c.Context(), &bookingQueryParams, &bookingQueryParams.Pagination)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return myErrors.ErrResourceNotFound()
-		}
+		return listError(err)
+	}
 
+	shaped, err := h.shapeBookings(c.Context(), shape, bookings)
+	if err != nil {
 		return err
 	}
 
-	response := &resourceResponse{
-		Results: len(bookings),
-		Page:    bookingQueryParams.Page,
-		Data:    bookings,
-	}
+	response := newPageResponse(c, shaped, len(bookings), &bookingQueryParams.Pagination)
 
 	return c.JSON(response)
 }
@@ -110,5 +475,115 @@ func (h *BookingHandler) HandleGetBooking(c *fiber.Ctx) error {
 		return myErrors.ErrForbidden()
 	}
 
-	return c.JSON(booking)
+	shape, err := parseShape(c, types.Booking{}, bookingExpandable...)
+	if err != nil {
+		return err
+	}
+
+	shaped, err := h.shapeBookings(c.Context(), shape, []*types.Booking{booking})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(shaped[0])
+}
+
+// bookingExpandable are the relations ?expand= can embed in bookings
+var bookingExpandable = []string{"room", "user", "hotel"}
+
+// shapeBookings shapes the bookings for the response, each kind of relation is read
+// at once for every booking. Relations that aren't set, like the room of a room type
+// booking that wasn't assigned one yet, are embedded as null.
+func (h *BookingHandler) shapeBookings(ctx context.Context, shape *responseShape, bookings []*types.Booking) ([]any, error) {
+	var (
+		rooms  = map[primitive.ObjectID]*types.Room{}
+		users  = map[primitive.ObjectID]*types.User{}
+		hotels = map[primitive.ObjectID]*types.Hotel{}
+	)
+
+	// Bookings made before they had a hotelID get their hotel through their room
+	needRooms := shape.expand["room"]
+	for _, booking := range bookings {
+		if shape.expand["hotel"] && booking.HotelID.IsZero() {
+			needRooms = true
+		}
+	}
+
+	if needRooms {
+		ids := make([]primitive.ObjectID, 0, len(bookings))
+		for _, booking := range bookings {
+			ids = append(ids, booking.RoomID)
+		}
+
+		found, err := h.store.Room.GetRoomsByIDs(ctx, uniqueIDs(ids))
+		if err != nil {
+			return nil, err
+		}
+		for _, room := range found {
+			rooms[room.ID] = room
+		}
+	}
+
+	if shape.expand["user"] {
+		ids := make([]primitive.ObjectID, 0, len(bookings))
+		for _, booking := range bookings {
+			ids = append(ids, booking.UserID)
+		}
+
+		found, err := h.store.User.GetUsersByIDs(ctx, uniqueIDs(ids))
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range found {
+			users[user.ID] = user
+		}
+	}
+
+	hotelID := func(booking *types.Booking) primitive.ObjectID {
+		if !booking.HotelID.IsZero() {
+			return booking.HotelID
+		}
+		if room, ok := rooms[booking.RoomID]; ok {
+			return room.HotelID
+		}
+
+		return primitive.NilObjectID
+	}
+
+	if shape.expand["hotel"] {
+		ids := make([]primitive.ObjectID, 0, len(bookings))
+		for _, booking := range bookings {
+			ids = append(ids, hotelID(booking))
+		}
+
+		found, err := h.store.Hotel.GetHotelsByIDs(ctx, uniqueIDs(ids))
+		if err != nil {
+			return nil, err
+		}
+		for _, hotel := range found {
+			hotels[hotel.ID] = hotel
+		}
+	}
+
+	shaped := make([]any, 0, len(bookings))
+	for _, booking := range bookings {
+		embedded := map[string]any{}
+		if shape.expand["room"] {
+			embedded["room"] = rooms[booking.RoomID]
+		}
+		if shape.expand["user"] {
+			embedded["user"] = users[booking.UserID]
+		}
+		if shape.expand["hotel"] {
+			embedded["hotel"] = hotels[hotelID(booking)]
+		}
+
+		resource, err := shape.apply(booking, embedded)
+		if err != nil {
+			return nil, err
+		}
+		shaped = append(shaped, resource)
+	}
+
+	return shaped, nil
 }
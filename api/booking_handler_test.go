@@ -1,12 +1,20 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rtsoy/hotel-reservation/api/errors"
 	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db"
 	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/payment"
 	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -25,14 +33,14 @@ func TestUserCancelNotOwnBooking(t *testing.T) {
 			"user@example.org", "user", false)
 
 		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room    = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 		booking = fixtures.AddBooking(tdb.store, creator.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
 
 		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
 		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	route.Get("/:id", bookingHandler.HandleCancelBooking)
@@ -74,14 +82,14 @@ func TestAdminCancelNotOwnBooking(t *testing.T) {
 			"admin@example.org", "admin", true)
 
 		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room    = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
 
 		app   = fiber.New()
 		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	route.Get("/:id", bookingHandler.HandleCancelBooking)
@@ -123,14 +131,14 @@ func TestUserCancelOwnBooking(t *testing.T) {
 			"user@example.org", "user", false)
 
 		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room    = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
 
 		app   = fiber.New()
 		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	route.Get("/:id", bookingHandler.HandleCancelBooking)
@@ -174,14 +182,14 @@ func TestUserGetNotOwnBooking(t *testing.T) {
 			"user@example.org", "user", false)
 
 		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room    = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 		booking = fixtures.AddBooking(tdb.store, creator.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
 
 		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
 		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	route.Get("/:id", bookingHandler.HandleGetBooking)
@@ -223,14 +231,14 @@ func TestAdminGetNotOwnBooking(t *testing.T) {
 			"admin@example.org", "admin", true)
 
 		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room    = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
 
 		app   = fiber.New()
 		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	route.Get("/:id", bookingHandler.HandleGetBooking)
@@ -268,14 +276,14 @@ func TestUserGetOwnBooking(t *testing.T) {
 			"user@example.org", "user", false)
 
 		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room    = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
 
 		app   = fiber.New()
 		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	route.Get("/:id", bookingHandler.HandleGetBooking)
@@ -313,7 +321,7 @@ func TestNoTokenGetBookings(t *testing.T) {
 			"user@example.org", "user", false)
 
 		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room  = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 
 		_ = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
@@ -323,7 +331,7 @@ func TestNoTokenGetBookings(t *testing.T) {
 		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
 		admin = app.Group("/", middleware.JWTAuthentication(tdb.store.User), middleware.AdminAuth)
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	admin.Get("/", bookingHandler.HandleGetBookings)
@@ -362,7 +370,7 @@ func TestNonAdminGetBookings(t *testing.T) {
 			"user@example.org", "user", false)
 
 		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room  = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 
 		_ = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
@@ -372,7 +380,7 @@ func TestNonAdminGetBookings(t *testing.T) {
 		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
 		admin = app.Group("/", middleware.JWTAuthentication(tdb.store.User), middleware.AdminAuth)
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	admin.Get("/", bookingHandler.HandleGetBookings)
@@ -413,7 +421,7 @@ func TestAdminGetBookings(t *testing.T) {
 			"user@example.org", "user", false)
 
 		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
-		room  = fixtures.AddRoom(tdb.store, "medium", true, 199.9, hotel.ID)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
 
 		_ = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
 			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
@@ -423,7 +431,7 @@ func TestAdminGetBookings(t *testing.T) {
 		app   = fiber.New()
 		admin = app.Group("/", middleware.JWTAuthentication(tdb.store.User), middleware.AdminAuth)
 
-		bookingHandler = NewBookingHandler(tdb.store)
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
 	)
 
 	admin.Get("/", bookingHandler.HandleGetBookings)
@@ -450,3 +458,582 @@ func TestAdminGetBookings(t *testing.T) {
 		t.Fatalf("expected results 2 but got %d", response.Results)
 	}
 }
+
+func TestStaffCheckOutBooking(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+		staffUser = fixtures.AddUser(tdb.store, "staff", "staff",
+			"staff@example.org", "staff", false)
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
+		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
+			time.Now().AddDate(0, 0, -3).UTC(), time.Now().UTC(), false)
+
+		otherHotel   = fixtures.AddHotel(tdb.store, "otherHotel", "Testestan", nil, 4)
+		otherRoom    = fixtures.AddRoom(tdb.store, "medium", true, 19990, otherHotel.ID)
+		otherBooking = fixtures.AddBooking(tdb.store, user.ID, otherRoom.ID, 3,
+			time.Now().AddDate(0, 0, -3).UTC(), time.Now().UTC(), false)
+
+		app         = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		apiv1       = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+		adminRoutes = apiv1.Group("/admin", middleware.AdminAuth)
+		staffRoutes = apiv1.Group("/staff", middleware.StaffAuth)
+		userHandler = NewUserHandler(tdb.store.User)
+
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	adminRoutes.Put("/user/:id/staff", userHandler.HandlePutUserStaff)
+	staffRoutes.Post("/booking/:id/checkout", bookingHandler.HandleCheckOutBooking)
+
+	checkOut := func(booking *types.Booking) int {
+		req := httptest.NewRequest(http.MethodPost, "/staff/booking/"+booking.ID.Hex()+"/checkout", nil)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Api-Token", createTokenFromUser(staffUser))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.StatusCode
+	}
+
+	if status := checkOut(booking); status != http.StatusForbidden {
+		t.Fatalf("expected status code 403 before the user is staff but got %d", status)
+	}
+
+	b, _ := json.Marshal(types.UpdateStaffParams{IsStaff: true, HotelIDs: []primitive.ObjectID{hotel.ID}})
+	req := httptest.NewRequest(http.MethodPut, "/admin/user/"+staffUser.ID.Hex()+"/staff", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("If-Match", versionETag(staffUser.Version))
+	req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code 200 granting staff access but got %d", resp.StatusCode)
+	}
+
+	if status := checkOut(otherBooking); status != http.StatusForbidden {
+		t.Fatalf("expected status code 403 for a booking of another hotel but got %d", status)
+	}
+	if status := checkOut(booking); status != http.StatusOK {
+		t.Fatalf("expected status code 200 but got %d", status)
+	}
+
+	updatedRoom, err := tdb.store.Room.GetRoomByID(context.Background(), room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updatedRoom.HousekeepingStatus != types.HousekeepingDirty {
+		t.Fatalf("expected housekeeping status %s but got %s", types.HousekeepingDirty, updatedRoom.HousekeepingStatus)
+	}
+}
+
+func TestCheckOutBookingEarnsLoyaltyPoints(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 2,
+			time.Now().AddDate(0, 0, -2).UTC(), time.Now().UTC(), false)
+
+		// No rate for EUR, so the points can't be earned at the checkout
+		rates = currency.NewStaticRateProvider(types.DefaultCurrency, nil)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User), middleware.StaffAuth)
+
+		bookingHandler = NewBookingHandler(tdb.store, rates, payment.NewFakeProvider(""))
+	)
+
+	price := &types.PriceBreakdown{Currency: "EUR", Nights: 2, NightPrice: 10000, RoomTotal: 20000, Total: 20000}
+	if err := tdb.store.Booking.UpdateBooking(context.Background(), bson.M{"_id": booking.ID}, bson.M{"$set": bson.M{"price": price}}); err != nil {
+		t.Fatal(err)
+	}
+
+	route.Post("/booking/:id/checkout", bookingHandler.HandleCheckOutBooking)
+
+	req := httptest.NewRequest(http.MethodPost, "/booking/"+booking.ID.Hex()+"/checkout", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code 200 but got %d", resp.StatusCode)
+	}
+
+	checkedOut, err := tdb.store.Booking.GetBookingByID(context.Background(), booking.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkedOut.CheckedOut || !checkedOut.LoyaltyPending {
+		t.Fatalf("expected a checked out booking with pending points but got checkedOut %t loyaltyPending %t", checkedOut.CheckedOut, checkedOut.LoyaltyPending)
+	}
+
+	// 1 USD = 0.5 EUR, so the stay is worth 400 USD and 400 points
+	rates = currency.NewStaticRateProvider(types.DefaultCurrency, map[string]*big.Rat{"EUR": big.NewRat(1, 2)})
+
+	// Retrying again changes nothing, the points are earned once
+	for i := 0; i < 2; i++ {
+		if err := RetryLoyaltyEarnings(context.Background(), tdb.store, rates); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	earned, err := tdb.store.User.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if earned.LoyaltyPoints != 400 || earned.LifetimePoints != 400 {
+		t.Fatalf("expected 400 loyalty and lifetime points but got %d and %d", earned.LoyaltyPoints, earned.LifetimePoints)
+	}
+
+	transactions, err := tdb.store.Loyalty.GetTransactions(context.Background(), &db.LoyaltyQueryParams{UserID: user.ID}, &db.Pagination{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 1 || transactions[0].Type != types.LoyaltyEarn || transactions[0].BookingID != booking.ID {
+		t.Fatalf("expected a single earn transaction for the booking but got %d transactions", len(transactions))
+	}
+
+	settled, err := tdb.store.Booking.GetBookingByID(context.Background(), booking.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled.LoyaltyPending {
+		t.Fatal("expected the points of the booking to be earned")
+	}
+}
+
+func TestGetBookingExpanded(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
+		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 3,
+			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 8).UTC(), false)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	route.Get("/:id", bookingHandler.HandleGetBooking)
+
+	req := httptest.NewRequest(http.MethodGet, "/"+booking.ID.Hex()+"?expand=room,user,hotel&fields=fromDate,room,user,hotel", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code 200 but got %d", resp.StatusCode)
+	}
+
+	var response struct {
+		ID     string       `json:"id"`
+		UserID string       `json:"userID"`
+		Room   *types.Room  `json:"room"`
+		User   *types.User  `json:"user"`
+		Hotel  *types.Hotel `json:"hotel"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.ID != booking.ID.Hex() {
+		t.Fatalf("expected booking %s but got %s", booking.ID.Hex(), response.ID)
+	}
+	if len(response.UserID) > 0 {
+		t.Fatal("expected userID to be left out of the fields")
+	}
+	if response.Room == nil || response.Room.ID != room.ID {
+		t.Fatalf("expected room %s to be embedded", room.ID.Hex())
+	}
+	if response.User == nil || response.User.ID != user.ID {
+		t.Fatalf("expected user %s to be embedded", user.ID.Hex())
+	}
+	// The booking has no hotelID, its hotel is found through the room
+	if response.Hotel == nil || response.Hotel.ID != hotel.ID {
+		t.Fatalf("expected hotel %s to be embedded", hotel.ID.Hex())
+	}
+
+	// promoCode can't be expanded, and room is only a field when it's expanded
+	for _, query := range []string{"?expand=promoCode", "?fields=fromDate,room"} {
+		req = httptest.NewRequest(http.MethodGet, "/"+booking.ID.Hex()+query, nil)
+		req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+		resp, err = app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected status code 400 for %s but got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestCancelBookingRefundsAndVoids(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+
+		payments = payment.NewFakeProvider("")
+		rates    = currency.NewStaticRateProvider(types.DefaultCurrency, nil)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler    = NewRoomHandler(tdb.store, rates, payments)
+		bookingHandler = NewBookingHandler(tdb.store, rates, payments)
+	)
+
+	// Half is captured as a deposit, a tenth of the total is kept on a late cancellation
+	policy := bson.M{"$set": bson.M{"paymentPolicy": types.PaymentPolicy{
+		DepositRate:             5000,
+		FreeCancellationDays:    30,
+		CancellationPenaltyRate: 1000,
+	}}}
+	if err := tdb.store.Hotel.UpdateHotel(context.Background(), bson.M{"_id": hotel.ID}, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	route.Post("/room/:id/book", roomHandler.HandleBookRoom)
+	route.Post("/booking/:id/cancel", bookingHandler.HandleCancelBooking)
+
+	params := types.BookRoomParams{
+		FromDate:     time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:     time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons:   2,
+		PaymentToken: payment.FakeTokenApproved,
+	}
+	b, _ := json.Marshal(params)
+
+	req := httptest.NewRequest(http.MethodPost, "/room/"+room.ID.Hex()+"/book", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected http status code 201 but got %d", resp.StatusCode)
+	}
+
+	var booking types.Booking
+	if err := json.NewDecoder(resp.Body).Decode(&booking); err != nil {
+		t.Fatal(err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/booking/"+booking.ID.Hex()+"/cancel", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	// 20000 authorized, 10000 captured as a deposit, 2000 kept as the penalty
+	captured, refunded := payments.Captured(booking.Payment.PaymentID)
+	if captured != 10000 || refunded != 8000 {
+		t.Fatalf("expected 10000 captured and 8000 refunded but got %d and %d", captured, refunded)
+	}
+	if !payments.Voided(booking.Payment.PaymentID) {
+		t.Fatal("expected the rest of the authorization to be voided")
+	}
+
+	canceled, err := tdb.store.Booking.GetBookingByID(context.Background(), booking.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if canceled.Payment.Voided != 10000 {
+		t.Fatalf("expected 10000 voided but got %d", canceled.Payment.Voided)
+	}
+}
+
+func TestAssignRoomWithRoomRestriction(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel          = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		restrictedRoom = fixtures.AddRoom(tdb.store, "large", true, 39990, hotel.ID)
+		otherRoom      = fixtures.AddRoom(tdb.store, "large", true, 39990, hotel.ID)
+		roomType       = fixtures.AddRoomType(tdb.store, hotel.ID, "Deluxe Sea View", 2, 39990, []*types.Room{restrictedRoom, otherRoom})
+
+		fromDate = time.Now().AddDate(0, 0, 5).UTC()
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	fixtures.AddRestriction(tdb.store, hotel.ID, types.CreateRestrictionParams{
+		RoomID:   restrictedRoom.ID,
+		FromDate: fromDate.AddDate(0, 0, -1),
+		TillDate: fromDate.AddDate(0, 0, 1),
+		MinLOS:   3,
+	})
+
+	booking, err := tdb.store.Booking.InsertBooking(context.Background(), &types.Booking{
+		UserID:     user.ID,
+		HotelID:    hotel.ID,
+		RoomTypeID: roomType.ID,
+		NumPersons: 2,
+		FromDate:   fromDate,
+		TillDate:   fromDate.AddDate(0, 0, 2),
+		Status:     types.BookingConfirmed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route.Post("/booking/:id/assign", middleware.AdminAuth, bookingHandler.HandleAssignRoom)
+
+	tests := []struct {
+		room           *types.Room
+		expectedStatus int
+	}{
+		{restrictedRoom, http.StatusBadRequest},
+		{otherRoom, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		b, _ := json.Marshal(types.AssignRoomParams{RoomID: tt.room.ID})
+
+		req := httptest.NewRequest(http.MethodPost, "/booking/"+booking.ID.Hex()+"/assign", bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != tt.expectedStatus {
+			t.Fatalf("expected http status code %d for room %s but got %d", tt.expectedStatus, tt.room.ID.Hex(), resp.StatusCode)
+		}
+	}
+}
+
+func TestCancelStartedOrCheckedOutBooking(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+
+		startedBooking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 2,
+			time.Now().AddDate(0, 0, -1).UTC(), time.Now().AddDate(0, 0, 2).UTC(), false)
+		checkedOutBooking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 2,
+			time.Now().AddDate(0, 0, -5).UTC(), time.Now().AddDate(0, 0, -2).UTC(), false)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	checkOut := bson.M{"$set": bson.M{"checkedOut": true}}
+	if err := tdb.store.Booking.UpdateBooking(context.Background(), bson.M{"_id": checkedOutBooking.ID}, checkOut); err != nil {
+		t.Fatal(err)
+	}
+
+	route.Post("/booking/:id/cancel", bookingHandler.HandleCancelBooking)
+
+	for _, booking := range []*types.Booking{startedBooking, checkedOutBooking} {
+		req := httptest.NewRequest(http.MethodPost, "/booking/"+booking.ID.Hex()+"/cancel", nil)
+		req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("expected http status code 409 but got %d", resp.StatusCode)
+		}
+
+		var apiError errors.Error
+		if err := json.NewDecoder(resp.Body).Decode(&apiError); err != nil {
+			t.Fatal(err)
+		}
+
+		if apiError.ErrorCode != types.CodeBookingNotCancelable {
+			t.Fatalf("expected error code %s but got %s", types.CodeBookingNotCancelable, apiError.ErrorCode)
+		}
+
+		stored, err := tdb.store.Booking.GetBookingByID(context.Background(), booking.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.Canceled {
+			t.Fatalf("expected booking %s not to be canceled", booking.ID.Hex())
+		}
+	}
+}
+
+func TestGetBookingsSortedBySparseField(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		adminUser = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
+
+		app   = fiber.New()
+		admin = app.Group("/", middleware.JWTAuthentication(tdb.store.User), middleware.AdminAuth)
+
+		bookingHandler = NewBookingHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	// Bookings made before prices were stored have no price to sort by
+	var unpriced, priced []string
+	for i := 0; i < 5; i++ {
+		booking := fixtures.AddBooking(tdb.store, adminUser.ID, room.ID, 2,
+			time.Now().AddDate(0, 0, i*10+1).UTC(), time.Now().AddDate(0, 0, i*10+3).UTC(), false)
+		if i < 3 {
+			unpriced = append(unpriced, booking.ID.Hex())
+			continue
+		}
+
+		update := bson.M{"$set": bson.M{"price": types.PriceBreakdown{Total: int64(i * 10000)}}}
+		if err := tdb.store.Booking.UpdateBooking(context.Background(), bson.M{"_id": booking.ID}, update); err != nil {
+			t.Fatal(err)
+		}
+		priced = append(priced, booking.ID.Hex())
+	}
+
+	admin.Get("/", bookingHandler.HandleGetBookings)
+
+	getPage := func(target string) *resourceResponse {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Add("X-Api-Token", createTokenFromUser(adminUser))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code 200 but got %d", resp.StatusCode)
+		}
+
+		var response resourceResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		return &response
+	}
+	pageIDs := func(response *resourceResponse) []string {
+		var ids []string
+		for _, booking := range response.Data.([]any) {
+			ids = append(ids, booking.(map[string]any)["id"].(string))
+		}
+		return ids
+	}
+
+	tests := []struct {
+		sort     string
+		expected []string
+	}{
+		// Missing prices are sorted first, then _id breaks the ties
+		{"total", append(append([]string{}, unpriced...), priced...)},
+		{"-total", []string{priced[1], priced[0], unpriced[0], unpriced[1], unpriced[2]}},
+	}
+
+	for _, tt := range tests {
+		response := getPage("/?limit=2&sort=" + tt.sort)
+
+		var pages [][]string
+		for {
+			pages = append(pages, pageIDs(response))
+			if !response.HasMore {
+				break
+			}
+			response = getPage(response.Next)
+		}
+
+		var ids []string
+		for _, page := range pages {
+			ids = append(ids, page...)
+		}
+		if !reflect.DeepEqual(ids, tt.expected) {
+			t.Fatalf("sort %s: expected %v but got %v", tt.sort, tt.expected, ids)
+		}
+
+		// Back from the last page, every page is read again and is followed by more
+		for i := len(pages) - 2; i >= 0; i-- {
+			response = getPage(response.Prev)
+			if !reflect.DeepEqual(pageIDs(response), pages[i]) {
+				t.Fatalf("sort %s: expected page %v but got %v", tt.sort, pages[i], pageIDs(response))
+			}
+			if !response.HasMore {
+				t.Fatalf("sort %s: expected more bookings after page %d", tt.sort, i)
+			}
+		}
+		if len(response.Prev) != 0 {
+			t.Fatalf("sort %s: expected the first page to have no prev link", tt.sort)
+		}
+	}
+}
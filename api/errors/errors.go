@@ -1,98 +1,219 @@
 package errors
 
 import (
+	"context"
 	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
 	"net/http"
 )
 
-type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-}
+// Error is the error the API answers with, see types.APIError
+type Error = types.APIError
 
+// ErrorHandler writes errors as JSON. Errors the API doesn't know are logged
+// with the ID of the request and answered with a generic message and that ID,
+// so they can be correlated without leaking internals to clients.
 func ErrorHandler(c *fiber.Ctx, err error) error {
-	if apiError, ok := err.(Error); ok {
-		return c.Status(apiError.Code).JSON(apiError)
+	var apiError Error
+	if !errors.As(err, &apiError) {
+		apiError = fromError(err)
 	}
-	if errors.Is(err, fiber.ErrMethodNotAllowed) {
-		methodNotAllowedErr := NewError(fiber.StatusMethodNotAllowed, "Method Not Allowed") // 405
-		return c.Status(methodNotAllowedErr.Code).JSON(methodNotAllowedErr)
+	if apiError.Code >= http.StatusInternalServerError {
+		apiError.RequestID = requestID(c)
+		log.Printf("request %s: %s %s: %v", apiError.RequestID, c.Method(), c.Path(), err)
 	}
-	someError := NewError(http.StatusInternalServerError, err.Error()) // 500
-	return c.Status(someError.Code).JSON(someError)
+
+	return c.Status(apiError.Code).JSON(apiError)
 }
 
-func (e Error) Error() string {
-	return e.Message
+// fromError turns errors of fiber and the mongo driver into API errors
+func fromError(err error) Error {
+	var fiberError *fiber.Error
+	switch {
+	case errors.As(err, &fiberError) && fiberError.Code < http.StatusInternalServerError:
+		return NewError(fiberError.Code, fiberError.Message)
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrResourceNotFound()
+	case mongo.IsDuplicateKeyError(err):
+		return Error{
+			Code:      http.StatusConflict, // 409
+			ErrorCode: types.CodeDuplicate,
+			Message:   "Resource already exists",
+		}
+	case errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err):
+		return NewError(http.StatusGatewayTimeout, "The request timed out") // 504
+	case mongo.IsNetworkError(err):
+		return NewError(http.StatusServiceUnavailable, "Service temporarily unavailable") // 503
+	default:
+		return NewError(http.StatusInternalServerError, "Internal Server Error") // 500
+	}
 }
 
-func NewError(code int, msg string) Error {
-	return Error{
-		Code:    code,
-		Message: msg,
+// requestID is the ID the request ID middleware gave the request, when it's
+// not used a new one is generated and sent back in the X-Request-ID header
+func requestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals("requestid").(string); ok && len(id) > 0 {
+		return id
 	}
+
+	id := utils.UUIDv4()
+	c.Set(fiber.HeaderXRequestID, id)
+
+	return id
+}
+
+// NewError creates an error with the error code of its status
+func NewError(code int, msg string) Error {
+	return types.NewAPIError(code, msg)
 }
 
 func ErrWrongCredentials() Error {
 	return Error{
-		Code:    http.StatusBadRequest, // 400
-		Message: "Wrong Credentials",
+		Code:      http.StatusBadRequest, // 400
+		ErrorCode: types.CodeWrongCredentials,
+		Message:   "Wrong Credentials",
 	}
 }
 
 func ErrResourceNotFound() Error {
 	return Error{
-		Code:    http.StatusNotFound, // 404
-		Message: "Resource Not Found",
+		Code:      http.StatusNotFound, // 404
+		ErrorCode: types.CodeNotFound,
+		Message:   "Resource Not Found",
 	}
 }
 
 func ErrBadRequest() Error {
 	return Error{
-		Code:    http.StatusBadRequest, // 400
-		Message: "Failed to parse JSON data",
+		Code:      http.StatusBadRequest, // 400
+		ErrorCode: types.CodeMalformedBody,
+		Message:   "Failed to parse JSON data",
+	}
+}
+
+// ErrValidation reports the violations of invalid params field by field
+func ErrValidation(err error) Error {
+	apiError := Error{
+		Code:      http.StatusBadRequest, // 400
+		ErrorCode: types.CodeValidationFailed,
+		Message:   err.Error(),
+	}
+
+	var validationError *types.ValidationError
+	if errors.As(err, &validationError) {
+		apiError.Violations = validationError.Violations
+	}
+
+	return apiError
+}
+
+// ErrInvalidQuery reports the query parameters that can't be parsed
+func ErrInvalidQuery(violations ...types.Violation) Error {
+	return Error{
+		Code:       http.StatusBadRequest, // 400
+		ErrorCode:  types.CodeInvalidQuery,
+		Message:    "Invalid query parameters",
+		Violations: violations,
 	}
 }
 
 func ErrForbidden() Error {
 	return Error{
-		Code:    http.StatusForbidden, // 403
-		Message: "Access Forbidden",
+		Code:      http.StatusForbidden, // 403
+		ErrorCode: types.CodeForbidden,
+		Message:   "Access Forbidden",
 	}
 }
 
 func ErrTokenExpired() Error {
 	return Error{
-		Code:    http.StatusUnauthorized, // 401
-		Message: "Token is expired",
+		Code:      http.StatusUnauthorized, // 401
+		ErrorCode: types.CodeTokenExpired,
+		Message:   "Token is expired",
 	}
 }
 
 func ErrInvalidToken() Error {
 	return Error{
-		Code:    http.StatusUnauthorized, // 401
-		Message: "Invalid Token",
+		Code:      http.StatusUnauthorized, // 401
+		ErrorCode: types.CodeInvalidToken,
+		Message:   "Invalid Token",
 	}
 }
 
 func ErrNoToken() Error {
 	return Error{
-		Code:    http.StatusUnauthorized, // 401
-		Message: "No token provided",
+		Code:      http.StatusUnauthorized, // 401
+		ErrorCode: types.CodeNoToken,
+		Message:   "No token provided",
 	}
 }
 
 func ErrUnauthorized() Error {
 	return Error{
-		Code:    http.StatusUnauthorized, // 401
-		Message: "Authentication required",
+		Code:      http.StatusUnauthorized, // 401
+		ErrorCode: types.CodeUnauthorized,
+		Message:   "Authentication required",
 	}
 }
 
 func ErrInvalidID() Error {
 	return Error{
-		Code:    http.StatusBadRequest, // 400
-		Message: "Invalid ID",
+		Code:      http.StatusBadRequest, // 400
+		ErrorCode: types.CodeInvalidID,
+		Message:   "Invalid ID",
+	}
+}
+
+func ErrIdempotencyKeyReused() Error {
+	return Error{
+		Code:      http.StatusUnprocessableEntity, // 422
+		ErrorCode: types.CodeIdempotencyKeyReused,
+		Message:   "Idempotency-Key was already used for a different request",
+	}
+}
+
+func ErrIdempotencyKeyInProgress() Error {
+	return Error{
+		Code:      http.StatusConflict, // 409
+		ErrorCode: types.CodeIdempotencyKeyInProgress,
+		Message:   "A request with this Idempotency-Key is still being handled",
+	}
+}
+
+// ErrBookingNotCancelable tells why the booking can't be canceled anymore, e.g. the stay started
+func ErrBookingNotCancelable(msg string) Error {
+	return Error{
+		Code:      http.StatusConflict, // 409
+		ErrorCode: types.CodeBookingNotCancelable,
+		Message:   msg,
+	}
+}
+
+func ErrTooManyRequests() Error {
+	return Error{
+		Code:      http.StatusTooManyRequests, // 429
+		ErrorCode: types.CodeTooManyRequests,
+		Message:   "Too many requests, please retry later",
+	}
+}
+
+func ErrPreconditionFailed() Error {
+	return Error{
+		Code:      http.StatusPreconditionFailed, // 412
+		ErrorCode: types.CodePreconditionFailed,
+		Message:   "The resource was changed since it was read, please read it again",
+	}
+}
+
+func ErrPreconditionRequired() Error {
+	return Error{
+		Code:      http.StatusPreconditionRequired, // 428
+		ErrorCode: types.CodePreconditionRequired,
+		Message:   "If-Match header with the ETag of the resource is required",
 	}
 }
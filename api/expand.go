@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"strings"
+)
+
+// responseShape is what ?expand= and ?fields= ask for: the related resources to embed
+// and the fields to return, e.g. ?expand=room,user&fields=id,fromDate,room
+type responseShape struct {
+	expand map[string]bool
+	// fields are the top level fields to return, every field when it's empty, id is always returned
+	fields map[string]bool
+}
+
+type shapeParams struct {
+	Expand []string
+	Fields []string
+}
+
+// parseShape reads the shape of the responses of resources like the resource,
+// expandable are the relations the route can embed
+func parseShape(c *fiber.Ctx, resource any, expandable ...string) (*responseShape, error) {
+	var params shapeParams
+	if err := parseQuery(c, &params); err != nil {
+		return nil, err
+	}
+
+	shape := &responseShape{
+		expand: map[string]bool{},
+		fields: map[string]bool{},
+	}
+	ve := &types.ValidationError{}
+
+	known := jsonFields(reflect.TypeOf(resource))
+	canExpand := map[string]bool{}
+	for _, name := range expandable {
+		canExpand[name] = true
+	}
+
+	for _, name := range params.Expand {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			continue
+		}
+		if !canExpand[name] {
+			ve.Add("expand", types.ViolationInvalid, "%s can't be expanded, expand should be one of %s", name, strings.Join(expandable, ","))
+			continue
+		}
+		shape.expand[name] = true
+	}
+
+	for _, name := range params.Fields {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			continue
+		}
+		// Relations are only fields of the response when they are expanded
+		if !known[name] && !shape.expand[name] {
+			if canExpand[name] {
+				ve.Add("fields", types.ViolationInvalid, "%s is only a field when it's expanded", name)
+			} else {
+				ve.Add("fields", types.ViolationInvalid, "%s is not a field", name)
+			}
+			continue
+		}
+		shape.fields[name] = true
+	}
+
+	if len(ve.Violations) > 0 {
+		return nil, myErrors.ErrInvalidQuery(ve.Violations...)
+	}
+
+	return shape, nil
+}
+
+// isDefault reports whether the resources are returned as they are
+func (s *responseShape) isDefault() bool {
+	return len(s.expand) == 0 && len(s.fields) == 0
+}
+
+// apply turns the resource into a JSON object with the embedded relations and only the asked fields.
+// Embedded relations replace the fields of the same name, e.g. the IDs of the rooms of a hotel.
+func (s *responseShape) apply(resource any, embedded map[string]any) (any, error) {
+	if s.isDefault() {
+		return resource, nil
+	}
+
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(b, &object); err != nil {
+		return nil, err
+	}
+
+	shaped := make(map[string]any, len(object)+len(embedded))
+	for name, value := range object {
+		shaped[name] = value
+	}
+	for name, value := range embedded {
+		shaped[name] = value
+	}
+
+	if len(s.fields) > 0 {
+		for name := range shaped {
+			if name != "id" && !s.fields[name] {
+				delete(shaped, name)
+			}
+		}
+	}
+
+	return shaped, nil
+}
+
+// jsonFields are the names the fields of the struct have in JSON
+func jsonFields(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		fields[name] = true
+	}
+
+	return fields
+}
+
+// uniqueIDs drops the zero and repeated IDs, so they are looked up once
+func uniqueIDs(ids []primitive.ObjectID) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool, len(ids))
+	unique := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if id.IsZero() || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+
+	return unique
+}
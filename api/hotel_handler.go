@@ -1,21 +1,33 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/currency"
 	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/http"
+	"strings"
 )
 
+const minSearchQueryLen = 2
+
 type HotelHandler struct {
 	store *db.Store
+	rates currency.RateProvider
 }
 
-func NewHotelHandler(store *db.Store) *HotelHandler {
+func NewHotelHandler(store *db.Store, rates currency.RateProvider) *HotelHandler {
 	return &HotelHandler{
 		store: store,
+		rates: rates,
 	}
 }
 
@@ -27,6 +39,11 @@ func (h *HotelHandler) HandleGetHotel(c *fiber.Ctx) error {
 		return myErrors.ErrInvalidID()
 	}
 
+	shape, err := parseShape(c, types.Hotel{}, hotelExpandable...)
+	if err != nil {
+		return err
+	}
+
 	hotel, err := h.store.Hotel.GetHotelByID(c.Context(), oid)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -36,10 +53,194 @@ func (h *HotelHandler) HandleGetHotel(c *fiber.Ctx) error {
 		return err
 	}
 
-	return c.JSON(hotel)
+	shaped, err := h.shapeHotels(c.Context(), shape, []*types.Hotel{hotel})
+	if err != nil {
+		return err
+	}
+
+	// The version of the hotel only stands for the full hotel, shaped responses get an ETag of their own
+	if !shape.isDefault() {
+		return c.JSON(shaped[0])
+	}
+
+	return sendVersioned(c, hotel.Version, shaped[0])
 }
 
-func (h *HotelHandler) HandleGetRooms(c *fiber.Ctx) error {
+// hotelExpandable are the relations ?expand= can embed in hotels
+var hotelExpandable = []string{"rooms"}
+
+// shapeHotels shapes the hotels for the response, the rooms of every hotel are read at once
+func (h *HotelHandler) shapeHotels(ctx context.Context, shape *responseShape, hotels []*types.Hotel) ([]any, error) {
+	rooms := map[primitive.ObjectID]*types.Room{}
+	if shape.expand["rooms"] {
+		var roomIDs []primitive.ObjectID
+		for _, hotel := range hotels {
+			roomIDs = append(roomIDs, hotel.Rooms...)
+		}
+
+		found, err := h.store.Room.GetRoomsByIDs(ctx, uniqueIDs(roomIDs))
+		if err != nil {
+			return nil, err
+		}
+		for _, room := range found {
+			rooms[room.ID] = room
+		}
+	}
+
+	shaped := make([]any, 0, len(hotels))
+	for _, hotel := range hotels {
+		embedded := map[string]any{}
+		if shape.expand["rooms"] {
+			hotelRooms := make([]*types.Room, 0, len(hotel.Rooms))
+			for _, id := range hotel.Rooms {
+				if room, ok := rooms[id]; ok {
+					hotelRooms = append(hotelRooms, room)
+				}
+			}
+			embedded["rooms"] = hotelRooms
+		}
+
+		resource, err := shape.apply(hotel, embedded)
+		if err != nil {
+			return nil, err
+		}
+		shaped = append(shaped, resource)
+	}
+
+	return shaped, nil
+}
+
+func (h *HotelHandler) HandlePostRoomType(c *fiber.Ctx) error {
+	hotelOID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	var params types.CreateRoomTypeParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	if _, err := h.store.Hotel.GetHotelByID(c.Context(), hotelOID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	for _, roomOID := range params.RoomIDs {
+		room, err := h.store.Room.GetRoomByID(c.Context(), roomOID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return myErrors.ErrResourceNotFound()
+			}
+
+			return err
+		}
+		if room.HotelID != hotelOID {
+			return myErrors.NewError(http.StatusBadRequest, fmt.Sprintf("Room %s does not belong to the hotel", roomOID.Hex()))
+		}
+		if !room.RoomTypeID.IsZero() {
+			return errRoomHasRoomType(room.ID)
+		}
+	}
+
+	roomType := types.NewRoomTypeFromParams(params)
+
+	// The rooms are claimed before the room type is added, a room taken by another room type
+	// in the meantime or a failed write gives the claimed rooms back, so no half of it is left
+	claimed := make([]primitive.ObjectID, 0, len(params.RoomIDs))
+	for _, roomOID := range params.RoomIDs {
+		filter := bson.M{"_id": roomOID, "hotelID": hotelOID, "roomTypeID": nil}
+		update := bson.M{"$set": bson.M{"roomTypeID": roomType.ID}}
+
+		if err := h.store.Room.UpdateRoom(c.Context(), filter, update); err != nil {
+			h.releaseRooms(c.Context(), roomType.ID, claimed)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return errRoomHasRoomType(roomOID)
+			}
+
+			return err
+		}
+		claimed = append(claimed, roomOID)
+	}
+
+	if err := h.store.Hotel.AddRoomType(c.Context(), hotelOID, roomType); err != nil {
+		h.releaseRooms(c.Context(), roomType.ID, claimed)
+		return err
+	}
+
+	return c.Status(http.StatusCreated).JSON(roomType)
+}
+
+func errRoomHasRoomType(roomID primitive.ObjectID) myErrors.Error {
+	return myErrors.NewError(http.StatusConflict, fmt.Sprintf("Room %s already belongs to a room type", roomID.Hex()))
+}
+
+// releaseRooms takes the rooms out of a room type that couldn't be added
+func (h *HotelHandler) releaseRooms(ctx context.Context, roomTypeID primitive.ObjectID, roomIDs []primitive.ObjectID) {
+	for _, roomID := range roomIDs {
+		filter := bson.M{"_id": roomID, "roomTypeID": roomTypeID}
+		update := bson.M{"$unset": bson.M{"roomTypeID": ""}}
+
+		if err := h.store.Room.UpdateRoom(ctx, filter, update); err != nil {
+			log.Printf("failed to release room %s of room type %s: %v", roomID.Hex(), roomTypeID.Hex(), err)
+		}
+	}
+}
+
+func (h *HotelHandler) HandlePutHotel(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	var params types.UpdateHotelParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	set := params.ToBSON()
+	if len(set) == 0 {
+		return myErrors.NewError(http.StatusBadRequest, "Nothing to update")
+	}
+
+	filter := db.MatchVersion(bson.M{"_id": oid}, versions...)
+	update := bson.M{
+		"$set": set,
+	}
+	if unset := params.Unset(); len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	if err := h.store.Hotel.UpdateHotel(c.Context(), filter, update); err != nil {
+		return writeError(err)
+	}
+
+	setWrittenETag(c, versions)
+
+	return c.JSON(map[string]string{
+		"updated": id,
+	})
+}
+
+func (h *HotelHandler) HandlePutHotelPricing(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -47,12 +248,54 @@ func (h *HotelHandler) HandleGetRooms(c *fiber.Ctx) error {
 		return myErrors.ErrInvalidID()
 	}
 
-	roomQueryParams := &db.RoomQueryParams{
-		HotelID: oid,
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	var params types.UpdateHotelPricingParams
+	if err := parseBody(c, &params); err != nil {
+		return err
 	}
 
-	rooms, err := h.store.Room.GetRooms(c.Context(), roomQueryParams, &roomQueryParams.Pagination)
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	filter := db.MatchVersion(bson.M{"_id": oid}, versions...)
+	update := bson.M{
+		"$set": params.ToBSON(),
+	}
+
+	if err := h.store.Hotel.UpdateHotel(c.Context(), filter, update); err != nil {
+		return writeError(err)
+	}
+
+	setWrittenETag(c, versions)
+
+	return c.JSON(map[string]string{
+		"updated": id,
+	})
+}
+
+func (h *HotelHandler) HandleGetRooms(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	var roomQueryParams db.RoomQueryParams
+	if err := parseQuery(c, &roomQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&roomQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	if _, err := h.store.Hotel.GetHotelByID(c.Context(), oid); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return myErrors.ErrResourceNotFound()
 		}
@@ -60,28 +303,84 @@ func (h *HotelHandler) HandleGetRooms(c *fiber.Ctx) error {
 		return err
 	}
 
-	return c.JSON(rooms)
+	roomQueryParams.HotelID = oid
+
+	rooms, err := h.store.Room.GetRooms(c.Context(), &roomQueryParams, &roomQueryParams.Pagination)
+	if err != nil {
+		return listError(err)
+	}
+
+	if err := setDisplayPrices(c.Context(), h.store.Hotel, h.rates, rooms, c.Query("currency")); err != nil {
+		return err
+	}
+
+	response := newPageResponse(c, rooms, len(rooms), &roomQueryParams.Pagination)
+
+	return c.JSON(response)
 }
 
 func (h *HotelHandler) HandleGetHotels(c *fiber.Ctx) error {
 	var hotelQueryParams db.HotelQueryParams
-	if err := c.QueryParser(&hotelQueryParams); err != nil {
-		return myErrors.ErrBadRequest()
+	if err := parseQuery(c, &hotelQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&hotelQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	if err := hotelQueryParams.Validate(); err != nil {
+		return invalidQuery(err)
+	}
+
+	shape, err := parseShape(c, types.Hotel{}, hotelExpandable...)
+	if err != nil {
+		return err
 	}
 
 	hotels, err := h.store.Hotel.GetHotels(c.Context(), &hotelQueryParams, &hotelQueryParams.Pagination)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return myErrors.ErrResourceNotFound()
-		}
+		return listError(err)
+	}
+
+	shaped, err := h.shapeHotels(c.Context(), shape, hotels)
+	if err != nil {
+		return err
+	}
+
+	response := newPageResponse(c, shaped, len(hotels), &hotelQueryParams.Pagination)
 
+	return c.JSON(response)
+}
+
+// HandleSearchHotels returns the hotels best matching ?q= with the matches highlighted
+func (h *HotelHandler) HandleSearchHotels(c *fiber.Ctx) error {
+	var hotelSearchParams db.HotelSearchParams
+	if err := parseQuery(c, &hotelSearchParams); err != nil {
+		return err
+	}
+
+	hotelSearchParams.Q = strings.TrimSpace(hotelSearchParams.Q)
+	if len(hotelSearchParams.Q) < minSearchQueryLen {
+		return myErrors.ErrInvalidQuery(types.Violation{
+			Field:   "q",
+			Code:    types.ViolationTooShort,
+			Message: fmt.Sprintf("q should be at least %d characters", minSearchQueryLen),
+		})
+	}
+
+	results, err := h.store.Hotel.SearchHotels(c.Context(), &hotelSearchParams)
+	if err != nil {
 		return err
 	}
 
+	// The whole list is one page
+	total := int64(len(results))
 	response := &resourceResponse{
-		Results: len(hotels),
-		Page:    hotelQueryParams.Page,
-		Data:    hotels,
+		Results: len(results),
+		Page:    1,
+		Total:   &total,
+		Data:    results,
 	}
 
 	return c.JSON(response)
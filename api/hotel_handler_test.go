@@ -0,0 +1,564 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetHotelsFilteredByAmenitiesAndPolicies(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel      = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		otherHotel = fixtures.AddHotel(tdb.store, "otherHotel", "Testestan", nil, 4)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		hotelHandler = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	route.Put("/hotel/:id", middleware.AdminAuth, hotelHandler.HandlePutHotel)
+	route.Get("/hotel", hotelHandler.HandleGetHotels)
+
+	listings := map[*types.Hotel]types.UpdateHotelParams{
+		hotel: {
+			Address:   &types.Address{City: "Almaty", Country: "KZ", Latitude: 43.238, Longitude: 76.945},
+			Amenities: []string{"wifi", "pool", "parking"},
+			Policies:  &types.HotelPolicies{PetsAllowed: true, CheckInFrom: "14:00", CheckOutUntil: "12:00"},
+			Descriptions: map[string]string{
+				"en": "A quiet hotel in the mountains",
+			},
+		},
+		otherHotel: {
+			Amenities: []string{"wifi", "pool"},
+			Policies:  &types.HotelPolicies{PetsAllowed: false},
+		},
+	}
+
+	for h, params := range listings {
+		b, _ := json.Marshal(params)
+		req := httptest.NewRequest(http.MethodPut, "/hotel/"+h.ID.Hex(), bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("If-Match", versionETag(h.Version))
+		req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hotel?amenities=wifi,pool&petsAllowed=true&language=en", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Results int            `json:"results"`
+		Data    []*types.Hotel `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Results != 1 || response.Data[0].ID != hotel.ID {
+		t.Fatalf("expected only hotel %s", hotel.ID.Hex())
+	}
+	if response.Data[0].Address.City != "Almaty" || response.Data[0].Policies.CheckInFrom != "14:00" {
+		t.Fatal("expected the listing to be returned with the hotel")
+	}
+}
+
+func TestPutHotelIfMatch(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		hotelHandler = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	route.Put("/hotel/:id", middleware.AdminAuth, hotelHandler.HandlePutHotel)
+
+	// The hotel starts at version 0, every successful write bumps it
+	tests := []struct {
+		name           string
+		ifMatch        string
+		expectedStatus int
+	}{
+		{"missing header", "", http.StatusPreconditionRequired},
+		{"stale version", versionETag(5), http.StatusPreconditionFailed},
+		{"listed version", versionETag(7) + ", " + versionETag(0), http.StatusOK},
+		{"replaced version", versionETag(0), http.StatusPreconditionFailed},
+		{"any version", "*", http.StatusOK},
+		{"malformed etag", "1", http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		b, _ := json.Marshal(types.UpdateHotelParams{Name: tt.name})
+		req := httptest.NewRequest(http.MethodPut, "/hotel/"+hotel.ID.Hex(), bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+		if len(tt.ifMatch) > 0 {
+			req.Header.Add("If-Match", tt.ifMatch)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != tt.expectedStatus {
+			t.Fatalf("%s: expected http status code %d but got %d", tt.name, tt.expectedStatus, resp.StatusCode)
+		}
+	}
+
+	updated, err := tdb.store.Hotel.GetHotelByID(context.Background(), hotel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Version != 2 || updated.Name != "any version" {
+		t.Fatalf("expected version 2 named any version but got version %d named %s", updated.Version, updated.Name)
+	}
+}
+
+func TestPostRoomTypeWithAssignedRoom(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel        = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		freeRoom     = fixtures.AddRoom(tdb.store, "large", true, 39990, hotel.ID)
+		assignedRoom = fixtures.AddRoom(tdb.store, "large", true, 39990, hotel.ID)
+		roomType     = fixtures.AddRoomType(tdb.store, hotel.ID, "Deluxe Sea View", 1, 39990, []*types.Room{assignedRoom})
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		hotelHandler = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	route.Post("/hotel/:id/roomtype", middleware.AdminAuth, hotelHandler.HandlePostRoomType)
+
+	params := types.CreateRoomTypeParams{
+		Name:      "Standard",
+		Inventory: 2,
+		Price:     19990,
+		RoomIDs:   []primitive.ObjectID{freeRoom.ID, assignedRoom.ID},
+	}
+	b, _ := json.Marshal(params)
+
+	req := httptest.NewRequest(http.MethodPost, "/hotel/"+hotel.ID.Hex()+"/roomtype", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected http status code 409 but got %d", resp.StatusCode)
+	}
+
+	updated, err := tdb.store.Hotel.GetHotelByID(context.Background(), hotel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.RoomTypes) != 1 {
+		t.Fatalf("expected 1 room type but got %d", len(updated.RoomTypes))
+	}
+
+	for room, expected := range map[*types.Room]primitive.ObjectID{freeRoom: primitive.NilObjectID, assignedRoom: roomType.ID} {
+		stored, err := tdb.store.Room.GetRoomByID(context.Background(), room.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.RoomTypeID != expected {
+			t.Fatalf("expected room %s to have room type %s but got %s", room.ID.Hex(), expected.Hex(), stored.RoomTypeID.Hex())
+		}
+	}
+}
+
+func TestGetHotelsWithinRadius(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		nearHotel = fixtures.AddHotel(tdb.store, "nearHotel", "Almaty", nil, 4)
+		farHotel  = fixtures.AddHotel(tdb.store, "farHotel", "Astana", nil, 4)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		hotelHandler = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	addresses := map[*types.Hotel]*types.Address{
+		nearHotel: {City: "Almaty", Latitude: 43.2567, Longitude: 76.9286},
+		farHotel:  {City: "Astana", Latitude: 51.1605, Longitude: 71.4704},
+	}
+	for hotel, address := range addresses {
+		filter := bson.M{"_id": hotel.ID}
+		update := bson.M{
+			"$set": types.UpdateHotelParams{Address: address}.ToBSON(),
+		}
+		if err := tdb.store.Hotel.UpdateHotel(context.Background(), filter, update); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	route.Get("/hotel", hotelHandler.HandleGetHotels)
+
+	// About 2 km from the near hotel
+	req := httptest.NewRequest(http.MethodGet, "/hotel?lat=43.2389&lng=76.9187&radiusKm=5", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Results int            `json:"results"`
+		Data    []*types.Hotel `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Results != 1 || response.Data[0].ID != nearHotel.ID {
+		t.Fatalf("expected only hotel %s", nearHotel.ID.Hex())
+	}
+	if distance := response.Data[0].DistanceKm; distance == nil || *distance < 1.5 || *distance > 2.5 {
+		t.Fatalf("expected a distance of about 2 km but got %v", distance)
+	}
+}
+
+func TestGetHotelsWithinBBox(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		nearHotel = fixtures.AddHotel(tdb.store, "nearHotel", "Almaty", nil, 4)
+		farHotel  = fixtures.AddHotel(tdb.store, "farHotel", "Astana", nil, 4)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		hotelHandler = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	addresses := map[*types.Hotel]*types.Address{
+		nearHotel: {City: "Almaty", Latitude: 43.2567, Longitude: 76.9286},
+		farHotel:  {City: "Astana", Latitude: 51.1605, Longitude: 71.4704},
+	}
+	for hotel, address := range addresses {
+		filter := bson.M{"_id": hotel.ID}
+		update := bson.M{
+			"$set": types.UpdateHotelParams{Address: address}.ToBSON(),
+		}
+		if err := tdb.store.Hotel.UpdateHotel(context.Background(), filter, update); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	route.Get("/hotel", hotelHandler.HandleGetHotels)
+
+	tests := []struct {
+		name           string
+		bbox           string
+		expectedStatus int
+		expectedHotels []primitive.ObjectID
+	}{
+		{
+			name:           "around the near hotel",
+			bbox:           "76.5,43,77.5,43.5",
+			expectedStatus: http.StatusOK,
+			expectedHotels: []primitive.ObjectID{nearHotel.ID},
+		},
+		{
+			name:           "around both hotels",
+			bbox:           "70,40,80,55",
+			expectedStatus: http.StatusOK,
+			expectedHotels: []primitive.ObjectID{nearHotel.ID, farHotel.ID},
+		},
+		{
+			name:           "swapped corners",
+			bbox:           "77.5,43.5,76.5,43",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "latitude out of range",
+			bbox:           "76.5,43,77.5,95",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/hotel?bbox="+tt.bbox, nil)
+			req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("expected http status code %d but got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data []*types.Hotel `json:"data"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(response.Data) != len(tt.expectedHotels) {
+				t.Fatalf("expected %d hotels but got %d", len(tt.expectedHotels), len(response.Data))
+			}
+			for _, hotel := range response.Data {
+				found := false
+				for _, id := range tt.expectedHotels {
+					found = found || hotel.ID == id
+				}
+				if !found {
+					t.Fatalf("expected hotel %s not to be returned", hotel.ID.Hex())
+				}
+			}
+		})
+	}
+}
+
+func TestSearchHotelsWithTypo(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hilton = fixtures.AddHotel(tdb.store, "Hilton Garden Inn", "Almaty", nil, 4)
+		_      = fixtures.AddHotel(tdb.store, "Marriott", "Astana", nil, 5)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		hotelHandler = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	route.Get("/hotel/search", hotelHandler.HandleSearchHotels)
+
+	for _, q := range []string{"hilton", "HILT", "hiltn"} {
+		req := httptest.NewRequest(http.MethodGet, "/hotel/search?q="+q, nil)
+		req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected http status code 200 but got %d", q, resp.StatusCode)
+		}
+
+		var response struct {
+			Results int                        `json:"results"`
+			Data    []*types.HotelSearchResult `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		if response.Results != 1 || response.Data[0].Hotel.ID != hilton.ID {
+			t.Fatalf("%s: expected only hotel %s", q, hilton.Name)
+		}
+		if highlight := response.Data[0].Highlights["name"]; highlight != "<em>Hilton</em> Garden Inn" {
+			t.Fatalf("%s: unexpected highlight %q", q, highlight)
+		}
+	}
+}
+
+func TestGetRoomsOfHotelWithoutMatches(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		_     = fixtures.AddRoom(tdb.store, "small", false, 10000, hotel.ID)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		hotelHandler = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	route.Get("/hotel/:id/rooms", hotelHandler.HandleGetRooms)
+
+	req := httptest.NewRequest(http.MethodGet, "/hotel/"+hotel.ID.Hex()+"/rooms?seaside=true", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Results int           `json:"results"`
+		Data    []*types.Room `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Results != 0 || response.Data == nil || len(response.Data) != 0 {
+		t.Fatalf("expected an empty list but got %d rooms", response.Results)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/hotel/"+primitive.NewObjectID().Hex()+"/rooms", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected http status code 404 for a missing hotel but got %d", resp.StatusCode)
+	}
+}
+
+func TestGetHotelsExpandedRooms(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel      = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		otherHotel = fixtures.AddHotel(tdb.store, "otherHotel", "Testestan", nil, 4)
+
+		rooms = map[primitive.ObjectID][]*types.Room{
+			hotel.ID: {
+				fixtures.AddRoom(tdb.store, "small", false, 9990, hotel.ID),
+				fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID),
+			},
+			otherHotel.ID: {
+				fixtures.AddRoom(tdb.store, "large", true, 29990, otherHotel.ID),
+			},
+		}
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		hotelHandler = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	route.Get("/hotel", hotelHandler.HandleGetHotels)
+
+	req := httptest.NewRequest(http.MethodGet, "/hotel?expand=rooms&fields=name,rooms", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Data []struct {
+			ID       primitive.ObjectID `json:"id"`
+			Name     string             `json:"name"`
+			Location string             `json:"location"`
+			Rooms    []*types.Room      `json:"rooms"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response.Data) != len(rooms) {
+		t.Fatalf("expected %d hotels but got %d", len(rooms), len(response.Data))
+	}
+	for _, h := range response.Data {
+		if len(h.Name) == 0 || len(h.Location) > 0 {
+			t.Fatalf("expected only the name and rooms of hotel %s", h.ID.Hex())
+		}
+
+		expected := rooms[h.ID]
+		if len(h.Rooms) != len(expected) {
+			t.Fatalf("expected %d rooms of hotel %s but got %d", len(expected), h.ID.Hex(), len(h.Rooms))
+		}
+		for i, room := range h.Rooms {
+			if room.ID != expected[i].ID || room.Price != expected[i].Price {
+				t.Fatalf("expected room %s of hotel %s to be embedded", expected[i].ID.Hex(), h.ID.Hex())
+			}
+		}
+	}
+}
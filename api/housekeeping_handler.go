@@ -0,0 +1,185 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"time"
+)
+
+type HousekeepingHandler struct {
+	store *db.Store
+}
+
+func NewHousekeepingHandler(store *db.Store) *HousekeepingHandler {
+	return &HousekeepingHandler{
+		store: store,
+	}
+}
+
+func (h *HousekeepingHandler) HandlePutHousekeepingStatus(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	var params types.UpdateHousekeepingParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	room, err := h.store.Room.GetRoomByID(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	if err := checkStaffHotel(c, room.HotelID); err != nil {
+		return err
+	}
+
+	if !types.CanTransitionHousekeeping(room.HousekeepingStatus, params.Status) {
+		return myErrors.NewError(http.StatusBadRequest,
+			fmt.Sprintf("Cannot change housekeeping status from %s to %s", room.HousekeepingStatus, params.Status))
+	}
+
+	// The transition was checked against the room as read, so the write is conditional on that version
+	if !versionMatches(versions, room.Version) {
+		return myErrors.ErrPreconditionFailed()
+	}
+
+	filter := db.MatchVersion(bson.M{"_id": room.ID}, room.Version)
+	update := bson.M{
+		"$set": bson.M{
+			"housekeepingStatus": params.Status,
+		},
+	}
+	if err := h.store.Room.UpdateRoom(c.Context(), filter, update); err != nil {
+		return writeError(err)
+	}
+
+	c.Set(fiber.HeaderETag, versionETag(room.Version+1))
+
+	return c.JSON(map[string]string{
+		"updated": id,
+	})
+}
+
+// HandleGetHousekeepingTasks lists rooms of the hotel to service on the given date
+// (today by default): rooms of departing guests, also of guests who checked out early,
+// and rooms of guests staying over.
+func (h *HousekeepingHandler) HandleGetHousekeepingTasks(c *fiber.Ctx) error {
+	hotelOID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	if err := checkStaffHotel(c, hotelOID); err != nil {
+		return err
+	}
+
+	day := time.Now().UTC()
+	if date := c.Query("date"); len(date) > 0 {
+		day, err = time.Parse(types.DateLayout, date)
+		if err != nil {
+			return myErrors.ErrInvalidQuery(types.Violation{Field: "date", Code: types.ViolationInvalid, Message: "date should be in YYYY-MM-DD format"})
+		}
+	}
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	roomQueryParams := db.RoomQueryParams{
+		Pagination: db.Pagination{
+			Limit: maxOverlappingBookings,
+		},
+		HotelID: hotelOID,
+	}
+
+	rooms, err := h.store.Room.GetRooms(c.Context(), &roomQueryParams, &roomQueryParams.Pagination)
+	if err != nil {
+		return err
+	}
+
+	roomStatuses := map[primitive.ObjectID]string{}
+	for _, room := range rooms {
+		roomStatuses[room.ID] = room.HousekeepingStatus
+	}
+
+	canceled := false
+	bookingQueryParams := db.BookingQueryParams{
+		Pagination: db.Pagination{
+			Limit: maxOverlappingBookings,
+		},
+		HotelID:  hotelOID,
+		FromDate: day,
+		TillDate: day.AddDate(0, 0, 1).Add(-time.Nanosecond),
+		Canceled: &canceled,
+	}
+
+	bookings, err := h.store.Booking.GetBookings(c.Context(), &bookingQueryParams, &bookingQueryParams.Pagination)
+	if err != nil {
+		return err
+	}
+
+	tasks := []types.HousekeepingTask{}
+	for _, booking := range bookings {
+		status, ok := roomStatuses[booking.RoomID]
+		if !ok || status == types.HousekeepingOutOfOrder {
+			continue
+		}
+
+		task := types.HousekeepingTask{
+			RoomID:             booking.RoomID,
+			BookingID:          booking.ID,
+			HousekeepingStatus: status,
+		}
+
+		switch nights := types.Nights(day, booking.TillDate); {
+		case nights == 0:
+			task.Type = types.HousekeepingTaskDeparture
+		case booking.CheckedOut:
+			// Guests who left early leave the room for a departure cleaning, until it's done
+			if status != types.HousekeepingDirty {
+				continue
+			}
+			task.Type = types.HousekeepingTaskDeparture
+		case nights > 0 && booking.FromDate.Before(day):
+			task.Type = types.HousekeepingTaskStayover
+		default:
+			continue
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	// The whole list is one page
+	total := int64(len(tasks))
+	response := &resourceResponse{
+		Results: len(tasks),
+		Page:    1,
+		Total:   &total,
+		Data:    tasks,
+	}
+
+	return c.JSON(response)
+}
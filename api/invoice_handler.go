@@ -0,0 +1,395 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/pdf"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/http"
+	"time"
+)
+
+const mimeApplicationPDF = "application/pdf"
+
+type InvoiceHandler struct {
+	store *db.Store
+}
+
+func NewInvoiceHandler(store *db.Store) *InvoiceHandler {
+	return &InvoiceHandler{
+		store: store,
+	}
+}
+
+func (h *InvoiceHandler) HandleGetFolio(c *fiber.Ctx) error {
+	booking, err := h.getOwnBooking(c)
+	if err != nil {
+		return err
+	}
+
+	folio, err := getOrCreateFolio(c.Context(), h.store, booking)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(folio)
+}
+
+// HandlePostFolioExtra charges an extra (minibar, parking, ...) to the stay.
+// An invoice issued before is credited, the next one will include the extra.
+func (h *InvoiceHandler) HandlePostFolioExtra(c *fiber.Ctx) error {
+	oid, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	var params types.CreateFolioExtraParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	booking, err := h.store.Booking.GetBookingByID(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	hotelID, err := bookingHotelID(c.Context(), h.store, booking)
+	if err != nil {
+		return err
+	}
+	if err := checkStaffHotel(c, hotelID); err != nil {
+		return err
+	}
+
+	if booking.Canceled {
+		return myErrors.NewError(http.StatusBadRequest, "Cannot charge extras to a canceled booking")
+	}
+
+	folio, err := getOrCreateFolio(c.Context(), h.store, booking)
+	if err != nil {
+		return err
+	}
+
+	line := types.FolioLine{
+		Type:        types.FolioExtra,
+		Description: params.Description,
+		Amount:      params.Amount,
+		Date:        time.Now().UTC(),
+	}
+	if err := h.store.Folio.AddFolioLines(c.Context(), folio.ID, line); err != nil {
+		return err
+	}
+
+	if err := creditActiveInvoice(c.Context(), h.store, booking.ID); err != nil {
+		return err
+	}
+
+	folio.Lines = append(folio.Lines, line)
+
+	return c.Status(http.StatusCreated).JSON(folio)
+}
+
+// HandlePostInvoice issues the invoice of the stay from the folio. The current invoice
+// is returned if it was issued before and nothing was charged since.
+func (h *InvoiceHandler) HandlePostInvoice(c *fiber.Ctx) error {
+	booking, err := h.getOwnBooking(c)
+	if err != nil {
+		return err
+	}
+
+	if booking.Status == types.BookingPending || booking.Status == types.BookingFailed {
+		return myErrors.NewError(http.StatusBadRequest, "Booking is not confirmed")
+	}
+
+	folio, err := getOrCreateFolio(c.Context(), h.store, booking)
+	if err != nil {
+		return err
+	}
+
+	invoice, issued, err := h.issueInvoice(c.Context(), booking, folio)
+	if err != nil {
+		return err
+	}
+
+	if !issued {
+		return c.JSON(invoice)
+	}
+
+	return c.Status(http.StatusCreated).JSON(invoice)
+}
+
+// HandleGetInvoice returns the latest invoice or credit note of the stay. The invoice
+// is rendered as PDF when requested with ?format=pdf or an Accept: application/pdf header.
+func (h *InvoiceHandler) HandleGetInvoice(c *fiber.Ctx) error {
+	booking, err := h.getOwnBooking(c)
+	if err != nil {
+		return err
+	}
+
+	invoice, err := latestInvoice(c.Context(), h.store, booking.ID, "")
+	if err != nil {
+		return err
+	}
+	if invoice == nil {
+		return myErrors.NewError(http.StatusNotFound, "No invoice is issued yet")
+	}
+
+	// Payments may be posted after the invoice was issued
+	if invoice.Kind == types.InvoiceKindInvoice {
+		folio, err := h.store.Folio.GetFolioByBookingID(c.Context(), booking.ID)
+		if err != nil {
+			return err
+		}
+
+		invoice.Paid = folio.PaymentsTotal()
+		invoice.BalanceDue = invoice.Total - invoice.Paid
+	}
+
+	if c.Query("format") != "pdf" && c.Accepts(fiber.MIMEApplicationJSON, mimeApplicationPDF) != mimeApplicationPDF {
+		return c.JSON(invoice)
+	}
+
+	hotel, err := h.store.Hotel.GetHotelByID(c.Context(), booking.HotelID)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if _, err := renderInvoice(invoice, hotel).WriteTo(&buf); err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, mimeApplicationPDF)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", invoice.Number+".pdf"))
+
+	return c.Send(buf.Bytes())
+}
+
+// issueInvoice returns the invoice that was not credited yet. If there is none, a new
+// invoice is issued and reported, unless nothing is charged, e.g. after a free
+// cancellation: then the latest credit note is returned.
+func (h *InvoiceHandler) issueInvoice(ctx context.Context, booking *types.Booking, folio *types.Folio) (*types.Invoice, bool, error) {
+	latest, err := latestInvoice(ctx, h.store, booking.ID, types.InvoiceKindInvoice)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if latest != nil && latest.CreditedByNoteID.IsZero() {
+		return latest, false, nil
+	}
+
+	if folio.ChargesTotal() == 0 {
+		creditNote, err := latestInvoice(ctx, h.store, booking.ID, types.InvoiceKindCreditNote)
+		if err != nil {
+			return nil, false, err
+		}
+		if creditNote == nil {
+			return nil, false, myErrors.NewError(http.StatusBadRequest, "Nothing to invoice")
+		}
+
+		return creditNote, false, nil
+	}
+
+	var revision int64 = 1
+	if latest != nil {
+		revision = latest.Revision + 1
+	}
+
+	seq, err := h.store.Invoice.NextInvoiceNumber(ctx, folio.HotelID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	invoice, err := h.store.Invoice.InsertInvoice(ctx, types.NewInvoiceFromFolio(folio, seq, revision))
+	if err != nil {
+		// A concurrent request issued this revision first
+		if mongo.IsDuplicateKeyError(err) {
+			latest, err := latestInvoice(ctx, h.store, booking.ID, types.InvoiceKindInvoice)
+			return latest, false, err
+		}
+
+		return nil, false, err
+	}
+
+	return invoice, true, nil
+}
+
+// getOwnBooking returns the booking of the path if it belongs to the user or the user is an admin
+func (h *InvoiceHandler) getOwnBooking(c *fiber.Ctx) (*types.Booking, error) {
+	oid, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, myErrors.ErrInvalidID()
+	}
+
+	booking, err := h.store.Booking.GetBookingByID(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, myErrors.ErrResourceNotFound()
+		}
+
+		return nil, err
+	}
+
+	user, ok := getAuthUser(c)
+	if !ok {
+		return nil, myErrors.ErrUnauthorized()
+	}
+	if !user.IsAdmin && booking.UserID != user.ID {
+		return nil, myErrors.ErrForbidden()
+	}
+
+	return booking, nil
+}
+
+// getOrCreateFolio opens the folio of bookings made before folios existed
+// or whose folio could not be opened at booking time
+func getOrCreateFolio(ctx context.Context, store *db.Store, booking *types.Booking) (*types.Folio, error) {
+	folio, err := store.Folio.GetFolioByBookingID(ctx, booking.ID)
+	if err == nil {
+		return folio, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	folio, err = store.Folio.InsertFolio(ctx, types.NewFolioFromBooking(booking))
+	// The unique index on bookingID keeps a concurrent request from opening a second folio
+	if mongo.IsDuplicateKeyError(err) {
+		return store.Folio.GetFolioByBookingID(ctx, booking.ID)
+	}
+
+	return folio, err
+}
+
+// latestInvoice returns the latest invoice or credit note of the booking, or nil if there is none
+func latestInvoice(ctx context.Context, store *db.Store, bookingID primitive.ObjectID, kind string) (*types.Invoice, error) {
+	invoiceQueryParams := db.InvoiceQueryParams{
+		Pagination: db.Pagination{
+			Limit: 1,
+		},
+		BookingID: bookingID,
+		Kind:      kind,
+	}
+
+	invoices, err := store.Invoice.GetInvoices(ctx, &invoiceQueryParams, &invoiceQueryParams.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	if len(invoices) == 0 {
+		return nil, nil
+	}
+
+	return invoices[0], nil
+}
+
+// creditActiveInvoice issues a credit note for the invoice of the booking, if one
+// was issued and not credited yet. The invoice is marked first, so concurrent
+// changes can't credit it twice, and unmarked again when the note isn't issued.
+func creditActiveInvoice(ctx context.Context, store *db.Store, bookingID primitive.ObjectID) error {
+	invoice, err := latestInvoice(ctx, store, bookingID, types.InvoiceKindInvoice)
+	if err != nil {
+		return err
+	}
+	if invoice == nil || !invoice.CreditedByNoteID.IsZero() {
+		return nil
+	}
+
+	noteID := primitive.NewObjectID()
+
+	filter := bson.M{
+		"_id":              invoice.ID,
+		"creditedByNoteID": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"creditedByNoteID": noteID,
+		},
+	}
+	if err := store.Invoice.UpdateInvoice(ctx, filter, update); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+
+		return err
+	}
+
+	if err := insertCreditNote(ctx, store, invoice, noteID); err != nil {
+		filter := bson.M{"_id": invoice.ID, "creditedByNoteID": noteID}
+		update := bson.M{"$unset": bson.M{"creditedByNoteID": ""}}
+		if err := store.Invoice.UpdateInvoice(ctx, filter, update); err != nil {
+			log.Printf("failed to unmark invoice %s after its credit note failed: %v", invoice.ID.Hex(), err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func insertCreditNote(ctx context.Context, store *db.Store, invoice *types.Invoice, noteID primitive.ObjectID) error {
+	seq, err := store.Invoice.NextInvoiceNumber(ctx, invoice.HotelID)
+	if err != nil {
+		return err
+	}
+
+	note := types.NewCreditNote(invoice, seq)
+	note.ID = noteID
+
+	_, err = store.Invoice.InsertInvoice(ctx, note)
+	return err
+}
+
+func renderInvoice(invoice *types.Invoice, hotel *types.Hotel) *pdf.Document {
+	doc := pdf.New()
+
+	title := "Invoice"
+	if invoice.Kind == types.InvoiceKindCreditNote {
+		title = "Credit note"
+	}
+
+	doc.Heading(fmt.Sprintf("%s %s", title, invoice.Number))
+	if hotel != nil {
+		doc.Text(hotel.Name)
+		doc.Text(hotel.Location)
+	}
+	doc.Text("Issued: " + invoice.IssuedAt.Format(types.DateLayout))
+	doc.Text("Booking: " + invoice.BookingID.Hex())
+	if !invoice.CreditedInvoiceID.IsZero() {
+		doc.Text("Credits invoice: " + invoice.CreditedInvoiceID.Hex())
+	}
+	doc.Space()
+
+	money := func(amount int64) string {
+		return types.Money{Amount: amount, Currency: invoice.Currency}.String()
+	}
+
+	for _, line := range invoice.Lines {
+		doc.Row(line.Description, money(line.Amount))
+	}
+	doc.Space()
+
+	doc.Row("Total", money(invoice.Total))
+	if invoice.Kind == types.InvoiceKindInvoice {
+		doc.Row("Paid", money(invoice.Paid))
+		doc.Row("Balance due", money(invoice.BalanceDue))
+	}
+
+	return doc
+}
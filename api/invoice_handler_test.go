@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInvoiceCreditedAfterExtra(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
+		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 2,
+			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 3).UTC(), false)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		invoiceHandler = NewInvoiceHandler(tdb.store)
+	)
+
+	price := types.NewPriceBreakdown(hotel, room.Price, 2, 2)
+
+	filter := bson.M{"_id": booking.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"hotelID": hotel.ID,
+			"price":   price,
+		},
+	}
+	if err := tdb.store.Booking.UpdateBooking(context.Background(), filter, update); err != nil {
+		t.Fatal(err)
+	}
+
+	route.Get("/:id/invoice", invoiceHandler.HandleGetInvoice)
+	route.Post("/:id/invoice", invoiceHandler.HandlePostInvoice)
+	route.Post("/:id/extra", middleware.StaffAuth, invoiceHandler.HandlePostFolioExtra)
+
+	requestInvoice := func(method string, expectedStatus int) *types.Invoice {
+		req := httptest.NewRequest(method, "/"+booking.ID.Hex()+"/invoice", nil)
+		req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("%s: expected status code %d but got %d", method, expectedStatus, resp.StatusCode)
+		}
+
+		var invoice types.Invoice
+		if err := json.NewDecoder(resp.Body).Decode(&invoice); err != nil {
+			t.Fatal(err)
+		}
+
+		return &invoice
+	}
+
+	// Reading doesn't issue the invoice
+	requestInvoice(http.MethodGet, http.StatusNotFound)
+
+	invoice := requestInvoice(http.MethodPost, http.StatusCreated)
+	if invoice.Number != "INV-000001" {
+		t.Fatalf("expected invoice number INV-000001 but got %s", invoice.Number)
+	}
+	if invoice.Total != price.Total {
+		t.Fatalf("expected invoice total %d but got %d", price.Total, invoice.Total)
+	}
+
+	if reissued := requestInvoice(http.MethodPost, http.StatusOK); reissued.Number != invoice.Number {
+		t.Fatalf("expected the current invoice %s but got %s", invoice.Number, reissued.Number)
+	}
+
+	b, _ := json.Marshal(types.CreateFolioExtraParams{Description: "Minibar", Amount: 1500})
+	req := httptest.NewRequest(http.MethodPost, "/"+booking.ID.Hex()+"/extra", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status code 201 but got %d", resp.StatusCode)
+	}
+
+	invoiceQueryParams := db.InvoiceQueryParams{
+		BookingID: booking.ID,
+		Kind:      types.InvoiceKindCreditNote,
+	}
+	creditNotes, err := tdb.store.Invoice.GetInvoices(context.Background(), &invoiceQueryParams, &invoiceQueryParams.Pagination)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creditNotes[0].Number != "CN-000002" || creditNotes[0].Total != -price.Total {
+		t.Fatalf("unexpected credit note %s of %d", creditNotes[0].Number, creditNotes[0].Total)
+	}
+
+	if latest := requestInvoice(http.MethodGet, http.StatusOK); latest.Number != "CN-000002" {
+		t.Fatalf("expected the credit note CN-000002 to be the latest but got %s", latest.Number)
+	}
+
+	invoice = requestInvoice(http.MethodPost, http.StatusCreated)
+	if invoice.Number != "INV-000003" {
+		t.Fatalf("expected invoice number INV-000003 but got %s", invoice.Number)
+	}
+	if invoice.Total != price.Total+1500 {
+		t.Fatalf("expected invoice total %d but got %d", price.Total+1500, invoice.Total)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/"+booking.ID.Hex()+"/invoice?format=pdf", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Header.Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(body, []byte("%PDF-")) {
+		t.Fatal("expected the invoice to be rendered as PDF")
+	}
+}
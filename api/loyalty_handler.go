@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// pendingLoyaltyAge is how long a ledger entry may stay pending before it's taken for abandoned
+const pendingLoyaltyAge = time.Minute
+
+type LoyaltyHandler struct {
+	store *db.Store
+}
+
+func NewLoyaltyHandler(store *db.Store) *LoyaltyHandler {
+	return &LoyaltyHandler{
+		store: store,
+	}
+}
+
+type loyaltyResponse struct {
+	Points         int64              `json:"points"`
+	LifetimePoints int64              `json:"lifetimePoints"`
+	Tier           types.LoyaltyTier  `json:"tier"`
+	NextTier       *types.LoyaltyTier `json:"nextTier,omitempty"`
+	Transactions   *resourceResponse  `json:"transactions"`
+}
+
+// HandleGetLoyalty returns the balance and tier of the user with a page of the ledger
+func (h *LoyaltyHandler) HandleGetLoyalty(c *fiber.Ctx) error {
+	oid, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	authUser, ok := getAuthUser(c)
+	if !ok {
+		return myErrors.ErrUnauthorized()
+	}
+	if !authUser.IsAdmin && authUser.ID != oid {
+		return myErrors.ErrForbidden()
+	}
+
+	var loyaltyQueryParams db.LoyaltyQueryParams
+	if err := parseQuery(c, &loyaltyQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&loyaltyQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	user, err := h.store.User.GetUserByID(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	loyaltyQueryParams.UserID = user.ID
+
+	transactions, err := h.store.Loyalty.GetTransactions(c.Context(), &loyaltyQueryParams, &loyaltyQueryParams.Pagination)
+	if err != nil {
+		return listError(err)
+	}
+	tier, nextTier := types.LoyaltyTierFor(user.LifetimePoints)
+
+	return c.JSON(&loyaltyResponse{
+		Points:         user.LoyaltyPoints,
+		LifetimePoints: user.LifetimePoints,
+		Tier:           tier,
+		NextTier:       nextTier,
+		Transactions:   newPageResponse(c, transactions, len(transactions), &loyaltyQueryParams.Pagination),
+	})
+}
+
+// reverseLoyaltyPoints gives back the points redeemed for a booking that failed or was canceled
+func reverseLoyaltyPoints(ctx context.Context, store *db.Store, booking *types.Booking, description string) error {
+	transaction := types.NewLoyaltyTransaction(booking.UserID, booking.ID, types.LoyaltyReversal, booking.LoyaltyPoints, description)
+	_, err := store.Loyalty.RecordTransaction(ctx, transaction)
+
+	return err
+}
+
+// earnLoyaltyPoints grants points for the room nights, discounts and extras charged
+// to the folio of the checked out stay, converted to the default currency
+func earnLoyaltyPoints(ctx context.Context, store *db.Store, rates currency.RateProvider, booking *types.Booking) error {
+	folio, err := getOrCreateFolio(ctx, store, booking)
+	if err != nil {
+		return err
+	}
+
+	amount, err := currency.Convert(ctx, rates, types.Money{
+		Amount:   folio.LoyaltyEligibleTotal(),
+		Currency: folio.Currency,
+	}, types.DefaultCurrency)
+	if err != nil {
+		return err
+	}
+
+	user, err := store.User.GetUserByID(ctx, booking.UserID)
+	if err != nil {
+		return err
+	}
+
+	points := types.LoyaltyPointsEarned(amount.Amount, user.LifetimePoints)
+	if points > 0 {
+		transaction := types.NewLoyaltyTransaction(booking.UserID, booking.ID, types.LoyaltyEarn, points, "Stay checked out")
+
+		// The points of the stay are already in the ledger when an earlier attempt got that far
+		if _, err := store.Loyalty.RecordTransaction(ctx, transaction); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	filter := bson.M{"_id": booking.ID}
+	update := bson.M{
+		"$unset": bson.M{
+			"loyaltyPending": "",
+		},
+	}
+
+	return store.Booking.UpdateBooking(ctx, filter, update)
+}
+
+// RetryLoyaltyEarnings grants the points of checked out stays that failed to earn them at the checkout
+// and finishes ledger entries left pending. It's meant to run periodically.
+func RetryLoyaltyEarnings(ctx context.Context, store *db.Store, rates currency.RateProvider) error {
+	if err := store.Loyalty.ApplyPendingTransactions(ctx, pendingLoyaltyAge); err != nil {
+		return err
+	}
+
+	bookingQueryParams := db.BookingQueryParams{
+		Pagination: db.Pagination{
+			Limit: maxPageLimit,
+		},
+		LoyaltyPending: true,
+	}
+
+	bookings, err := store.Booking.GetBookings(ctx, &bookingQueryParams, &bookingQueryParams.Pagination)
+	if err != nil {
+		return err
+	}
+
+	for _, booking := range bookings {
+		if err := earnLoyaltyPoints(ctx, store, rates, booking); err != nil {
+			log.Printf("failed to earn loyalty points for booking %s: %v", booking.ID.Hex(), err)
+		}
+	}
+
+	return nil
+}
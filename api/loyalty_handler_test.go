@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBookRoomRedeemLoyaltyPoints(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler    = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+		loyaltyHandler = NewLoyaltyHandler(tdb.store)
+	)
+
+	earn := types.NewLoyaltyTransaction(user.ID, primitive.NilObjectID, types.LoyaltyEarn, 5000, "Welcome bonus")
+	if _, err := tdb.store.Loyalty.RecordTransaction(context.Background(), earn); err != nil {
+		t.Fatal(err)
+	}
+
+	route.Post("/room/:id/book", roomHandler.HandleBookRoom)
+	route.Get("/user/:id/loyalty", loyaltyHandler.HandleGetLoyalty)
+
+	params := types.BookRoomParams{
+		FromDate:      time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:      time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons:    2,
+		PaymentToken:  payment.FakeTokenApproved,
+		LoyaltyPoints: 1500,
+	}
+	b, _ := json.Marshal(params)
+
+	req := httptest.NewRequest(http.MethodPost, "/room/"+room.ID.Hex()+"/book", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected http status code 201 but got %d", resp.StatusCode)
+	}
+
+	var booking types.Booking
+	if err := json.NewDecoder(resp.Body).Decode(&booking); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 nights * 100.00 - 15.00 worth of points
+	if booking.Price.Total != 18500 {
+		t.Fatalf("expected total 18500 but got %d", booking.Price.Total)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/user/"+user.ID.Hex()+"/loyalty", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	var loyalty struct {
+		Points       int64             `json:"points"`
+		Tier         types.LoyaltyTier `json:"tier"`
+		Transactions struct {
+			Results int `json:"results"`
+		} `json:"transactions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&loyalty); err != nil {
+		t.Fatal(err)
+	}
+
+	if loyalty.Points != 3500 {
+		t.Fatalf("expected 3500 points but got %d", loyalty.Points)
+	}
+	if loyalty.Tier.Name != "gold" {
+		t.Fatalf("expected tier gold but got %s", loyalty.Tier.Name)
+	}
+	if loyalty.Transactions.Results != 2 {
+		t.Fatalf("expected 2 transactions but got %d", loyalty.Transactions.Results)
+	}
+}
+
+func TestLoyaltyTransactionKeepsUserVersion(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	user := fixtures.AddUser(tdb.store, "user", "user",
+		"user@example.org", "user", false)
+
+	earn := types.NewLoyaltyTransaction(user.ID, primitive.NilObjectID, types.LoyaltyEarn, 500, "Welcome bonus")
+	if _, err := tdb.store.Loyalty.RecordTransaction(context.Background(), earn); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := tdb.store.User.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.LoyaltyPoints != 500 {
+		t.Fatalf("expected 500 loyalty points but got %d", updated.LoyaltyPoints)
+	}
+	// A write based on the version read before the points were earned still applies
+	if updated.Version != user.Version {
+		t.Fatalf("expected version %d but got %d", user.Version, updated.Version)
+	}
+}
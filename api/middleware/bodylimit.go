@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"io"
+	"net/http"
+)
+
+// BodyLimit rejects requests with bodies larger than the limit limitFor returns for them.
+// The server streams bodies past its own BodyLimit, so routes can take larger bodies than
+// the rest: this should be the first handler to look at the body. Bodies of unknown length
+// (chunked) are read up to the limit here.
+func BodyLimit(limitFor func(c *fiber.Ctx) int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var (
+			limit = limitFor(c)
+			req   = c.Request()
+		)
+
+		length := req.Header.ContentLength()
+		if length == -1 && req.IsBodyStream() {
+			body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(limit)+1))
+			if err != nil {
+				return err
+			}
+
+			length = len(body)
+			if length <= limit {
+				req.SetBody(body)
+			}
+		}
+
+		if length > limit {
+			// The rest of the body isn't read, so the connection can't serve another request
+			c.Context().SetConnectionClose()
+			return errors.NewError(http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("request body should be at most %d bytes", limit))
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/types"
+	"log"
+	"net/http"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+)
+
+// Idempotency makes POST requests safe to retry: the response to the first request
+// sent with an Idempotency-Key is stored and replayed to retries with the same key.
+// Keys are scoped to the authenticated user, requests without a key are handled as usual.
+func Idempotency(store db.IdempotencyStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if c.Method() != http.MethodPost || len(key) == 0 {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			return errors.NewError(http.StatusBadRequest,
+				fmt.Sprintf("%s should be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLen))
+		}
+
+		record := &types.IdempotencyRecord{
+			Key:         key,
+			RequestHash: requestHash(c),
+		}
+		if user, ok := c.Context().UserValue("user").(*types.User); ok {
+			record.UserID = user.ID
+		}
+
+		existing, err := store.ReserveIdempotencyKey(c.Context(), record)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return replay(c, existing, record.RequestHash)
+		}
+
+		// Errors are turned into their responses here, so they are stored too
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
+
+		status := c.Response().StatusCode()
+
+		// Server errors may be transient, so the key is freed for the retry
+		if status >= http.StatusInternalServerError {
+			if err := store.DeleteIdempotencyKey(c.Context(), record); err != nil {
+				log.Println("failed to free idempotency key:", err)
+			}
+			return nil
+		}
+
+		body := append([]byte(nil), c.Response().Body()...)
+		contentType := string(c.Response().Header.ContentType())
+		if err := store.CompleteIdempotencyKey(c.Context(), record, status, contentType, body); err != nil {
+			log.Println("failed to store idempotent response:", err)
+		}
+
+		return nil
+	}
+}
+
+func replay(c *fiber.Ctx, record *types.IdempotencyRecord, requestHash string) error {
+	if record.RequestHash != requestHash {
+		return errors.ErrIdempotencyKeyReused()
+	}
+	if !record.Completed {
+		return errors.ErrIdempotencyKeyInProgress()
+	}
+
+	c.Set(IdempotentReplayedHeader, "true")
+	c.Set(fiber.HeaderContentType, record.ContentType)
+
+	return c.Status(record.StatusCode).Send(record.Body)
+}
+
+// requestHash identifies the request by its method, URL and body
+func requestHash(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method() + " " + c.OriginalURL() + "\n"))
+	hash.Write(c.Body())
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
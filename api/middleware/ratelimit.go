@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/ratelimit"
+	"github.com/rtsoy/hotel-reservation/types"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+)
+
+// RateLimit throttles the requests of every user, or of every client IP for requests
+// that aren't authenticated (yet), to the limit. Routes limited under different names
+// have separate buckets. The limit is reported in the RateLimit-* headers.
+// It panics on an invalid limit, that is a mistake in the routes rather than in a request.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit) fiber.Handler {
+	if err := limit.Validate(); err != nil {
+		panic(err)
+	}
+
+	return func(c *fiber.Ctx) error {
+		key := name + ":ip:" + c.IP()
+		if user, ok := c.Context().UserValue("user").(*types.User); ok {
+			key = name + ":user:" + user.ID.Hex()
+		}
+
+		result, err := store.Take(c.Context(), key, limit)
+		if err != nil {
+			// Failing open, an outage of the backend shouldn't take the API down with it
+			log.Println("failed to rate limit request:", err)
+			return c.Next()
+		}
+
+		c.Set(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+		c.Set(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+		c.Set(RateLimitResetHeader, seconds(result.Reset))
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, seconds(result.RetryAfter))
+			return errors.ErrTooManyRequests()
+		}
+
+		return c.Next()
+	}
+}
+
+// seconds formats the duration in whole seconds, rounded up
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
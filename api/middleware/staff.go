@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/types"
+)
+
+// StaffAuth lets hotel staff and admins through
+func StaffAuth(c *fiber.Ctx) error {
+	user, ok := c.Context().UserValue("user").(*types.User)
+	if !ok {
+		return errors.ErrUnauthorized()
+	}
+
+	if !user.IsAdmin && !user.IsStaff {
+		return errors.ErrForbidden()
+	}
+
+	return c.Next()
+}
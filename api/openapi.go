@@ -0,0 +1,354 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/openapi"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/types"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const apiTokenScheme = "apiToken"
+
+// access tells who can call a route
+type access int
+
+const (
+	accessPublic access = iota
+	accessUser
+	accessAdmin
+	accessStaff
+)
+
+// routeDoc describes a route of the API. Bodies and responses are JSON
+// unless the route documents its content itself.
+type routeDoc struct {
+	method  string
+	path    string
+	tag     string
+	summary string
+	access  access
+	// query is the struct the query string is parsed into
+	query any
+	// params are query parameters the handler reads on its own
+	params []*openapi.Parameter
+	body   any
+	status int
+	// response is the body of the response, page lists the items of a page response instead
+	response any
+	page     any
+	// content is added to the content of the response, for bodies that aren't JSON
+	content map[string]openapi.MediaType
+	// requestContent overrides the content of the request body
+	requestContent map[string]openapi.MediaType
+	// versioned writes require the If-Match header
+	versioned bool
+}
+
+type messageResponse map[string]string
+
+var currencyParam = &openapi.Parameter{
+	Name:        "currency",
+	In:          "query",
+	Description: "ISO 4217 code to convert prices to",
+	Schema:      &openapi.Schema{Type: "string"},
+}
+
+var idempotencyKeyParam = &openapi.Parameter{
+	Name:        middleware.IdempotencyKeyHeader,
+	In:          "header",
+	Description: "Retries with the same key get the response to the first request replayed",
+	Schema:      &openapi.Schema{Type: "string"},
+}
+
+// shapeQueryParams are ?expand= and ?fields= of routes returning the resources with the relations, see parseShape
+func shapeQueryParams(expandable ...string) []*openapi.Parameter {
+	return []*openapi.Parameter{
+		{
+			Name:        "expand",
+			In:          "query",
+			Description: "Comma-separated relations to embed: " + strings.Join(expandable, ", "),
+			Schema:      &openapi.Schema{Type: "string"},
+		},
+		{
+			Name:        "fields",
+			In:          "query",
+			Description: "Comma-separated top level fields to return, id is always returned",
+			Schema:      &openapi.Schema{Type: "string"},
+		},
+	}
+}
+
+var ifMatchParam = &openapi.Parameter{
+	Name:        fiber.HeaderIfMatch,
+	In:          "header",
+	Required:    true,
+	Description: "ETags of the versions the write is based on, or * for any version, the write fails with 412 when the resource is at none of them",
+	Schema:      &openapi.Schema{Type: "string"},
+}
+
+// routeDocs describe every route RegisterRoutes registers, paths are Fiber route paths
+var routeDocs = []routeDoc{
+	// Auth
+	{method: http.MethodPost, path: "/api/auth", tag: "auth", summary: "Authenticate and get an API token",
+		body: AuthParams{}, response: AuthResponse{}},
+
+	// Payments
+	{method: http.MethodPost, path: "/api/payment/webhook", tag: "payments", summary: "Receive a payment provider notification",
+		params: []*openapi.Parameter{{Name: "X-Signature", In: "header", Required: true, Schema: &openapi.Schema{Type: "string"}}},
+		body:   payment.WebhookEvent{}},
+
+	// Photos
+	{method: http.MethodGet, path: "/api/photo/*", tag: "photos", summary: "Download a photo or its thumbnail",
+		content: map[string]openapi.MediaType{"image/*": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}},
+
+	// Docs
+	{method: http.MethodGet, path: "/api/openapi.json", tag: "docs", summary: "This OpenAPI document",
+		content: openapi.JSONContent(&openapi.Schema{Type: "object"})},
+	{method: http.MethodGet, path: "/api/docs", tag: "docs", summary: "Interactive API docs",
+		content: map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}}},
+
+	// Users
+	{method: http.MethodPost, path: "/api/v1/user", tag: "users", summary: "Create a user", access: accessUser,
+		body: types.CreateUserParams{}, status: http.StatusCreated, response: types.User{}},
+	{method: http.MethodGet, path: "/api/v1/user", tag: "users", summary: "List users", access: accessUser,
+		query: db.UserQueryParams{}, page: types.User{}},
+	{method: http.MethodGet, path: "/api/v1/user/:id", tag: "users", summary: "Get a user", access: accessUser,
+		response: types.User{}},
+	{method: http.MethodPut, path: "/api/v1/user/:id", tag: "users", summary: "Update a user", access: accessUser,
+		body: types.UpdateUserParams{}, response: messageResponse{}, versioned: true},
+	{method: http.MethodDelete, path: "/api/v1/user/:id", tag: "users", summary: "Delete a user", access: accessUser,
+		response: messageResponse{}, versioned: true},
+	{method: http.MethodGet, path: "/api/v1/user/:id/loyalty", tag: "users", summary: "Get the loyalty balance and ledger of a user", access: accessUser,
+		query: db.LoyaltyQueryParams{}, response: loyaltyResponse{}},
+
+	// Hotels
+	{method: http.MethodGet, path: "/api/v1/hotel", tag: "hotels", summary: "List hotels", access: accessUser,
+		query: db.HotelQueryParams{}, params: shapeQueryParams(hotelExpandable...), page: types.Hotel{}},
+	{method: http.MethodGet, path: "/api/v1/hotel/search", tag: "hotels", summary: "Search hotels by name and location", access: accessUser,
+		query: db.HotelSearchParams{}, page: types.HotelSearchResult{}},
+	{method: http.MethodGet, path: "/api/v1/hotel/:id", tag: "hotels", summary: "Get a hotel", access: accessUser,
+		params: shapeQueryParams(hotelExpandable...), response: types.Hotel{}},
+	{method: http.MethodGet, path: "/api/v1/hotel/:id/rooms", tag: "hotels", summary: "List the rooms of a hotel", access: accessUser,
+		query: db.RoomQueryParams{}, params: []*openapi.Parameter{currencyParam}, page: types.Room{}},
+	{method: http.MethodGet, path: "/api/v1/hotel/:id/reviews", tag: "reviews", summary: "List the approved reviews of a hotel", access: accessUser,
+		query: db.ReviewQueryParams{}, page: types.Review{}},
+	{method: http.MethodPost, path: "/api/v1/hotel/:id/roomtype/:typeID/book", tag: "bookings", summary: "Book a room type, a room is assigned later", access: accessUser,
+		body: types.BookRoomParams{}, status: http.StatusCreated, response: types.Booking{}},
+
+	// Rooms
+	{method: http.MethodGet, path: "/api/v1/room", tag: "rooms", summary: "List rooms", access: accessUser,
+		query: db.RoomQueryParams{}, params: []*openapi.Parameter{currencyParam}, page: types.Room{}},
+	{method: http.MethodGet, path: "/api/v1/room/:id/quote", tag: "rooms", summary: "Price a stay without booking it", access: accessUser,
+		query: types.BookRoomParams{}, params: []*openapi.Parameter{currencyParam}, response: quoteResponse{}},
+	{method: http.MethodPost, path: "/api/v1/room/:id/book", tag: "bookings", summary: "Book a room", access: accessUser,
+		body: types.BookRoomParams{}, status: http.StatusCreated, response: types.Booking{}},
+
+	// Bookings
+	{method: http.MethodGet, path: "/api/v1/booking/:id", tag: "bookings", summary: "Get a booking", access: accessUser,
+		params: shapeQueryParams(bookingExpandable...), response: types.Booking{}},
+	{method: http.MethodGet, path: "/api/v1/booking/:id/cancel", tag: "bookings", summary: "Cancel a booking", access: accessUser,
+		response: messageResponse{}},
+	{method: http.MethodGet, path: "/api/v1/booking/:id/folio", tag: "billing", summary: "Get the folio of a booking", access: accessUser,
+		response: types.Folio{}},
+	{method: http.MethodPost, path: "/api/v1/booking/:id/invoice", tag: "billing", summary: "Issue the invoice of a booking", access: accessUser,
+		status: http.StatusCreated, response: types.Invoice{}},
+	{method: http.MethodGet, path: "/api/v1/booking/:id/invoice", tag: "billing", summary: "Get the latest invoice or credit note of a booking as JSON or PDF", access: accessUser,
+		params:   []*openapi.Parameter{{Name: "format", In: "query", Description: "pdf renders the invoice as a PDF", Schema: &openapi.Schema{Type: "string"}}},
+		response: types.Invoice{},
+		content:  map[string]openapi.MediaType{mimeApplicationPDF: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}},
+
+	// Reviews
+	{method: http.MethodPost, path: "/api/v1/review", tag: "reviews", summary: "Review a stay", access: accessUser,
+		body: types.CreateReviewParams{}, status: http.StatusCreated, response: types.Review{}},
+
+	// Admin
+	{method: http.MethodPut, path: "/api/v1/admin/user/:id/staff", tag: "users", summary: "Grant or revoke the staff access of a user to hotels", access: accessAdmin,
+		body: types.UpdateStaffParams{}, response: messageResponse{}, versioned: true},
+	{method: http.MethodGet, path: "/api/v1/admin/booking", tag: "bookings", summary: "List bookings", access: accessAdmin,
+		query: db.BookingQueryParams{}, params: shapeQueryParams(bookingExpandable...), page: types.Booking{}},
+	{method: http.MethodPost, path: "/api/v1/admin/booking/:id/assign", tag: "bookings", summary: "Assign a room to a room type booking", access: accessAdmin,
+		body: types.AssignRoomParams{}, response: types.Booking{}},
+	{method: http.MethodPut, path: "/api/v1/admin/hotel/:id", tag: "hotels", summary: "Update a hotel", access: accessAdmin,
+		body: types.UpdateHotelParams{}, response: messageResponse{}, versioned: true},
+	{method: http.MethodPut, path: "/api/v1/admin/room/:id", tag: "rooms", summary: "Update a room", access: accessAdmin,
+		body: types.UpdateRoomParams{}, response: messageResponse{}, versioned: true},
+	{method: http.MethodPost, path: "/api/v1/admin/hotel/:id/photo", tag: "photos", summary: "Upload a hotel photo", access: accessAdmin,
+		requestContent: photoUploadContent, status: http.StatusCreated, response: types.Photo{}},
+	{method: http.MethodPut, path: "/api/v1/admin/hotel/:id/photo/order", tag: "photos", summary: "Reorder the hotel photos", access: accessAdmin,
+		body: types.ReorderPhotosParams{}, response: []types.Photo{}, versioned: true},
+	{method: http.MethodDelete, path: "/api/v1/admin/hotel/:id/photo/:photoID", tag: "photos", summary: "Delete a hotel photo", access: accessAdmin,
+		response: messageResponse{}, versioned: true},
+	{method: http.MethodPost, path: "/api/v1/admin/room/:id/photo", tag: "photos", summary: "Upload a room photo", access: accessAdmin,
+		requestContent: photoUploadContent, status: http.StatusCreated, response: types.Photo{}},
+	{method: http.MethodPut, path: "/api/v1/admin/room/:id/photo/order", tag: "photos", summary: "Reorder the room photos", access: accessAdmin,
+		body: types.ReorderPhotosParams{}, response: []types.Photo{}, versioned: true},
+	{method: http.MethodDelete, path: "/api/v1/admin/room/:id/photo/:photoID", tag: "photos", summary: "Delete a room photo", access: accessAdmin,
+		response: messageResponse{}, versioned: true},
+	{method: http.MethodPost, path: "/api/v1/admin/hotel/:id/roomtype", tag: "hotels", summary: "Create a room type", access: accessAdmin,
+		body: types.CreateRoomTypeParams{}, status: http.StatusCreated, response: types.RoomType{}},
+	{method: http.MethodPut, path: "/api/v1/admin/hotel/:id/pricing", tag: "hotels", summary: "Update the taxes, fees and payment policy of a hotel", access: accessAdmin,
+		body: types.UpdateHotelPricingParams{}, response: messageResponse{}, versioned: true},
+	{method: http.MethodPost, path: "/api/v1/admin/promo", tag: "promo codes", summary: "Create a promo code", access: accessAdmin,
+		body: types.CreatePromoCodeParams{}, status: http.StatusCreated, response: types.PromoCode{}},
+	{method: http.MethodGet, path: "/api/v1/admin/promo", tag: "promo codes", summary: "List promo codes", access: accessAdmin,
+		query: db.PromoCodeQueryParams{}, page: types.PromoCode{}},
+	{method: http.MethodPost, path: "/api/v1/admin/hotel/:id/restriction", tag: "restrictions", summary: "Create a stay restriction", access: accessAdmin,
+		body: types.CreateRestrictionParams{}, status: http.StatusCreated, response: types.Restriction{}},
+	{method: http.MethodGet, path: "/api/v1/admin/hotel/:id/restriction", tag: "restrictions", summary: "List the restrictions of a hotel", access: accessAdmin,
+		query: db.RestrictionQueryParams{}, page: types.Restriction{}},
+	{method: http.MethodDelete, path: "/api/v1/admin/restriction/:id", tag: "restrictions", summary: "Delete a restriction", access: accessAdmin,
+		response: messageResponse{}, versioned: true},
+	{method: http.MethodPost, path: "/api/v1/admin/room/:id/block", tag: "room blocks", summary: "Block a room", access: accessAdmin,
+		body: types.CreateRoomBlockParams{}, status: http.StatusCreated, response: roomBlockResponse{}},
+	{method: http.MethodGet, path: "/api/v1/admin/block", tag: "room blocks", summary: "List room blocks", access: accessAdmin,
+		query: db.RoomBlockQueryParams{}, page: types.RoomBlock{}},
+	{method: http.MethodDelete, path: "/api/v1/admin/block/:id", tag: "room blocks", summary: "Delete a room block", access: accessAdmin,
+		response: messageResponse{}, versioned: true},
+	{method: http.MethodGet, path: "/api/v1/admin/review", tag: "reviews", summary: "List reviews for moderation", access: accessAdmin,
+		query: db.ReviewQueryParams{}, page: types.Review{}},
+	{method: http.MethodPut, path: "/api/v1/admin/review/:id/moderation", tag: "reviews", summary: "Approve or reject a review", access: accessAdmin,
+		body: types.ModerateReviewParams{}, response: types.Review{}, versioned: true},
+
+	// Staff
+	{method: http.MethodPost, path: "/api/v1/staff/booking/:id/checkout", tag: "bookings", summary: "Check a booking out", access: accessStaff,
+		response: messageResponse{}},
+	{method: http.MethodPost, path: "/api/v1/staff/booking/:id/folio/extra", tag: "billing", summary: "Charge an extra to the folio of a booking", access: accessStaff,
+		body: types.CreateFolioExtraParams{}, status: http.StatusCreated, response: types.Folio{}},
+	{method: http.MethodPut, path: "/api/v1/staff/room/:id/housekeeping", tag: "housekeeping", summary: "Update the housekeeping status of a room", access: accessStaff,
+		body: types.UpdateHousekeepingParams{}, response: messageResponse{}, versioned: true},
+	{method: http.MethodGet, path: "/api/v1/staff/hotel/:id/housekeeping", tag: "housekeeping", summary: "List the housekeeping tasks of a hotel for a day", access: accessStaff,
+		params: []*openapi.Parameter{{Name: "date", In: "query", Description: "YYYY-MM-DD, today by default", Schema: &openapi.Schema{Type: "string", Format: "date"}}},
+		page:   types.HousekeepingTask{}},
+}
+
+var photoUploadContent = map[string]openapi.MediaType{
+	fiber.MIMEMultipartForm: {Schema: &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"photo": {Type: "string", Format: "binary", Description: "JPEG, PNG or GIF image"},
+		},
+	}},
+}
+
+// newOpenAPIDocument describes the API, see routeDocs
+func newOpenAPIDocument() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:   "Hotel Reservation API",
+		Version: "1.0.0",
+		Description: "Errors are returned as Error objects with a stable errorCode. " +
+			"Lists are paged by page number or by the cursors of their next and prev links, ?total=true counts every item. " +
+			"Requests are rate limited per user, or per IP before signing in, " +
+			"the limits are reported in the RateLimit-* headers and exceeding them returns 429. " +
+			"Reads send ETags and answer 304 to a matching If-None-Match, " +
+			"writes of versioned resources require the ETags of the versions they are based on, or *, in If-Match.",
+	})
+	doc.Components.SecuritySchemes[apiTokenScheme] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-Api-Token",
+		Description: "Token returned by POST /api/auth",
+	}
+
+	errorResponse := &openapi.Response{
+		Description: "Error",
+		Content:     openapi.JSONContent(doc.SchemaOf(myErrors.Error{})),
+	}
+	pageSchema := doc.SchemaOf(resourceResponse{})
+
+	for _, route := range routeDocs {
+		op := &openapi.Operation{
+			Tags:        []string{route.tag},
+			Summary:     route.summary,
+			OperationID: route.method + " " + route.path,
+			Responses:   map[string]*openapi.Response{"default": errorResponse},
+		}
+
+		switch route.access {
+		case accessUser:
+			op.Security = []openapi.SecurityRequirement{{apiTokenScheme: {}}}
+		case accessAdmin:
+			op.Security = []openapi.SecurityRequirement{{apiTokenScheme: {}}}
+			op.Description = "Requires an admin account."
+		case accessStaff:
+			op.Security = []openapi.SecurityRequirement{{apiTokenScheme: {}}}
+			op.Description = "Requires an admin account or the staff account of the hotel."
+		}
+
+		if route.query != nil {
+			op.Parameters = append(op.Parameters, doc.QueryParams(route.query)...)
+		}
+		op.Parameters = append(op.Parameters, route.params...)
+		if route.method == http.MethodPost && route.access != accessPublic {
+			op.Parameters = append(op.Parameters, idempotencyKeyParam)
+		}
+		if route.versioned {
+			op.Parameters = append(op.Parameters, ifMatchParam)
+		}
+
+		switch {
+		case route.requestContent != nil:
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: route.requestContent}
+		case route.body != nil:
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSONContent(doc.SchemaOf(route.body))}
+		}
+
+		status := route.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := &openapi.Response{Description: http.StatusText(status)}
+		switch {
+		case route.page != nil:
+			response.Content = openapi.JSONContent(&openapi.Schema{AllOf: []*openapi.Schema{
+				pageSchema,
+				{Type: "object", Properties: map[string]*openapi.Schema{"data": doc.ListOf(route.page)}},
+			}})
+		case route.response != nil:
+			response.Content = openapi.JSONContent(doc.SchemaOf(route.response))
+		}
+		for contentType, mediaType := range route.content {
+			if response.Content == nil {
+				response.Content = map[string]openapi.MediaType{}
+			}
+			response.Content[contentType] = mediaType
+		}
+		op.Responses[strconv.Itoa(status)] = response
+
+		doc.AddOperation(route.method, openapi.Path(route.path), op)
+	}
+
+	return doc
+}
+
+type DocsHandler struct {
+	document []byte
+}
+
+func NewDocsHandler() *DocsHandler {
+	document, err := json.Marshal(newOpenAPIDocument())
+	if err != nil {
+		// The document is built from static route docs, so this can't fail at runtime
+		panic(err)
+	}
+
+	return &DocsHandler{
+		document: document,
+	}
+}
+
+func (h *DocsHandler) HandleGetOpenAPI(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Send(h.document)
+}
+
+func (h *DocsHandler) HandleGetDocs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(openapi.UI)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/openapi"
+	"github.com/rtsoy/hotel-reservation/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	// Handlers aren't called, so the routes can be registered without a database
+	app := fiber.New()
+	RegisterRoutes(app, &db.Store{}, nil, nil, nil, ratelimit.NewMemoryStore())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code 200 but got %d", resp.StatusCode)
+	}
+
+	var doc openapi.Document
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != openapi.Version {
+		t.Errorf("expected openapi version %s but got %s", openapi.Version, doc.OpenAPI)
+	}
+
+	registered := map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		// Fiber registers HEAD routes for GET routes on its own
+		if route.Method == http.MethodHead {
+			continue
+		}
+
+		path := openapi.Path(route.Path)
+		registered[route.Method+" "+path] = true
+
+		if doc.Operation(route.Method, path) == nil {
+			t.Errorf("route %s %s is missing from the OpenAPI document", route.Method, route.Path)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("the OpenAPI document describes %s %s, which isn't registered", method, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/http"
+)
+
+type PaymentHandler struct {
+	store    *db.Store
+	payments payment.PaymentProvider
+}
+
+func NewPaymentHandler(store *db.Store, payments payment.PaymentProvider) *PaymentHandler {
+	return &PaymentHandler{
+		store:    store,
+		payments: payments,
+	}
+}
+
+// HandlePaymentWebhook applies asynchronous payment notifications to bookings
+func (h *PaymentHandler) HandlePaymentWebhook(c *fiber.Ctx) error {
+	event, err := h.payments.ParseWebhook(c.Body(), c.Get("X-Signature"))
+	if err != nil {
+		if errors.Is(err, payment.ErrInvalidSignature) {
+			return myErrors.ErrUnauthorized()
+		}
+
+		return myErrors.ErrBadRequest()
+	}
+
+	bookingOID, err := primitive.ObjectIDFromHex(event.Reference)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	filter := bson.M{
+		"_id":               bookingOID,
+		"payment.paymentID": event.PaymentID,
+	}
+
+	var update bson.M
+	switch event.Type {
+	case payment.EventPaymentCaptured:
+		update = bson.M{"$max": bson.M{"payment.captured": event.Amount}}
+	case payment.EventRefundSucceeded:
+		update = bson.M{"$max": bson.M{"payment.refunded": event.Amount}}
+	case payment.EventPaymentFailed:
+		return h.failBooking(c, filter)
+	default:
+		log.Println("ignoring payment webhook event:", event.Type)
+		return c.SendStatus(http.StatusOK)
+	}
+
+	if err := h.store.Booking.UpdateBooking(c.Context(), filter, update); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	return c.SendStatus(http.StatusOK)
+}
+
+// failBooking cancels the booking of a failed payment and gives back the promo code use
+// and the loyalty points it redeemed. Redelivered events find it canceled and change nothing.
+func (h *PaymentHandler) failBooking(c *fiber.Ctx, filter bson.M) error {
+	booking, err := h.store.Booking.GetBookingByID(c.Context(), filter["_id"].(primitive.ObjectID))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	notCanceled := bson.M{"canceled": bson.M{"$ne": true}}
+	for key, value := range filter {
+		notCanceled[key] = value
+	}
+	update := bson.M{"$set": bson.M{"status": types.BookingFailed, "canceled": true}}
+
+	if err := h.store.Booking.UpdateBooking(c.Context(), notCanceled, update); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		if booking.Payment == nil || booking.Payment.PaymentID != filter["payment.paymentID"] {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		// Canceled before, the promo code and the loyalty points were given back then
+		return c.SendStatus(http.StatusOK)
+	}
+
+	if !booking.PromoCodeID.IsZero() {
+		if err := h.store.PromoCode.ReleasePromoCode(c.Context(), booking.PromoCodeID, booking.UserID); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+	if booking.LoyaltyPoints > 0 {
+		if err := reverseLoyaltyPoints(c.Context(), h.store, booking, "Payment failed"); err != nil {
+			return err
+		}
+	}
+
+	return c.SendStatus(http.StatusOK)
+}
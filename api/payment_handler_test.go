@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPaymentWebhookSignature(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel   = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room    = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+		booking = fixtures.AddBooking(tdb.store, user.ID, room.ID, 2,
+			time.Now().AddDate(0, 0, 3).UTC(), time.Now().AddDate(0, 0, 5).UTC(), false)
+	)
+
+	set := bson.M{"$set": bson.M{"payment": types.BookingPayment{PaymentID: "pay_1", Authorized: 20000}}}
+	if err := tdb.store.Booking.UpdateBooking(context.Background(), bson.M{"_id": booking.ID}, set); err != nil {
+		t.Fatal(err)
+	}
+
+	event, _ := json.Marshal(payment.WebhookEvent{
+		Type:      payment.EventPaymentCaptured,
+		PaymentID: "pay_1",
+		Reference: booking.ID.Hex(),
+		Amount:    5000,
+	})
+
+	tests := []struct {
+		name           string
+		secret         string
+		signature      func(*payment.FakeProvider) string
+		expectedStatus int
+	}{
+		{
+			name:           "valid signature",
+			secret:         "secret",
+			signature:      func(p *payment.FakeProvider) string { return p.SignWebhook(event) },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "bad signature",
+			secret:         "secret",
+			signature:      func(*payment.FakeProvider) string { return payment.NewFakeProvider("other").SignWebhook(event) },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "empty secret",
+			secret:         "",
+			signature:      func(p *payment.FakeProvider) string { return p.SignWebhook(event) },
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				payments = payment.NewFakeProvider(tt.secret)
+
+				app            = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+				paymentHandler = NewPaymentHandler(tdb.store, payments)
+			)
+
+			app.Post("/webhook", paymentHandler.HandlePaymentWebhook)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(event))
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("X-Signature", tt.signature(payments))
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("expected http status code %d but got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	updated, err := tdb.store.Booking.GetBookingByID(context.Background(), booking.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Payment.Captured != 5000 {
+		t.Fatalf("expected 5000 captured but got %d", updated.Payment.Captured)
+	}
+}
+
+func TestPaymentWebhookFailedReleasesRedemptions(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+
+		promoCode = fixtures.AddPromoCode(tdb.store, types.CreatePromoCodeParams{
+			Code:           "summer10",
+			Type:           types.PromoPercentage,
+			Value:          1000,
+			MaxRedemptions: 1,
+		})
+
+		payments = payment.NewFakeProvider("secret")
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler    = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payments)
+		paymentHandler = NewPaymentHandler(tdb.store, payments)
+	)
+
+	earn := types.NewLoyaltyTransaction(user.ID, primitive.NilObjectID, types.LoyaltyEarn, 5000, "Welcome bonus")
+	if _, err := tdb.store.Loyalty.RecordTransaction(context.Background(), earn); err != nil {
+		t.Fatal(err)
+	}
+
+	app.Post("/webhook", paymentHandler.HandlePaymentWebhook)
+	route.Post("/room/:id/book", roomHandler.HandleBookRoom)
+
+	params := types.BookRoomParams{
+		FromDate:      time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:      time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons:    2,
+		PromoCode:     promoCode.Code,
+		PaymentToken:  payment.FakeTokenApproved,
+		LoyaltyPoints: 1500,
+	}
+	b, _ := json.Marshal(params)
+
+	req := httptest.NewRequest(http.MethodPost, "/room/"+room.ID.Hex()+"/book", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected http status code 201 but got %d", resp.StatusCode)
+	}
+
+	var booking types.Booking
+	if err := json.NewDecoder(resp.Body).Decode(&booking); err != nil {
+		t.Fatal(err)
+	}
+
+	event, _ := json.Marshal(payment.WebhookEvent{
+		Type:      payment.EventPaymentFailed,
+		PaymentID: booking.Payment.PaymentID,
+		Reference: booking.ID.Hex(),
+	})
+
+	// The event is delivered twice, the redemptions are given back once
+	for i := 0; i < 2; i++ {
+		req = httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(event))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Signature", payments.SignWebhook(event))
+
+		resp, err = app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+		}
+	}
+
+	failed, err := tdb.store.Booking.GetBookingByID(context.Background(), booking.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !failed.Canceled || failed.Status != types.BookingFailed {
+		t.Fatalf("expected a canceled failed booking but got canceled %t status %s", failed.Canceled, failed.Status)
+	}
+
+	released, err := tdb.store.PromoCode.GetPromoCodeByCode(context.Background(), promoCode.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if released.Redemptions != 0 {
+		t.Fatalf("expected 0 promo code redemptions but got %d", released.Redemptions)
+	}
+
+	refunded, err := tdb.store.User.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refunded.LoyaltyPoints != 5000 {
+		t.Fatalf("expected 5000 loyalty points but got %d", refunded.LoyaltyPoints)
+	}
+}
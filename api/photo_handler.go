@@ -0,0 +1,320 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/blob"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/photo"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"log"
+	"net/http"
+)
+
+// photoCacheControl lets clients and proxies cache photos forever,
+// a photo is never changed under the same key
+const photoCacheControl = "public, max-age=31536000, immutable"
+
+type PhotoHandler struct {
+	store *db.Store
+	blobs blob.BlobStore
+}
+
+func NewPhotoHandler(store *db.Store, blobs blob.BlobStore) *PhotoHandler {
+	return &PhotoHandler{
+		store: store,
+		blobs: blobs,
+	}
+}
+
+// photoOwner loads and updates the photos of a hotel or a room
+type photoOwner struct {
+	name      string
+	getPhotos func(context.Context, primitive.ObjectID) ([]types.Photo, error)
+	update    func(context.Context, bson.M, bson.M) error
+}
+
+func (h *PhotoHandler) hotelPhotos() photoOwner {
+	return photoOwner{
+		name: "hotels",
+		getPhotos: func(ctx context.Context, oid primitive.ObjectID) ([]types.Photo, error) {
+			hotel, err := h.store.Hotel.GetHotelByID(ctx, oid)
+			if err != nil {
+				return nil, err
+			}
+
+			return hotel.Photos, nil
+		},
+		update: h.store.Hotel.UpdateHotel,
+	}
+}
+
+func (h *PhotoHandler) roomPhotos() photoOwner {
+	return photoOwner{
+		name: "rooms",
+		getPhotos: func(ctx context.Context, oid primitive.ObjectID) ([]types.Photo, error) {
+			room, err := h.store.Room.GetRoomByID(ctx, oid)
+			if err != nil {
+				return nil, err
+			}
+
+			return room.Photos, nil
+		},
+		update: h.store.Room.UpdateRoom,
+	}
+}
+
+func (h *PhotoHandler) HandlePostHotelPhoto(c *fiber.Ctx) error {
+	return h.postPhoto(c, h.hotelPhotos())
+}
+
+func (h *PhotoHandler) HandlePostRoomPhoto(c *fiber.Ctx) error {
+	return h.postPhoto(c, h.roomPhotos())
+}
+
+func (h *PhotoHandler) HandleDeleteHotelPhoto(c *fiber.Ctx) error {
+	return h.deletePhoto(c, h.hotelPhotos())
+}
+
+func (h *PhotoHandler) HandleDeleteRoomPhoto(c *fiber.Ctx) error {
+	return h.deletePhoto(c, h.roomPhotos())
+}
+
+func (h *PhotoHandler) HandlePutHotelPhotoOrder(c *fiber.Ctx) error {
+	return h.reorderPhotos(c, h.hotelPhotos())
+}
+
+func (h *PhotoHandler) HandlePutRoomPhotoOrder(c *fiber.Ctx) error {
+	return h.reorderPhotos(c, h.roomPhotos())
+}
+
+// postPhoto stores the "photo" file of the multipart form with its thumbnail
+// and appends it to the photos of the owner
+func (h *PhotoHandler) postPhoto(c *fiber.Ctx, owner photoOwner) error {
+	oid, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	if _, err := owner.getPhotos(c.Context(), oid); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	fileHeader, err := c.FormFile("photo")
+	if err != nil {
+		return myErrors.NewError(http.StatusBadRequest, "photo file is required")
+	}
+	if fileHeader.Size > photo.MaxSize {
+		return myErrors.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("photo should be at most %d MB", photo.MaxSize>>20))
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, photo.MaxSize+1))
+	if err != nil {
+		return err
+	}
+
+	decoded, err := photo.Decode(data)
+	if err != nil {
+		if errors.Is(err, photo.ErrTooLarge) {
+			return myErrors.NewError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+
+		return myErrors.ErrValidation(fieldError("photo", err))
+	}
+
+	thumbnail, err := photo.EncodeJPEG(photo.Thumbnail(decoded.Image, photo.ThumbnailWidth))
+	if err != nil {
+		return err
+	}
+
+	newPhoto := types.NewPhoto(owner.name, oid, decoded.Ext, decoded.ContentType, decoded.Width, decoded.Height, int64(len(data)))
+
+	if err := h.blobs.Put(c.Context(), newPhoto.Key, bytes.NewReader(data), newPhoto.ContentType); err != nil {
+		return err
+	}
+	if err := h.blobs.Put(c.Context(), newPhoto.ThumbnailKey, bytes.NewReader(thumbnail), "image/jpeg"); err != nil {
+		h.deleteBlobs(c.Context(), newPhoto)
+		return err
+	}
+
+	filter := bson.M{"_id": oid}
+	update := bson.M{
+		"$push": bson.M{
+			"photos": newPhoto,
+		},
+	}
+	if err := owner.update(c.Context(), filter, update); err != nil {
+		h.deleteBlobs(c.Context(), newPhoto)
+		return err
+	}
+
+	return c.Status(http.StatusCreated).JSON(newPhoto)
+}
+
+func (h *PhotoHandler) deletePhoto(c *fiber.Ctx, owner photoOwner) error {
+	oid, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	photoOID, err := primitive.ObjectIDFromHex(c.Params("photoID"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	photos, err := owner.getPhotos(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	var deleted *types.Photo
+	for i := range photos {
+		if photos[i].ID == photoOID {
+			deleted = &photos[i]
+		}
+	}
+	if deleted == nil {
+		return myErrors.ErrResourceNotFound()
+	}
+
+	filter := db.MatchVersion(bson.M{"_id": oid}, versions...)
+	update := bson.M{
+		"$pull": bson.M{
+			"photos": bson.M{"_id": photoOID},
+		},
+	}
+	if err := owner.update(c.Context(), filter, update); err != nil {
+		return writeError(err)
+	}
+
+	h.deleteBlobs(c.Context(), deleted)
+
+	setWrittenETag(c, versions)
+
+	return c.JSON(map[string]string{
+		"deleted": photoOID.Hex(),
+	})
+}
+
+func (h *PhotoHandler) reorderPhotos(c *fiber.Ctx, owner photoOwner) error {
+	oid, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	var params types.ReorderPhotosParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	photos, err := owner.getPhotos(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	if err := params.Validate(photos); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	reordered := params.Reorder(photos)
+
+	// Photos added or removed in the meantime change the version, and the update only applies
+	// while the stored photos are the ones listed, so they fail the update instead of getting lost
+	filter := db.MatchVersion(bson.M{"_id": oid}, versions...)
+	if len(params.PhotoIDs) > 0 {
+		filter["photos"] = bson.M{"$size": len(params.PhotoIDs)}
+		filter["photos._id"] = bson.M{"$all": params.PhotoIDs}
+	} else {
+		filter["photos"] = bson.M{"$in": bson.A{nil, bson.A{}}}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"photos": reordered,
+		},
+	}
+	if err := owner.update(c.Context(), filter, update); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if _, err := owner.getPhotos(c.Context(), oid); err == nil {
+				return myErrors.ErrPreconditionFailed()
+			}
+		}
+
+		return writeError(err)
+	}
+
+	setWrittenETag(c, versions)
+
+	return c.JSON(reordered)
+}
+
+// HandleGetPhoto serves a photo or a thumbnail by its key
+func (h *PhotoHandler) HandleGetPhoto(c *fiber.Ctx) error {
+	key := c.Params("*")
+
+	etag := fmt.Sprintf("%q", key)
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		c.Set(fiber.HeaderETag, etag)
+		c.Set(fiber.HeaderCacheControl, photoCacheControl)
+		return c.SendStatus(http.StatusNotModified)
+	}
+
+	reader, info, err := h.blobs.Get(c.Context(), key)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) || errors.Is(err, blob.ErrInvalidKey) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, info.ContentType)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, photoCacheControl)
+	c.Set(fiber.HeaderLastModified, info.ModTime.UTC().Format(http.TimeFormat))
+
+	return c.SendStream(reader, int(info.Size))
+}
+
+func (h *PhotoHandler) deleteBlobs(ctx context.Context, p *types.Photo) {
+	for _, key := range []string{p.Key, p.ThumbnailKey} {
+		if err := h.blobs.Delete(ctx, key); err != nil && !errors.Is(err, blob.ErrNotFound) {
+			log.Println("failed to delete photo:", err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/blob"
+	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/types"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadHotelPhoto(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	blobs, err := blob.NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		photoHandler = NewPhotoHandler(tdb.store, blobs)
+	)
+
+	app.Get("/api/photo/*", photoHandler.HandleGetPhoto)
+	route.Post("/hotel/:id/photo", middleware.AdminAuth, photoHandler.HandlePostHotelPhoto)
+
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for x := 0; x < 640; x++ {
+		for y := 0; y < 480; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("photo", "lobby.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(part, img); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/hotel/"+hotel.ID.Hex()+"/photo", &body)
+	req.Header.Add("Content-Type", form.FormDataContentType())
+	req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected http status code 201 but got %d", resp.StatusCode)
+	}
+
+	var photo types.Photo
+	if err := json.NewDecoder(resp.Body).Decode(&photo); err != nil {
+		t.Fatal(err)
+	}
+
+	if photo.ContentType != "image/png" || photo.Width != 640 || photo.Height != 480 {
+		t.Fatalf("unexpected photo %s of %dx%d", photo.ContentType, photo.Width, photo.Height)
+	}
+
+	updatedHotel, err := tdb.store.Hotel.GetHotelByID(context.Background(), hotel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(updatedHotel.Photos) != 1 || updatedHotel.Photos[0].ID != photo.ID {
+		t.Fatal("expected the photo to be added to the hotel")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, photo.ThumbnailURL, nil)
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	thumbnail, _, err := image.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if thumbnail.Bounds().Dx() != 320 || thumbnail.Bounds().Dy() != 240 {
+		t.Fatalf("expected a 320x240 thumbnail but got %v", thumbnail.Bounds())
+	}
+	if !strings.Contains(resp.Header.Get("Cache-Control"), "max-age") {
+		t.Fatal("expected the photo to be cacheable")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, photo.ThumbnailURL, nil)
+	req.Header.Add("If-None-Match", resp.Header.Get("ETag"))
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected http status code 304 but got %d", resp.StatusCode)
+	}
+}
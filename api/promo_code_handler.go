@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+)
+
+type PromoCodeHandler struct {
+	promoCodeStore db.PromoCodeStore
+}
+
+func NewPromoCodeHandler(promoCodeStore db.PromoCodeStore) *PromoCodeHandler {
+	return &PromoCodeHandler{
+		promoCodeStore: promoCodeStore,
+	}
+}
+
+func (h *PromoCodeHandler) HandlePostPromoCode(c *fiber.Ctx) error {
+	var params types.CreatePromoCodeParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	promoCode := types.NewPromoCodeFromParams(params)
+
+	// The unique index on code rejects codes that exist, even when created concurrently
+	insertedPromoCode, err := h.promoCodeStore.InsertPromoCode(c.Context(), promoCode)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return myErrors.NewError(http.StatusConflict, fmt.Sprintf("Promo code %s already exists", promoCode.Code))
+		}
+
+		return err
+	}
+
+	return c.Status(http.StatusCreated).JSON(insertedPromoCode)
+}
+
+func (h *PromoCodeHandler) HandleGetPromoCodes(c *fiber.Ctx) error {
+	var promoCodeQueryParams db.PromoCodeQueryParams
+	if err := parseQuery(c, &promoCodeQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&promoCodeQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	promoCodes, err := h.promoCodeStore.GetPromoCodes(c.Context(), &promoCodeQueryParams, &promoCodeQueryParams.Pagination)
+	if err != nil {
+		return listError(err)
+	}
+
+	response := newPageResponse(c, promoCodes, len(promoCodes), &promoCodeQueryParams.Pagination)
+
+	return c.JSON(response)
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"time"
+)
+
+// maxStayRestrictions is the page size the restrictions of a stay are read in
+const maxStayRestrictions = 100
+
+type RestrictionHandler struct {
+	store *db.Store
+}
+
+func NewRestrictionHandler(store *db.Store) *RestrictionHandler {
+	return &RestrictionHandler{
+		store: store,
+	}
+}
+
+func (h *RestrictionHandler) HandlePostRestriction(c *fiber.Ctx) error {
+	hotelOID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	var params types.CreateRestrictionParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	if _, err := h.store.Hotel.GetHotelByID(c.Context(), hotelOID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	if !params.RoomID.IsZero() {
+		room, err := h.store.Room.GetRoomByID(c.Context(), params.RoomID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return myErrors.ErrResourceNotFound()
+			}
+
+			return err
+		}
+		if room.HotelID != hotelOID {
+			return myErrors.NewError(http.StatusBadRequest, "Room does not belong to the hotel")
+		}
+	}
+
+	restriction := types.NewRestrictionFromParams(hotelOID, params)
+
+	insertedRestriction, err := h.store.Restriction.InsertRestriction(c.Context(), restriction)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(http.StatusCreated).JSON(insertedRestriction)
+}
+
+func (h *RestrictionHandler) HandleGetRestrictions(c *fiber.Ctx) error {
+	hotelOID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	var restrictionQueryParams db.RestrictionQueryParams
+	if err := parseQuery(c, &restrictionQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&restrictionQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	if _, err := h.store.Hotel.GetHotelByID(c.Context(), hotelOID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	restrictionQueryParams.HotelID = hotelOID
+
+	restrictions, err := h.store.Restriction.GetRestrictions(c.Context(), &restrictionQueryParams, &restrictionQueryParams.Pagination)
+	if err != nil {
+		return listError(err)
+	}
+
+	response := newPageResponse(c, restrictions, len(restrictions), &restrictionQueryParams.Pagination)
+
+	return c.JSON(response)
+}
+
+func (h *RestrictionHandler) HandleDeleteRestriction(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Restriction.DeleteRestriction(c.Context(), oid, versions...); err != nil {
+		return writeError(err)
+	}
+
+	return c.JSON(map[string]string{
+		"deleted": id,
+	})
+}
+
+// RestrictedForStay returns the hotels and rooms restrictions don't allow the stay at,
+// of the hotel only unless hotelID is nil
+func RestrictedForStay(ctx context.Context, restrictionStore db.RestrictionStore, hotelID primitive.ObjectID, fromDate, tillDate time.Time) ([]primitive.ObjectID, []primitive.ObjectID, error) {
+	restrictions, err := stayRestrictions(ctx, restrictionStore, db.RestrictionQueryParams{
+		HotelID:  hotelID,
+		FromDate: fromDate,
+		TillDate: tillDate,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		hotelIDs = []primitive.ObjectID{}
+		roomIDs  = []primitive.ObjectID{}
+		now      = time.Now()
+	)
+
+	for _, restriction := range restrictions {
+		if restriction.Check(fromDate, tillDate, now) == nil {
+			continue
+		}
+
+		if restriction.RoomID.IsZero() {
+			hotelIDs = append(hotelIDs, restriction.HotelID)
+		} else {
+			roomIDs = append(roomIDs, restriction.RoomID)
+		}
+	}
+
+	return hotelIDs, roomIDs, nil
+}
+
+// CheckStayRestrictions returns an error explaining which restriction of the
+// hotel (or the room, if roomID is not nil) blocks the stay, or nil if the stay can be booked.
+func CheckStayRestrictions(ctx context.Context, restrictionStore db.RestrictionStore, hotelID, roomID primitive.ObjectID, fromDate, tillDate time.Time) error {
+	restrictions, err := stayRestrictions(ctx, restrictionStore, db.RestrictionQueryParams{
+		HotelID:  hotelID,
+		RoomID:   roomID,
+		FromDate: fromDate,
+		TillDate: tillDate,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Room restrictions don't apply to bookings without a room
+	if roomID.IsZero() {
+		hotelRestrictions := make([]*types.Restriction, 0, len(restrictions))
+		for _, restriction := range restrictions {
+			if restriction.RoomID.IsZero() {
+				hotelRestrictions = append(hotelRestrictions, restriction)
+			}
+		}
+		restrictions = hotelRestrictions
+	}
+
+	return refusedStay(restrictions, fromDate, tillDate, time.Now())
+}
+
+// checkRoomRestrictions checks the restrictions of the room assigned to the booking, as of when
+// the stay was booked. The restrictions of the hotel were checked when the stay was booked already.
+func checkRoomRestrictions(ctx context.Context, restrictionStore db.RestrictionStore, room *types.Room, booking *types.Booking) error {
+	restrictions, err := stayRestrictions(ctx, restrictionStore, db.RestrictionQueryParams{
+		HotelID:  room.HotelID,
+		RoomID:   room.ID,
+		FromDate: booking.FromDate,
+		TillDate: booking.TillDate,
+	})
+	if err != nil {
+		return err
+	}
+
+	roomRestrictions := make([]*types.Restriction, 0, len(restrictions))
+	for _, restriction := range restrictions {
+		if restriction.RoomID == room.ID {
+			roomRestrictions = append(roomRestrictions, restriction)
+		}
+	}
+
+	return refusedStay(roomRestrictions, booking.FromDate, booking.TillDate, booking.ID.Timestamp())
+}
+
+// refusedStay explains why the first restriction refusing the stay booked at bookedAt does so
+func refusedStay(restrictions []*types.Restriction, fromDate, tillDate, bookedAt time.Time) error {
+	for _, restriction := range restrictions {
+		if err := restriction.Check(fromDate, tillDate, bookedAt); err != nil {
+			return myErrors.ErrValidation(fieldError("fromDate", err))
+		}
+	}
+
+	return nil
+}
+
+// stayRestrictions reads every restriction that can refuse the stay, page by page
+func stayRestrictions(ctx context.Context, restrictionStore db.RestrictionStore, restrictionQueryParams db.RestrictionQueryParams) ([]*types.Restriction, error) {
+	restrictionQueryParams.Stay = true
+	restrictionQueryParams.Pagination = db.Pagination{
+		Limit: maxStayRestrictions,
+	}
+
+	var restrictions []*types.Restriction
+	for {
+		page, err := restrictionStore.GetRestrictions(ctx, &restrictionQueryParams, &restrictionQueryParams.Pagination)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, page...)
+
+		if !restrictionQueryParams.Pagination.HasMore {
+			return restrictions, nil
+		}
+		restrictionQueryParams.Pagination.Cursor = restrictionQueryParams.Pagination.NextCursor
+	}
+}
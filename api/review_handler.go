@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"math"
+	"net/http"
+	"time"
+)
+
+type ReviewHandler struct {
+	store *db.Store
+}
+
+func NewReviewHandler(store *db.Store) *ReviewHandler {
+	return &ReviewHandler{
+		store: store,
+	}
+}
+
+// HandlePostReview submits a review of a checked out stay for moderation
+func (h *ReviewHandler) HandlePostReview(c *fiber.Ctx) error {
+	var params types.CreateReviewParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	booking, err := h.store.Booking.GetBookingByID(c.Context(), params.BookingID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	user, ok := getAuthUser(c)
+	if !ok {
+		return myErrors.ErrUnauthorized()
+	}
+	if booking.UserID != user.ID {
+		return myErrors.ErrForbidden()
+	}
+
+	if !booking.CheckedOut || booking.Canceled {
+		return myErrors.NewError(http.StatusBadRequest, "Only completed stays can be reviewed")
+	}
+
+	reviewQueryParams := db.ReviewQueryParams{
+		BookingID: booking.ID,
+	}
+	reviews, err := h.store.Review.GetReviews(c.Context(), &reviewQueryParams, &reviewQueryParams.Pagination)
+	if err != nil {
+		return err
+	}
+	if len(reviews) > 0 {
+		return errAlreadyReviewed()
+	}
+
+	hotelID := booking.HotelID
+	if hotelID.IsZero() {
+		room, err := h.store.Room.GetRoomByID(c.Context(), booking.RoomID)
+		if err != nil {
+			return err
+		}
+		hotelID = room.HotelID
+	}
+
+	review, err := h.store.Review.InsertReview(c.Context(), types.NewReviewFromParams(hotelID, booking, params))
+	if err != nil {
+		// The unique index on bookingID catches reviews posted at the same time
+		if mongo.IsDuplicateKeyError(err) {
+			return errAlreadyReviewed()
+		}
+
+		return err
+	}
+
+	return c.Status(http.StatusCreated).JSON(review)
+}
+
+func errAlreadyReviewed() myErrors.Error {
+	return myErrors.NewError(http.StatusConflict, "The stay is already reviewed")
+}
+
+// HandleGetHotelReviews returns the approved reviews of the hotel
+func (h *ReviewHandler) HandleGetHotelReviews(c *fiber.Ctx) error {
+	hotelOID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	var reviewQueryParams db.ReviewQueryParams
+	if err := parseQuery(c, &reviewQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&reviewQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	if _, err := h.store.Hotel.GetHotelByID(c.Context(), hotelOID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	reviewQueryParams.HotelID = hotelOID
+	reviewQueryParams.Status = types.ReviewApproved
+	reviewQueryParams.UserID = primitive.NilObjectID
+
+	return h.getReviews(c, &reviewQueryParams)
+}
+
+// HandleGetReviews lists reviews of any status for moderation
+func (h *ReviewHandler) HandleGetReviews(c *fiber.Ctx) error {
+	var reviewQueryParams db.ReviewQueryParams
+	if err := parseQuery(c, &reviewQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&reviewQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	return h.getReviews(c, &reviewQueryParams)
+}
+
+func (h *ReviewHandler) getReviews(c *fiber.Ctx, reviewQueryParams *db.ReviewQueryParams) error {
+	reviews, err := h.store.Review.GetReviews(c.Context(), reviewQueryParams, &reviewQueryParams.Pagination)
+	if err != nil {
+		return listError(err)
+	}
+
+	response := newPageResponse(c, reviews, len(reviews), &reviewQueryParams.Pagination)
+
+	return c.JSON(response)
+}
+
+// HandlePutReviewModeration approves or rejects a review and recomputes the rating of the hotel
+func (h *ReviewHandler) HandlePutReviewModeration(c *fiber.Ctx) error {
+	oid, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	var params types.ModerateReviewParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	review, err := h.store.Review.GetReviewByID(c.Context(), oid)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	if !versionMatches(versions, review.Version) {
+		return myErrors.ErrPreconditionFailed()
+	}
+
+	review.Status = params.Status
+	review.ModerationNote = params.Note
+	moderatedAt := time.Now().UTC()
+	review.ModeratedAt = &moderatedAt
+
+	filter := db.MatchVersion(bson.M{"_id": review.ID}, review.Version)
+	update := bson.M{
+		"$set": bson.M{
+			"status":         review.Status,
+			"moderationNote": review.ModerationNote,
+			"moderatedAt":    review.ModeratedAt,
+		},
+	}
+	if err := h.store.Review.UpdateReview(c.Context(), filter, update); err != nil {
+		return writeError(err)
+	}
+
+	review.Version++
+	c.Set(fiber.HeaderETag, versionETag(review.Version))
+
+	if err := updateHotelRating(c.Context(), h.store, review.HotelID); err != nil {
+		return err
+	}
+
+	return c.JSON(review)
+}
+
+// updateHotelRating stores the review scores of the hotel rounded to one decimal
+func updateHotelRating(ctx context.Context, store *db.Store, hotelID primitive.ObjectID) error {
+	stats, err := store.Review.GetReviewStats(ctx, hotelID)
+	if err != nil {
+		return err
+	}
+
+	round := func(score float64) float64 {
+		return math.Round(score*10) / 10
+	}
+
+	categoryScores := make(map[string]float64, len(stats.CategoryScores))
+	for category, score := range stats.CategoryScores {
+		categoryScores[category] = round(score)
+	}
+
+	filter := bson.M{"_id": hotelID}
+	update := bson.M{
+		"$set": bson.M{
+			"reviewScore":    round(stats.Score),
+			"reviewCount":    stats.Count,
+			"categoryScores": categoryScores,
+		},
+	}
+
+	return store.Hotel.UpdateHotel(ctx, filter, update)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestApprovedReviewUpdatesHotelRating(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel      = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		otherHotel = fixtures.AddHotel(tdb.store, "otherHotel", "Testestan", nil, 4)
+		room       = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
+		booking    = fixtures.AddBooking(tdb.store, user.ID, room.ID, 2,
+			time.Now().AddDate(0, 0, -3).UTC(), time.Now().UTC(), false)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		reviewHandler = NewReviewHandler(tdb.store)
+		hotelHandler  = NewHotelHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil))
+	)
+
+	// The booking has no hotelID, like the bookings of a room made before they had one
+	filter := bson.M{"_id": booking.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"checkedOut": true,
+		},
+	}
+	if err := tdb.store.Booking.UpdateBooking(context.Background(), filter, update); err != nil {
+		t.Fatal(err)
+	}
+
+	route.Post("/review", reviewHandler.HandlePostReview)
+	route.Put("/review/:id/moderation", middleware.AdminAuth, reviewHandler.HandlePutReviewModeration)
+	route.Get("/hotel", hotelHandler.HandleGetHotels)
+
+	params := types.CreateReviewParams{
+		BookingID: booking.ID,
+		Scores: map[string]int{
+			"cleanliness": 5,
+			"service":     4,
+		},
+		Text: "Lovely stay",
+	}
+	b, _ := json.Marshal(params)
+
+	req := httptest.NewRequest(http.MethodPost, "/review", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected http status code 201 but got %d", resp.StatusCode)
+	}
+
+	var review types.Review
+	if err := json.NewDecoder(resp.Body).Decode(&review); err != nil {
+		t.Fatal(err)
+	}
+
+	if review.Status != types.ReviewPending {
+		t.Fatalf("expected review status %s but got %s", types.ReviewPending, review.Status)
+	}
+
+	b, _ = json.Marshal(types.ModerateReviewParams{Status: types.ReviewApproved})
+	req = httptest.NewRequest(http.MethodPut, "/review/"+review.ID.Hex()+"/moderation", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("If-Match", versionETag(review.Version))
+	req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	updatedHotel, err := tdb.store.Hotel.GetHotelByID(context.Background(), hotel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updatedHotel.ReviewScore != 4.5 || updatedHotel.ReviewCount != 1 {
+		t.Fatalf("expected review score 4.5 of 1 review but got %v of %d", updatedHotel.ReviewScore, updatedHotel.ReviewCount)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/hotel?minReviewScore=4&sortByReviewScore=true", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response struct {
+		Results int            `json:"results"`
+		Data    []*types.Hotel `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Results != 1 || response.Data[0].ID != hotel.ID {
+		t.Fatalf("expected only the reviewed hotel, not %s", otherHotel.ID.Hex())
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+)
+
+type RoomBlockHandler struct {
+	store *db.Store
+}
+
+func NewRoomBlockHandler(store *db.Store) *RoomBlockHandler {
+	return &RoomBlockHandler{
+		store: store,
+	}
+}
+
+type roomBlockResponse struct {
+	Block    *types.RoomBlock `json:"block"`
+	Warnings []string         `json:"warnings"`
+}
+
+func (h *RoomBlockHandler) HandlePostRoomBlock(c *fiber.Ctx) error {
+	roomOID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	var params types.CreateRoomBlockParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	user, ok := getAuthUser(c)
+	if !ok {
+		return myErrors.ErrUnauthorized()
+	}
+
+	room, err := h.store.Room.GetRoomByID(c.Context(), roomOID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	// Guest bookings are kept, but the admin is warned about them
+	canceled := false
+	bookingQueryParams := db.BookingQueryParams{
+		RoomID:   room.ID,
+		FromDate: params.FromDate,
+		TillDate: params.TillDate,
+		Canceled: &canceled,
+	}
+
+	bookings, err := h.store.Booking.GetBookings(c.Context(), &bookingQueryParams, &bookingQueryParams.Pagination)
+	if err != nil {
+		return err
+	}
+
+	warnings := []string{}
+	for _, booking := range bookings {
+		warnings = append(warnings, fmt.Sprintf("Block overlaps booking %s (%s - %s)", booking.ID.Hex(),
+			booking.FromDate.Format(types.DateLayout), booking.TillDate.Format(types.DateLayout)))
+	}
+
+	block := types.NewRoomBlockFromParams(room, user.ID, params)
+
+	insertedBlock, err := h.store.RoomBlock.InsertRoomBlock(c.Context(), block)
+	if err != nil {
+		return err
+	}
+
+	response := &roomBlockResponse{
+		Block:    insertedBlock,
+		Warnings: warnings,
+	}
+
+	return c.Status(http.StatusCreated).JSON(response)
+}
+
+func (h *RoomBlockHandler) HandleGetRoomBlocks(c *fiber.Ctx) error {
+	var roomBlockQueryParams db.RoomBlockQueryParams
+	if err := parseQuery(c, &roomBlockQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&roomBlockQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	blocks, err := h.store.RoomBlock.GetRoomBlocks(c.Context(), &roomBlockQueryParams, &roomBlockQueryParams.Pagination)
+	if err != nil {
+		return listError(err)
+	}
+
+	response := newPageResponse(c, blocks, len(blocks), &roomBlockQueryParams.Pagination)
+
+	return c.JSON(response)
+}
+
+func (h *RoomBlockHandler) HandleDeleteRoomBlock(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.RoomBlock.DeleteRoomBlock(c.Context(), oid, versions...); err != nil {
+		return writeError(err)
+	}
+
+	return c.JSON(map[string]string{
+		"deleted": id,
+	})
+}
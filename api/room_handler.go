@@ -6,55 +6,116 @@ import (
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/currency"
 	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/payment"
 	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"log"
 	"net/http"
+	"time"
 )
 
+// maxOverlappingBookings is the number of bookings, rooms and blocks
+// loaded to compute the availability of a room type
+const maxOverlappingBookings = 1000
+
 type RoomHandler struct {
-	store *db.Store
+	store    *db.Store
+	rates    currency.RateProvider
+	payments payment.PaymentProvider
 }
 
-func NewRoomHandler(store *db.Store) *RoomHandler {
+func NewRoomHandler(store *db.Store, rates currency.RateProvider, payments payment.PaymentProvider) *RoomHandler {
 	return &RoomHandler{
-		store: store,
+		store:    store,
+		rates:    rates,
+		payments: payments,
 	}
 }
 
 func (h *RoomHandler) HandleGetRooms(c *fiber.Ctx) error {
 	var roomQueryParams db.RoomQueryParams
-	if err := c.QueryParser(&roomQueryParams); err != nil {
-		return myErrors.ErrBadRequest()
+	if err := parseQuery(c, &roomQueryParams); err != nil {
+		return err
+	}
+
+	if err := checkPagination(&roomQueryParams.Pagination); err != nil {
+		return err
+	}
+
+	// Rooms restrictions don't allow the stay at are left out by the store, like occupied rooms
+	if !roomQueryParams.FromDate.IsZero() && !roomQueryParams.TillDate.IsZero() {
+		hotelIDs, roomIDs, err := RestrictedForStay(c.Context(), h.store.Restriction, roomQueryParams.HotelID, roomQueryParams.FromDate, roomQueryParams.TillDate)
+		if err != nil {
+			return err
+		}
+		roomQueryParams.ExcludedHotelIDs = hotelIDs
+		roomQueryParams.ExcludedRoomIDs = roomIDs
 	}
 
 	rooms, err := h.store.Room.GetRooms(c.Context(), &roomQueryParams, &roomQueryParams.Pagination)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return myErrors.ErrResourceNotFound()
-		}
+		return listError(err)
+	}
 
+	if err := setDisplayPrices(c.Context(), h.store.Hotel, h.rates, rooms, c.Query("currency")); err != nil {
 		return err
 	}
 
-	response := &resourceResponse{
-		Results: len(rooms),
-		Page:    roomQueryParams.Page,
-		Data:    rooms,
-	}
+	response := newPageResponse(c, rooms, len(rooms), &roomQueryParams.Pagination)
 
 	return c.JSON(response)
 }
 
+func (h *RoomHandler) HandlePutRoom(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	var params types.UpdateRoomParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	filter := db.MatchVersion(bson.M{"_id": oid}, versions...)
+	update := bson.M{
+		"$set": params.ToBSON(),
+	}
+
+	if err := h.store.Room.UpdateRoom(c.Context(), filter, update); err != nil {
+		return writeError(err)
+	}
+
+	setWrittenETag(c, versions)
+
+	return c.JSON(map[string]string{
+		"updated": id,
+	})
+}
+
 func (h *RoomHandler) HandleBookRoom(c *fiber.Ctx) error {
 	var params types.BookRoomParams
-	if err := c.BodyParser(&params); err != nil {
-		return myErrors.ErrBadRequest()
+	if err := parseBody(c, &params); err != nil {
+		return err
 	}
 
 	if err := params.Validate(); err != nil {
-		return myErrors.NewError(http.StatusBadRequest, err.Error())
+		return myErrors.ErrValidation(err)
 	}
 
 	roomID := c.Params("id")
@@ -68,7 +129,20 @@ func (h *RoomHandler) HandleBookRoom(c *fiber.Ctx) error {
 		return myErrors.ErrUnauthorized()
 	}
 
-	available, err := IsRoomAvailableForBooking(c.Context(), h.store.Booking, roomOID, params)
+	room, err := h.store.Room.GetRoomByID(c.Context(), roomOID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	if err := CheckStayRestrictions(c.Context(), h.store.Restriction, room.HotelID, room.ID, params.FromDate, params.TillDate); err != nil {
+		return err
+	}
+
+	available, err := IsRoomAvailableForBooking(c.Context(), h.store, roomOID, params)
 	if err != nil {
 		return err
 	}
@@ -76,15 +150,35 @@ func (h *RoomHandler) HandleBookRoom(c *fiber.Ctx) error {
 		return myErrors.NewError(http.StatusBadRequest, fmt.Sprintf("Room %s is already booked", roomID))
 	}
 
+	hotel, err := h.store.Hotel.GetHotelByID(c.Context(), room.HotelID)
+	if err != nil {
+		return err
+	}
+
+	// Rooms sold as a room type share its inventory with unassigned bookings
+	if !room.RoomTypeID.IsZero() {
+		if roomType, ok := hotel.RoomType(room.RoomTypeID); ok {
+			available, err := IsRoomTypeAvailableForBooking(c.Context(), h.store, hotel.ID, roomType, params)
+			if err != nil {
+				return err
+			}
+			if !available {
+				return myErrors.NewError(http.StatusBadRequest, fmt.Sprintf("Room %s is already booked", roomID))
+			}
+		}
+	}
+
 	booking := &types.Booking{
 		UserID:     user.ID,
+		HotelID:    room.HotelID,
+		RoomTypeID: room.RoomTypeID,
 		RoomID:     roomOID,
 		NumPersons: params.NumPersons,
 		FromDate:   params.FromDate,
 		TillDate:   params.TillDate,
 	}
 
-	insertedBooking, err := h.store.Booking.InsertBooking(c.Context(), booking)
+	insertedBooking, err := h.insertBooking(c.Context(), hotel, booking, room.Price, params)
 	if err != nil {
 		return err
 	}
@@ -92,7 +186,355 @@ func (h *RoomHandler) HandleBookRoom(c *fiber.Ctx) error {
 	return c.Status(http.StatusCreated).JSON(insertedBooking)
 }
 
-func IsRoomAvailableForBooking(ctx context.Context, bookingStore db.BookingStore, roomID primitive.ObjectID, params types.BookRoomParams) (bool, error) {
+type quoteResponse struct {
+	*types.PriceBreakdown
+	DisplayTotal *types.Money `json:"displayTotal,omitempty"`
+}
+
+// HandleGetQuote prices a stay in the room without booking it
+func (h *RoomHandler) HandleGetQuote(c *fiber.Ctx) error {
+	var params types.BookRoomParams
+	if err := parseQuery(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	roomOID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	room, err := h.store.Room.GetRoomByID(c.Context(), roomOID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	hotel, err := h.store.Hotel.GetHotelByID(c.Context(), room.HotelID)
+	if err != nil {
+		return err
+	}
+
+	response := &quoteResponse{
+		PriceBreakdown: types.NewPriceBreakdown(hotel, room.Price, types.Nights(params.FromDate, params.TillDate), params.NumPersons),
+	}
+
+	if to := c.Query("currency"); len(to) > 0 {
+		total := types.Money{Amount: response.Total, Currency: response.Currency}
+
+		displayTotal, err := currency.Convert(c.Context(), h.rates, total, to)
+		if err != nil {
+			return invalidQuery(fieldError("currency", err))
+		}
+
+		response.DisplayTotal = &displayTotal
+	}
+
+	return c.JSON(response)
+}
+
+func (h *RoomHandler) HandleBookRoomType(c *fiber.Ctx) error {
+	var params types.BookRoomParams
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	hotelOID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	roomTypeID := c.Params("typeID")
+	roomTypeOID, err := primitive.ObjectIDFromHex(roomTypeID)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	user, ok := getAuthUser(c)
+	if !ok {
+		return myErrors.ErrUnauthorized()
+	}
+
+	hotel, err := h.store.Hotel.GetHotelByID(c.Context(), hotelOID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return myErrors.ErrResourceNotFound()
+		}
+
+		return err
+	}
+
+	roomType, ok := hotel.RoomType(roomTypeOID)
+	if !ok {
+		return myErrors.ErrResourceNotFound()
+	}
+
+	if err := CheckStayRestrictions(c.Context(), h.store.Restriction, hotel.ID, primitive.NilObjectID, params.FromDate, params.TillDate); err != nil {
+		return err
+	}
+
+	available, err := IsRoomTypeAvailableForBooking(c.Context(), h.store, hotel.ID, roomType, params)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return myErrors.NewError(http.StatusBadRequest, fmt.Sprintf("Room type %s is sold out", roomTypeID))
+	}
+
+	booking := &types.Booking{
+		UserID:     user.ID,
+		HotelID:    hotel.ID,
+		RoomTypeID: roomType.ID,
+		NumPersons: params.NumPersons,
+		FromDate:   params.FromDate,
+		TillDate:   params.TillDate,
+	}
+
+	insertedBooking, err := h.insertBooking(c.Context(), hotel, booking, roomType.Price, params)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(http.StatusCreated).JSON(insertedBooking)
+}
+
+// insertBooking prices the booking, applies the promo code, stores the booking as pending
+// and confirms it once the payment is authorized and the deposit is captured.
+// The promo code redemption is given back if the booking does not go through.
+func (h *RoomHandler) insertBooking(ctx context.Context, hotel *types.Hotel, booking *types.Booking, nightPrice int64, params types.BookRoomParams) (*types.Booking, error) {
+	var (
+		nights    = types.Nights(params.FromDate, params.TillDate)
+		discounts = []types.PriceLine{}
+		promoCode *types.PromoCode
+		err       error
+	)
+
+	if len(params.PromoCode) > 0 {
+		promoCode, err = h.store.PromoCode.GetPromoCodeByCode(ctx, types.NormalizePromoCode(params.PromoCode))
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, myErrors.NewError(http.StatusBadRequest, fmt.Sprintf("Promo code %s is not valid", params.PromoCode))
+			}
+
+			return nil, err
+		}
+
+		if err := promoCode.Check(hotel, params.FromDate, params.TillDate, time.Now()); err != nil {
+			return nil, myErrors.ErrValidation(fieldError("promoCode", err))
+		}
+
+		discounts = append(discounts, promoCode.Discount(nightPrice*int64(nights)))
+		booking.PromoCodeID = promoCode.ID
+	}
+
+	if params.LoyaltyPoints > 0 {
+		discount, err := h.loyaltyDiscount(ctx, hotel, params.LoyaltyPoints, nightPrice*int64(nights), discounts)
+		if err != nil {
+			return nil, err
+		}
+
+		discounts = append(discounts, discount)
+		booking.LoyaltyPoints = params.LoyaltyPoints
+	}
+
+	booking.Price = types.NewPriceBreakdown(hotel, nightPrice, nights, params.NumPersons, discounts...)
+	booking.Status = types.BookingPending
+
+	if booking.Price.Total > 0 && len(params.PaymentToken) == 0 {
+		ve := &types.ValidationError{}
+		ve.Add("paymentToken", types.ViolationRequired, "paymentToken is required")
+
+		return nil, myErrors.ErrValidation(ve)
+	}
+
+	if promoCode != nil {
+		if err := h.store.PromoCode.RedeemPromoCode(ctx, promoCode, booking.UserID); err != nil {
+			if errors.Is(err, db.ErrPromoCodeLimitReached) {
+				return nil, myErrors.NewError(http.StatusBadRequest, fmt.Sprintf("Promo code %s is no longer available", promoCode.Code))
+			}
+
+			return nil, err
+		}
+	}
+
+	// The ledger refers to the booking, so its ID is known before it's inserted
+	booking.ID = primitive.NewObjectID()
+
+	if booking.LoyaltyPoints > 0 {
+		transaction := types.NewLoyaltyTransaction(booking.UserID, booking.ID, types.LoyaltyBurn, -booking.LoyaltyPoints, "Redeemed for booking")
+		if _, err := h.store.Loyalty.RecordTransaction(ctx, transaction); err != nil {
+			h.releasePromoCode(ctx, booking)
+
+			if errors.Is(err, db.ErrInsufficientLoyaltyPoints) {
+				return nil, myErrors.NewError(http.StatusBadRequest, "Not enough loyalty points")
+			}
+
+			return nil, err
+		}
+	}
+
+	insertedBooking, err := h.store.Booking.InsertBooking(ctx, booking)
+	if err != nil {
+		h.releaseRedemptions(ctx, booking)
+		return nil, err
+	}
+
+	if booking.Price.Total == 0 {
+		filter := bson.M{"_id": insertedBooking.ID}
+		update := bson.M{
+			"$set": bson.M{
+				"status": types.BookingConfirmed,
+			},
+		}
+		if err := h.store.Booking.UpdateBooking(ctx, filter, update); err != nil {
+			return nil, err
+		}
+
+		insertedBooking.Status = types.BookingConfirmed
+		h.openFolio(ctx, insertedBooking)
+
+		return insertedBooking, nil
+	}
+
+	bookingPayment, err := h.authorizePayment(ctx, hotel, insertedBooking, params.PaymentToken)
+	if err != nil {
+		h.releaseRedemptions(ctx, insertedBooking)
+
+		// Failed bookings are canceled so that they don't hold the room
+		filter := bson.M{"_id": insertedBooking.ID}
+		update := bson.M{
+			"$set": bson.M{
+				"status":   types.BookingFailed,
+				"canceled": true,
+			},
+		}
+		if err := h.store.Booking.UpdateBooking(ctx, filter, update); err != nil {
+			log.Println("failed to mark booking as failed:", err)
+		}
+
+		if errors.Is(err, payment.ErrDeclined) {
+			return nil, myErrors.NewError(http.StatusPaymentRequired, "Payment was declined")
+		}
+
+		return nil, err
+	}
+
+	insertedBooking.Payment = bookingPayment
+
+	filter := bson.M{"_id": insertedBooking.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"status":  types.BookingConfirmed,
+			"payment": bookingPayment,
+		},
+	}
+	if err := h.store.Booking.UpdateBooking(ctx, filter, update); err != nil {
+		return nil, err
+	}
+
+	insertedBooking.Status = types.BookingConfirmed
+	h.openFolio(ctx, insertedBooking)
+
+	return insertedBooking, nil
+}
+
+// authorizePayment authorizes the booking total and captures the deposit required by the hotel
+func (h *RoomHandler) authorizePayment(ctx context.Context, hotel *types.Hotel, booking *types.Booking, token string) (*types.BookingPayment, error) {
+	authorization, err := h.payments.Authorize(ctx, payment.AuthorizeRequest{
+		Amount: types.Money{
+			Amount:   booking.Price.Total,
+			Currency: booking.Price.Currency,
+		},
+		Token:     token,
+		Reference: booking.ID.Hex(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bookingPayment := &types.BookingPayment{
+		PaymentID:  authorization.PaymentID,
+		Currency:   authorization.Amount.Currency,
+		Authorized: authorization.Amount.Amount,
+	}
+
+	if deposit := hotel.PaymentPolicy.Deposit(booking.Price.Total); deposit > 0 {
+		if err := h.payments.Capture(ctx, authorization.PaymentID, deposit); err != nil {
+			return nil, err
+		}
+
+		bookingPayment.Captured = deposit
+	}
+
+	return bookingPayment, nil
+}
+
+// openFolio posts the confirmed booking to a new folio. The booking stays confirmed if
+// that fails, the folio is opened again when it's first needed.
+func (h *RoomHandler) openFolio(ctx context.Context, booking *types.Booking) {
+	if _, err := h.store.Folio.InsertFolio(ctx, types.NewFolioFromBooking(booking)); err != nil {
+		log.Println("failed to open folio:", err)
+	}
+}
+
+// loyaltyDiscount returns the discount the points are worth in the currency of the hotel,
+// points can't be redeemed for more than the room total left after other discounts
+func (h *RoomHandler) loyaltyDiscount(ctx context.Context, hotel *types.Hotel, points, roomTotal int64, discounts []types.PriceLine) (types.PriceLine, error) {
+	value, err := currency.Convert(ctx, h.rates, types.Money{
+		Amount:   points * types.LoyaltyPointValue,
+		Currency: types.DefaultCurrency,
+	}, hotel.PriceCurrency())
+	if err != nil {
+		return types.PriceLine{}, myErrors.NewError(http.StatusBadRequest, fmt.Sprintf("Loyalty points cannot be redeemed in %s", hotel.PriceCurrency()))
+	}
+
+	for _, discount := range discounts {
+		roomTotal -= discount.Amount
+	}
+	if value.Amount > roomTotal {
+		return types.PriceLine{}, myErrors.NewError(http.StatusBadRequest, "Cannot redeem loyalty points for more than the room total")
+	}
+
+	return types.PriceLine{
+		Name:   fmt.Sprintf("Loyalty points (%d)", points),
+		Amount: value.Amount,
+	}, nil
+}
+
+// releaseRedemptions gives back the promo code and the loyalty points of a booking that failed
+func (h *RoomHandler) releaseRedemptions(ctx context.Context, booking *types.Booking) {
+	h.releasePromoCode(ctx, booking)
+
+	if booking.LoyaltyPoints > 0 {
+		if err := reverseLoyaltyPoints(ctx, h.store, booking, "Booking failed"); err != nil {
+			log.Println("failed to reverse loyalty points:", err)
+		}
+	}
+}
+
+func (h *RoomHandler) releasePromoCode(ctx context.Context, booking *types.Booking) {
+	if booking.PromoCodeID.IsZero() {
+		return
+	}
+
+	if err := h.store.PromoCode.ReleasePromoCode(ctx, booking.PromoCodeID, booking.UserID); err != nil {
+		log.Println("failed to release promo code:", err)
+	}
+}
+
+// IsRoomAvailableForBooking reports whether the room has neither
+// active bookings nor maintenance blocks overlapping the stay.
+func IsRoomAvailableForBooking(ctx context.Context, store *db.Store, roomID primitive.ObjectID, params types.BookRoomParams) (bool, error) {
 	canceled := false
 
 	bookingQueryParams := db.BookingQueryParams{
@@ -102,12 +544,92 @@ func IsRoomAvailableForBooking(ctx context.Context, bookingStore db.BookingStore
 		Canceled: &canceled,
 	}
 
-	bookings, err := bookingStore.GetBookings(ctx, &bookingQueryParams, &bookingQueryParams.Pagination)
-	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+	bookings, err := store.Booking.GetBookings(ctx, &bookingQueryParams, &bookingQueryParams.Pagination)
+	if err != nil {
 		return false, err
 	}
+	if len(bookings) > 0 {
+		return false, nil
+	}
+
+	roomBlockQueryParams := db.RoomBlockQueryParams{
+		RoomID:   roomID,
+		FromDate: params.FromDate,
+		TillDate: params.TillDate,
+	}
+
+	blocks, err := store.RoomBlock.GetRoomBlocks(ctx, &roomBlockQueryParams, &roomBlockQueryParams.Pagination)
+	if err != nil {
+		return false, err
+	}
+
+	ok := len(blocks) == 0
+
+	return ok, nil
+}
+
+// IsRoomTypeAvailableForBooking reports whether at least one room of the type
+// is left on every night of the stay, counting bookings of the type and blocks
+// of its rooms against the inventory.
+func IsRoomTypeAvailableForBooking(ctx context.Context, store *db.Store, hotelID primitive.ObjectID, roomType *types.RoomType, params types.BookRoomParams) (bool, error) {
+	canceled := false
+
+	bookingQueryParams := db.BookingQueryParams{
+		Pagination: db.Pagination{
+			Limit: maxOverlappingBookings,
+		},
+		HotelID:    hotelID,
+		RoomTypeID: roomType.ID,
+		FromDate:   params.FromDate,
+		TillDate:   params.TillDate,
+		Canceled:   &canceled,
+	}
+
+	bookings, err := store.Booking.GetBookings(ctx, &bookingQueryParams, &bookingQueryParams.Pagination)
+	if err != nil {
+		return false, err
+	}
+
+	roomQueryParams := db.RoomQueryParams{
+		Pagination: db.Pagination{
+			Limit: maxOverlappingBookings,
+		},
+		HotelID:    hotelID,
+		RoomTypeID: roomType.ID,
+	}
+
+	rooms, err := store.Room.GetRooms(ctx, &roomQueryParams, &roomQueryParams.Pagination)
+	if err != nil {
+		return false, err
+	}
+
+	roomIDs := map[primitive.ObjectID]bool{}
+	for _, room := range rooms {
+		roomIDs[room.ID] = true
+	}
+
+	roomBlockQueryParams := db.RoomBlockQueryParams{
+		Pagination: db.Pagination{
+			Limit: maxOverlappingBookings,
+		},
+		HotelID:  hotelID,
+		FromDate: params.FromDate,
+		TillDate: params.TillDate,
+	}
+
+	hotelBlocks, err := store.RoomBlock.GetRoomBlocks(ctx, &roomBlockQueryParams, &roomBlockQueryParams.Pagination)
+	if err != nil {
+		return false, err
+	}
+
+	blocks := []*types.RoomBlock{}
+	for _, block := range hotelBlocks {
+		if roomIDs[block.RoomID] {
+			blocks = append(blocks, block)
+		}
+	}
 
-	ok := len(bookings) == 0
+	ok := roomType.Availability(params.FromDate, params.TillDate, bookings, blocks) > 0
 
 	return ok, nil
 }
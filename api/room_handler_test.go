@@ -0,0 +1,676 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBookRoomBlockedByMinLOSRestriction(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
+
+		fromDate = time.Now().AddDate(0, 0, 5).UTC()
+
+		_ = fixtures.AddRestriction(tdb.store, hotel.ID, types.CreateRestrictionParams{
+			FromDate: fromDate.AddDate(0, 0, -1),
+			TillDate: fromDate.AddDate(0, 0, 1),
+			MinLOS:   2,
+		})
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	route.Post("/:id/book", roomHandler.HandleBookRoom)
+
+	params := types.BookRoomParams{
+		FromDate:     fromDate,
+		TillDate:     fromDate.AddDate(0, 0, 1),
+		NumPersons:   2,
+		PaymentToken: payment.FakeTokenApproved,
+	}
+	b, _ := json.Marshal(params)
+
+	targetURL := "/" + room.ID.Hex() + "/book"
+	req := httptest.NewRequest(http.MethodPost, targetURL, bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected http status code %d but got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	var errorResponse errors.Error
+	if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(errorResponse.Message, "Minimum length of stay") {
+		t.Fatalf("expected the error to explain the minimum length of stay rule but got %q", errorResponse.Message)
+	}
+}
+
+func TestBookRoomRestrictionBeyondFirstPage(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
+
+		fromDate = time.Now().AddDate(0, 0, 5).UTC()
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	// A full page of restrictions the stay passes comes before the one refusing it
+	for i := 0; i < maxStayRestrictions; i++ {
+		fixtures.AddRestriction(tdb.store, hotel.ID, types.CreateRestrictionParams{
+			FromDate: fromDate.AddDate(0, 0, -1),
+			TillDate: fromDate.AddDate(0, 0, 1),
+			MinLOS:   1,
+		})
+	}
+	fixtures.AddRestriction(tdb.store, hotel.ID, types.CreateRestrictionParams{
+		RoomID:   room.ID,
+		FromDate: fromDate.AddDate(0, 0, -1),
+		TillDate: fromDate.AddDate(0, 0, 1),
+		MinLOS:   2,
+	})
+
+	route.Post("/:id/book", roomHandler.HandleBookRoom)
+
+	params := types.BookRoomParams{
+		FromDate:     fromDate,
+		TillDate:     fromDate.AddDate(0, 0, 1),
+		NumPersons:   2,
+		PaymentToken: payment.FakeTokenApproved,
+	}
+	b, _ := json.Marshal(params)
+
+	req := httptest.NewRequest(http.MethodPost, "/"+room.ID.Hex()+"/book", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected http status code %d but got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestDeleteRestrictionIfMatch(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel       = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		restriction = fixtures.AddRestriction(tdb.store, hotel.ID, types.CreateRestrictionParams{
+			FromDate: time.Now().AddDate(0, 0, 1).UTC(),
+			TillDate: time.Now().AddDate(0, 0, 3).UTC(),
+			MinLOS:   2,
+		})
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		restrictionHandler = NewRestrictionHandler(tdb.store)
+	)
+
+	route.Delete("/restriction/:id", middleware.AdminAuth, restrictionHandler.HandleDeleteRestriction)
+
+	tests := []struct {
+		name           string
+		ifMatch        string
+		expectedStatus int
+	}{
+		{"missing header", "", http.StatusPreconditionRequired},
+		{"stale version", versionETag(restriction.Version + 1), http.StatusPreconditionFailed},
+		{"current version", versionETag(restriction.Version), http.StatusOK},
+		{"deleted", "*", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodDelete, "/restriction/"+restriction.ID.Hex(), nil)
+		req.Header.Add("X-Api-Token", createTokenFromUser(admin))
+		if len(tt.ifMatch) > 0 {
+			req.Header.Add("If-Match", tt.ifMatch)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != tt.expectedStatus {
+			t.Fatalf("%s: expected http status code %d but got %d", tt.name, tt.expectedStatus, resp.StatusCode)
+		}
+	}
+}
+
+func TestBookBlockedRoom(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+		admin = fixtures.AddUser(tdb.store, "admin", "admin",
+			"admin@example.org", "admin", true)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 19990, hotel.ID)
+
+		_ = fixtures.AddRoomBlock(tdb.store, room, admin.ID, "Water leak",
+			time.Now().AddDate(0, 0, 1).UTC(), time.Now().AddDate(0, 0, 10).UTC())
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	route.Post("/:id/book", roomHandler.HandleBookRoom)
+
+	params := types.BookRoomParams{
+		FromDate:     time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:     time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons:   2,
+		PaymentToken: payment.FakeTokenApproved,
+	}
+	b, _ := json.Marshal(params)
+
+	targetURL := "/" + room.ID.Hex() + "/book"
+	req := httptest.NewRequest(http.MethodPost, targetURL, bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected http status code %d but got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestBookSoldOutRoomType(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel    = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room     = fixtures.AddRoom(tdb.store, "large", true, 39990, hotel.ID)
+		roomType = fixtures.AddRoomType(tdb.store, hotel.ID, "Deluxe Sea View", 0, 39990, []*types.Room{room})
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	route.Post("/:id/roomtype/:typeID/book", roomHandler.HandleBookRoomType)
+
+	params := types.BookRoomParams{
+		FromDate:     time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:     time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons:   2,
+		PaymentToken: payment.FakeTokenApproved,
+	}
+	b, _ := json.Marshal(params)
+
+	targetURL := "/" + hotel.ID.Hex() + "/roomtype/" + roomType.ID.Hex() + "/book"
+	expectedStatusCodes := []int{http.StatusCreated, http.StatusBadRequest}
+
+	for _, expectedStatusCode := range expectedStatusCodes {
+		req := httptest.NewRequest(http.MethodPost, targetURL, bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != expectedStatusCode {
+			t.Fatalf("expected http status code %d but got %d", expectedStatusCode, resp.StatusCode)
+		}
+	}
+}
+
+func TestGetQuoteWithTaxesAndFees(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	pricing := types.UpdateHotelPricingParams{
+		Currency: "EUR",
+		Taxes: []types.Tax{
+			{Name: "VAT", Type: types.TaxPercentage, Rate: 2000},
+			{Name: "City tax", Type: types.TaxPerPersonPerNight, Rate: 150},
+		},
+		Fees: []types.Fee{
+			{Name: "Cleaning", Amount: 2500},
+		},
+	}
+	if err := tdb.store.Hotel.UpdateHotel(context.Background(), bson.M{"_id": hotel.ID}, bson.M{"$set": pricing.ToBSON()}); err != nil {
+		t.Fatal(err)
+	}
+
+	route.Get("/:id/quote", roomHandler.HandleGetQuote)
+
+	fromDate := time.Now().AddDate(0, 0, 3).UTC()
+	tillDate := fromDate.AddDate(0, 0, 2)
+
+	targetURL := "/" + room.ID.Hex() + "/quote?numPersons=2&fromDate=" + fromDate.Format(time.RFC3339) +
+		"&tillDate=" + tillDate.Format(time.RFC3339)
+	req := httptest.NewRequest(http.MethodGet, targetURL, nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code 200 but got %d", resp.StatusCode)
+	}
+
+	var quote types.PriceBreakdown
+	if err := json.NewDecoder(resp.Body).Decode(&quote); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 nights * 100.00 + 20% VAT + 2 persons * 2 nights * 1.50 + 25.00
+	var expectedTotal int64 = 20000 + 4000 + 600 + 2500
+
+	if quote.Currency != "EUR" {
+		t.Fatalf("expected currency EUR but got %s", quote.Currency)
+	}
+	if quote.Total != expectedTotal {
+		t.Fatalf("expected total %d but got %d", expectedTotal, quote.Total)
+	}
+}
+
+func TestBookRoomPromoCodeUsageLimit(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		rooms = []*types.Room{
+			fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID),
+			fixtures.AddRoom(tdb.store, "medium", false, 10000, hotel.ID),
+		}
+
+		promoCode = fixtures.AddPromoCode(tdb.store, types.CreatePromoCodeParams{
+			Code:           "summer10",
+			Type:           types.PromoPercentage,
+			Value:          1000,
+			MaxRedemptions: 1,
+		})
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	route.Post("/:id/book", roomHandler.HandleBookRoom)
+
+	params := types.BookRoomParams{
+		FromDate:     time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:     time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons:   2,
+		PromoCode:    promoCode.Code,
+		PaymentToken: payment.FakeTokenApproved,
+	}
+	b, _ := json.Marshal(params)
+
+	expectedStatusCodes := []int{http.StatusCreated, http.StatusBadRequest}
+
+	for i, room := range rooms {
+		targetURL := "/" + room.ID.Hex() + "/book"
+		req := httptest.NewRequest(http.MethodPost, targetURL, bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != expectedStatusCodes[i] {
+			t.Fatalf("expected http status code %d but got %d", expectedStatusCodes[i], resp.StatusCode)
+		}
+
+		if i > 0 {
+			continue
+		}
+
+		var booking types.Booking
+		if err := json.NewDecoder(resp.Body).Decode(&booking); err != nil {
+			t.Fatal(err)
+		}
+
+		// 2 nights * 100.00 - 10%
+		if booking.Price.Total != 18000 {
+			t.Fatalf("expected total 18000 but got %d", booking.Price.Total)
+		}
+	}
+}
+
+func TestBookRoomPaymentDeclined(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	route.Post("/:id/book", roomHandler.HandleBookRoom)
+
+	params := types.BookRoomParams{
+		FromDate:     time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:     time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons:   2,
+		PaymentToken: payment.FakeTokenDeclined,
+	}
+	b, _ := json.Marshal(params)
+
+	targetURL := "/" + room.ID.Hex() + "/book"
+	req := httptest.NewRequest(http.MethodPost, targetURL, bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusPaymentRequired {
+		t.Fatalf("expected http status code %d but got %d", http.StatusPaymentRequired, resp.StatusCode)
+	}
+
+	available, err := IsRoomAvailableForBooking(context.Background(), tdb.store, room.ID, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Fatal("expected the room to stay available after a declined payment")
+	}
+}
+
+func TestGetRoomsSorted(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		_     = fixtures.AddRoom(tdb.store, "small", false, 10000, hotel.ID)
+		_     = fixtures.AddRoom(tdb.store, "large", true, 30000, hotel.ID)
+		_     = fixtures.AddRoom(tdb.store, "medium", true, 20000, hotel.ID)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	route.Get("/room", roomHandler.HandleGetRooms)
+
+	req := httptest.NewRequest(http.MethodGet, "/room?sort=-seaside,-price", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status code 200 but got %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Data []*types.Room `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	var prices []int64
+	for _, room := range response.Data {
+		prices = append(prices, room.Price)
+	}
+	if len(prices) != 3 || prices[0] != 30000 || prices[1] != 20000 || prices[2] != 10000 {
+		t.Fatalf("expected rooms sorted by price descending but got %v", prices)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/room?sort=hotelID", nil)
+	req.Header.Add("X-Api-Token", createTokenFromUser(user))
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected http status code 400 but got %d", resp.StatusCode)
+	}
+}
+
+func TestBookRoomIdempotencyKey(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		hotel = fixtures.AddHotel(tdb.store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(tdb.store, "medium", true, 10000, hotel.ID)
+
+		app   = fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+		route = app.Group("/", middleware.JWTAuthentication(tdb.store.User), middleware.Idempotency(tdb.store.Idempotency))
+
+		roomHandler = NewRoomHandler(tdb.store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""))
+	)
+
+	route.Post("/:id/book", roomHandler.HandleBookRoom)
+
+	book := func(params types.BookRoomParams) *http.Response {
+		b, _ := json.Marshal(params)
+
+		req := httptest.NewRequest(http.MethodPost, "/"+room.ID.Hex()+"/book", bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Api-Token", createTokenFromUser(user))
+		req.Header.Add(middleware.IdempotencyKeyHeader, "booking-1")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	params := types.BookRoomParams{
+		FromDate:   time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:   time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons: 2,
+	}
+
+	var bookingIDs []string
+	for i := 0; i < 2; i++ {
+		resp := book(params)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status code 201 but got %d", resp.StatusCode)
+		}
+
+		replayed := resp.Header.Get(middleware.IdempotentReplayedHeader) == "true"
+		if replayed != (i > 0) {
+			t.Fatalf("expected only the retry to be replayed, request %d replayed: %t", i, replayed)
+		}
+
+		var booking types.Booking
+		if err := json.NewDecoder(resp.Body).Decode(&booking); err != nil {
+			t.Fatal(err)
+		}
+		bookingIDs = append(bookingIDs, booking.ID.Hex())
+	}
+
+	if bookingIDs[0] != bookingIDs[1] {
+		t.Fatalf("expected the retry to return booking %s but got %s", bookingIDs[0], bookingIDs[1])
+	}
+
+	bookings, err := tdb.store.Booking.GetBookings(context.Background(), &db.BookingQueryParams{RoomID: room.ID}, &db.Pagination{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 {
+		t.Fatalf("expected 1 booking but got %d", len(bookings))
+	}
+
+	// The key can't be reused for another stay
+	params.TillDate = params.TillDate.AddDate(0, 0, 1)
+	if resp := book(params); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status code 422 but got %d", resp.StatusCode)
+	}
+}
+
+func TestIdempotencyKeyLease(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	var (
+		user = fixtures.AddUser(tdb.store, "user", "user",
+			"user@example.org", "user", false)
+
+		lease = 100 * time.Millisecond
+		store = db.NewMongoTestIdempotencyStore(tdb.client, db.DefaultIdempotencyKeyTTL, lease)
+	)
+
+	reserve := func() (*types.IdempotencyRecord, *types.IdempotencyRecord) {
+		record := &types.IdempotencyRecord{
+			Key:         "booking-1",
+			UserID:      user.ID,
+			RequestHash: "hash",
+		}
+
+		existing, err := store.ReserveIdempotencyKey(context.Background(), record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return record, existing
+	}
+
+	// The first request crashes without a response
+	crashed, existing := reserve()
+	if existing != nil {
+		t.Fatalf("expected the key to be reserved but got an existing record")
+	}
+
+	// Retries are rejected while the lease holds
+	if _, existing = reserve(); existing == nil || existing.Completed {
+		t.Fatalf("expected the request to be in progress but got %+v", existing)
+	}
+
+	time.Sleep(2 * lease)
+
+	retry, existing := reserve()
+	if existing != nil {
+		t.Fatalf("expected the retry to take the key over but got an existing record")
+	}
+	if retry.ID != crashed.ID {
+		t.Fatalf("expected the retry to take over record %s but got %s", crashed.ID.Hex(), retry.ID.Hex())
+	}
+
+	// The request the key was taken over from can't store its response anymore
+	if err := store.CompleteIdempotencyKey(context.Background(), crashed, http.StatusConflict, "text/plain", []byte("stale")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CompleteIdempotencyKey(context.Background(), retry, http.StatusCreated, "text/plain", []byte("created")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, existing = reserve()
+	if existing == nil || !existing.Completed {
+		t.Fatalf("expected a completed record but got %+v", existing)
+	}
+	if existing.StatusCode != http.StatusCreated || string(existing.Body) != "created" {
+		t.Fatalf("expected the response of the retry but got %d %s", existing.StatusCode, existing.Body)
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/etag"
+	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/blob"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/photo"
+	"github.com/rtsoy/hotel-reservation/ratelimit"
+	"net/http"
+	"strings"
+)
+
+// Sign-ins and searches are easy to abuse, so they have limits of their own
+// on top of the default limit every authenticated request counts toward.
+var (
+	defaultRateLimit = ratelimit.PerMinute(300)
+	authRateLimit    = ratelimit.PerMinute(10)
+	searchRateLimit  = ratelimit.PerMinute(60)
+)
+
+// RegisterRoutes registers the handlers of every route of the API on the app.
+// Routes should be described in the OpenAPI document too, see newOpenAPIDocument.
+// Rate limits are kept in the limiter.
+func RegisterRoutes(app *fiber.App, store *db.Store, rates currency.RateProvider, payments payment.PaymentProvider, blobs blob.BlobStore, limiter ratelimit.Store) {
+	// Photo uploads are the only requests with bodies larger than the default limit
+	app.Use(middleware.BodyLimit(func(c *fiber.Ctx) int {
+		if c.Method() == http.MethodPost && strings.HasSuffix(c.Path(), "/photo") {
+			return photo.MaxUploadSize
+		}
+
+		return fiber.DefaultBodyLimit
+	}))
+
+	var (
+		apiv1 = app.Group("/api/v1", middleware.JWTAuthentication(store.User))
+		auth  = app.Group("/api")
+		admin = apiv1.Group("/admin", middleware.AdminAuth)
+		staff = apiv1.Group("/staff", middleware.StaffAuth)
+
+		userHandler         = NewUserHandler(store.User)
+		authHandler         = NewAuthHandler(store.User)
+		hotelHandler        = NewHotelHandler(store, rates)
+		roomHandler         = NewRoomHandler(store, rates, payments)
+		bookingHandler      = NewBookingHandler(store, rates, payments)
+		restrictionHandler  = NewRestrictionHandler(store)
+		roomBlockHandler    = NewRoomBlockHandler(store)
+		housekeepingHandler = NewHousekeepingHandler(store)
+		promoCodeHandler    = NewPromoCodeHandler(store.PromoCode)
+		paymentHandler      = NewPaymentHandler(store, payments)
+		invoiceHandler      = NewInvoiceHandler(store)
+		loyaltyHandler      = NewLoyaltyHandler(store)
+		reviewHandler       = NewReviewHandler(store)
+		photoHandler        = NewPhotoHandler(store, blobs)
+		docsHandler         = NewDocsHandler()
+
+		authLimit   = middleware.RateLimit(limiter, "auth", authRateLimit)
+		searchLimit = middleware.RateLimit(limiter, "search", searchRateLimit)
+	)
+
+	apiv1.Use(middleware.RateLimit(limiter, "default", defaultRateLimit))
+
+	// Reads get ETags of their response, versioned resources send the ETag of their version instead
+	apiv1.Use(etag.New(etag.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return c.Method() != http.MethodGet
+		},
+	}))
+
+	// Authenticated POST requests can be retried safely with an Idempotency-Key
+	apiv1.Use(middleware.Idempotency(store.Idempotency))
+
+	// Auth Handlers
+
+	auth.Post("/auth", authLimit, authHandler.HandleAuthenticate)
+
+	// Payment Handlers
+
+	auth.Post("/payment/webhook", paymentHandler.HandlePaymentWebhook)
+
+	// Photo Handlers
+
+	auth.Get("/photo/*", photoHandler.HandleGetPhoto)
+
+	// Docs Handlers
+
+	auth.Get("/openapi.json", docsHandler.HandleGetOpenAPI)
+	auth.Get("/docs", docsHandler.HandleGetDocs)
+
+	// User Handlers
+
+	apiv1.Post("/user", userHandler.HandlePostUser)
+	apiv1.Get("/user", userHandler.HandleGetUsers)
+	apiv1.Get("/user/:id", userHandler.HandleGetUser)
+	apiv1.Put("/user/:id", userHandler.HandlePutUser)
+	apiv1.Delete("/user/:id", userHandler.HandleDeleteUser)
+	apiv1.Get("/user/:id/loyalty", loyaltyHandler.HandleGetLoyalty)
+
+	// Hotel Handlers
+
+	apiv1.Get("/hotel", searchLimit, hotelHandler.HandleGetHotels)
+	apiv1.Get("/hotel/search", searchLimit, hotelHandler.HandleSearchHotels)
+	apiv1.Get("/hotel/:id", hotelHandler.HandleGetHotel)
+	apiv1.Get("/hotel/:id/rooms", hotelHandler.HandleGetRooms)
+	apiv1.Get("/hotel/:id/reviews", reviewHandler.HandleGetHotelReviews)
+	apiv1.Post("/hotel/:id/roomtype/:typeID/book", roomHandler.HandleBookRoomType)
+
+	// Room Handlers
+
+	apiv1.Get("/room", searchLimit, roomHandler.HandleGetRooms)
+	apiv1.Get("/room/:id/quote", searchLimit, roomHandler.HandleGetQuote)
+	apiv1.Post("/room/:id/book", roomHandler.HandleBookRoom)
+
+	// Bookings Handlers
+
+	apiv1.Get("/booking/:id", bookingHandler.HandleGetBooking)
+	apiv1.Get("/booking/:id/cancel", bookingHandler.HandleCancelBooking)
+	apiv1.Get("/booking/:id/folio", invoiceHandler.HandleGetFolio)
+	apiv1.Get("/booking/:id/invoice", invoiceHandler.HandleGetInvoice)
+	apiv1.Post("/booking/:id/invoice", invoiceHandler.HandlePostInvoice)
+
+	// Review Handlers
+
+	apiv1.Post("/review", reviewHandler.HandlePostReview)
+
+	// Admin Routes
+
+	admin.Put("/user/:id/staff", userHandler.HandlePutUserStaff)
+	admin.Get("/booking", bookingHandler.HandleGetBookings)
+	admin.Post("/booking/:id/assign", bookingHandler.HandleAssignRoom)
+	admin.Put("/hotel/:id", hotelHandler.HandlePutHotel)
+	admin.Put("/room/:id", roomHandler.HandlePutRoom)
+	admin.Post("/hotel/:id/photo", photoHandler.HandlePostHotelPhoto)
+	admin.Put("/hotel/:id/photo/order", photoHandler.HandlePutHotelPhotoOrder)
+	admin.Delete("/hotel/:id/photo/:photoID", photoHandler.HandleDeleteHotelPhoto)
+	admin.Post("/room/:id/photo", photoHandler.HandlePostRoomPhoto)
+	admin.Put("/room/:id/photo/order", photoHandler.HandlePutRoomPhotoOrder)
+	admin.Delete("/room/:id/photo/:photoID", photoHandler.HandleDeleteRoomPhoto)
+	admin.Post("/hotel/:id/roomtype", hotelHandler.HandlePostRoomType)
+	admin.Put("/hotel/:id/pricing", hotelHandler.HandlePutHotelPricing)
+	admin.Post("/promo", promoCodeHandler.HandlePostPromoCode)
+	admin.Get("/promo", promoCodeHandler.HandleGetPromoCodes)
+	admin.Post("/hotel/:id/restriction", restrictionHandler.HandlePostRestriction)
+	admin.Get("/hotel/:id/restriction", restrictionHandler.HandleGetRestrictions)
+	admin.Delete("/restriction/:id", restrictionHandler.HandleDeleteRestriction)
+	admin.Post("/room/:id/block", roomBlockHandler.HandlePostRoomBlock)
+	admin.Get("/block", roomBlockHandler.HandleGetRoomBlocks)
+	admin.Delete("/block/:id", roomBlockHandler.HandleDeleteRoomBlock)
+	admin.Get("/review", reviewHandler.HandleGetReviews)
+	admin.Put("/review/:id/moderation", reviewHandler.HandlePutReviewModeration)
+
+	// Staff Routes
+
+	staff.Post("/booking/:id/checkout", bookingHandler.HandleCheckOutBooking)
+	staff.Post("/booking/:id/folio/extra", invoiceHandler.HandlePostFolioExtra)
+	staff.Put("/room/:id/housekeeping", housekeepingHandler.HandlePutHousekeepingStatus)
+	staff.Get("/hotel/:id/housekeeping", housekeepingHandler.HandleGetHousekeepingTasks)
+}
@@ -25,13 +25,13 @@ func setup(t *testing.T) *testdb {
 		t.Fatal(err)
 	}
 
+	store := db.NewMongoTestStore(client)
+	if err := store.EnsureIndexes(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
 	return &testdb{
 		client: client,
-		store: &db.Store{
-			User:    db.NewMongoTestUserStore(client),
-			Hotel:   db.NewMongoTestHotelStore(client),
-			Room:    db.NewMongoTestRoomStore(client, db.NewMongoTestHotelStore(client)),
-			Booking: db.NewMongoTestBookingStore(client),
-		},
+		store:  store,
 	}
 }
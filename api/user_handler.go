@@ -33,23 +33,67 @@ func (h *UserHandler) HandlePutUser(c *fiber.Ctx) error {
 		return myErrors.ErrInvalidID()
 	}
 
-	if err := c.BodyParser(&values); err != nil {
-		return myErrors.ErrBadRequest()
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		return err
+	}
+
+	if err := parseBody(c, &values); err != nil {
+		return err
 	}
 
-	filter := bson.M{"_id": oid}
+	filter := db.MatchVersion(bson.M{"_id": oid}, versions...)
 	update := bson.M{
 		"$set": values.ToBSON(),
 	}
 
 	if err := h.userStore.UpdateUser(c.Context(), filter, update); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return myErrors.ErrResourceNotFound()
-		}
+		return writeError(err)
+	}
+
+	setWrittenETag(c, versions)
+
+	return c.JSON(map[string]string{
+		"updated": id,
+	})
+}
 
+// HandlePutUserStaff grants or revokes the staff access of a user to hotels
+func (h *UserHandler) HandlePutUserStaff(c *fiber.Ctx) error {
+	var (
+		params types.UpdateStaffParams
+		id     = c.Params("id")
+	)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return myErrors.ErrInvalidID()
+	}
+
+	versions, err := ifMatchVersions(c)
+	if err != nil {
 		return err
 	}
 
+	if err := parseBody(c, &params); err != nil {
+		return err
+	}
+
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
+	}
+
+	filter := db.MatchVersion(bson.M{"_id": oid}, versions...)
+	update := bson.M{
+		"$set": params.ToBSON(),
+	}
+
+	if err := h.userStore.UpdateUser(c.Context(), filter, update); err != nil {
+		return writeError(err)
+	}
+
+	setWrittenETag(c, versions)
+
 	return c.JSON(map[string]string{
 		"updated": id,
 	})
@@ -60,17 +104,18 @@ func (h *UserHandler) HandleDeleteUser(c *fiber.Ctx) error {
 
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return err
+		return myErrors.ErrInvalidID()
 	}
 
-	if err := h.userStore.DeleteUser(c.Context(), oid); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return myErrors.ErrResourceNotFound()
-		}
-
+	versions, err := ifMatchVersions(c)
+	if err != nil {
 		return err
 	}
 
+	if err := h.userStore.DeleteUser(c.Context(), oid, versions...); err != nil {
+		return writeError(err)
+	}
+
 	// ??? 204 ???
 	return c.JSON(map[string]string{
 		"deleted": id,
@@ -79,12 +124,12 @@ func (h *UserHandler) HandleDeleteUser(c *fiber.Ctx) error {
 
 func (h *UserHandler) HandlePostUser(c *fiber.Ctx) error {
 	var params types.CreateUserParams
-	if err := c.BodyParser(&params); err != nil {
-		return myErrors.ErrBadRequest()
+	if err := parseBody(c, &params); err != nil {
+		return err
 	}
 
-	if errors := params.Validate(); len(errors) > 0 {
-		return c.JSON(errors)
+	if err := params.Validate(); err != nil {
+		return myErrors.ErrValidation(err)
 	}
 
 	user, err := types.NewUserFromParams(params)
@@ -117,29 +162,25 @@ func (h *UserHandler) HandleGetUser(c *fiber.Ctx) error {
 		return err
 	}
 
-	return c.JSON(user)
+	return sendVersioned(c, user.Version, user)
 }
 
 func (h *UserHandler) HandleGetUsers(c *fiber.Ctx) error {
 	var userQueryParams db.UserQueryParams
-	if err := c.QueryParser(&userQueryParams); err != nil {
-		return myErrors.ErrBadRequest()
+	if err := parseQuery(c, &userQueryParams); err != nil {
+		return err
 	}
 
-	users, err := h.userStore.GetUsers(c.Context(), &userQueryParams, &userQueryParams.Pagination)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return myErrors.ErrResourceNotFound()
-		}
-
+	if err := checkPagination(&userQueryParams.Pagination); err != nil {
 		return err
 	}
 
-	response := &resourceResponse{
-		Results: len(users),
-		Page:    userQueryParams.Page,
-		Data:    users,
+	users, err := h.userStore.GetUsers(c.Context(), &userQueryParams, &userQueryParams.Pagination)
+	if err != nil {
+		return listError(err)
 	}
 
+	response := newPageResponse(c, users, len(users), &userQueryParams.Pagination)
+
 	return c.JSON(response)
 }
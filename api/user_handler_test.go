@@ -2,12 +2,19 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/db"
 	"github.com/rtsoy/hotel-reservation/db/fixtures"
 	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -61,6 +68,82 @@ func TestPostUser(t *testing.T) {
 	}
 }
 
+func TestPostInvalidUser(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	app := fiber.New(fiber.Config{ErrorHandler: myErrors.ErrorHandler})
+	userHandler := NewUserHandler(tdb.store.User)
+	app.Post("/", userHandler.HandlePostUser)
+
+	params := types.CreateUserParams{
+		FirstName: "J",
+		LastName:  "Harden",
+		Email:     "not-an-email",
+		Password:  "qwerty123",
+	}
+	b, _ := json.Marshal(params)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status code 400 but got %d", resp.StatusCode)
+	}
+
+	var apiError myErrors.Error
+	if err := json.NewDecoder(resp.Body).Decode(&apiError); err != nil {
+		t.Fatal(err)
+	}
+
+	if apiError.ErrorCode != types.CodeValidationFailed {
+		t.Errorf("expected errorCode %s but got %s", types.CodeValidationFailed, apiError.ErrorCode)
+	}
+
+	expected := []types.Violation{
+		{Field: "firstName", Code: types.ViolationTooShort},
+		{Field: "email", Code: types.ViolationInvalid},
+	}
+	if len(apiError.Violations) != len(expected) {
+		t.Fatalf("expected %d violations but got %d", len(expected), len(apiError.Violations))
+	}
+	for i, violation := range apiError.Violations {
+		if violation.Field != expected[i].Field || violation.Code != expected[i].Code {
+			t.Errorf("expected violation %s %s but got %s %s", expected[i].Field, expected[i].Code, violation.Field, violation.Code)
+		}
+	}
+
+	// Values of the wrong type are reported before validation
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"firstName": 13}`))
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status code 400 but got %d", resp.StatusCode)
+	}
+
+	apiError = myErrors.Error{}
+	if err := json.NewDecoder(resp.Body).Decode(&apiError); err != nil {
+		t.Fatal(err)
+	}
+
+	if apiError.ErrorCode != types.CodeMalformedBody {
+		t.Errorf("expected errorCode %s but got %s", types.CodeMalformedBody, apiError.ErrorCode)
+	}
+	if len(apiError.Violations) != 1 || apiError.Violations[0].Field != "firstName" || apiError.Violations[0].Code != types.ViolationInvalidType {
+		t.Errorf("expected an invalid_type violation of firstName but got %+v", apiError.Violations)
+	}
+}
+
 func TestGetUsers(t *testing.T) {
 	tdb := setup(t)
 	defer tdb.teardown(t, tdb.client)
@@ -97,6 +180,68 @@ func TestGetUsers(t *testing.T) {
 	}
 }
 
+func TestGetUsersByCursor(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	app := fiber.New()
+	userHandler := NewUserHandler(tdb.store.User)
+	app.Get("/", userHandler.HandleGetUsers)
+
+	for i := 1; i <= 5; i++ {
+		_ = fixtures.AddUser(tdb.store, fmt.Sprintf("user%d", i), "user",
+			fmt.Sprintf("user%d@example.com", i), "userpassword", false)
+	}
+
+	getPage := func(target string) *resourceResponse {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code 200 but got %d", resp.StatusCode)
+		}
+
+		var response resourceResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		return &response
+	}
+
+	response := getPage("/?sort=-firstName&limit=2&total=true")
+	if response.Total == nil || *response.Total != 5 || !response.HasMore || len(response.Next) == 0 {
+		t.Fatalf("expected a first page of 5 users with a next link but got %+v", response)
+	}
+
+	var firstNames []string
+	for {
+		for _, user := range response.Data.([]any) {
+			firstNames = append(firstNames, user.(map[string]any)["firstName"].(string))
+		}
+		if !response.HasMore {
+			break
+		}
+		response = getPage(response.Next)
+	}
+
+	if strings.Join(firstNames, ",") != "user5,user4,user3,user2,user1" {
+		t.Fatalf("expected every user once in descending order but got %v", firstNames)
+	}
+	if len(response.Prev) == 0 {
+		t.Fatal("expected the last page to link to the previous page")
+	}
+
+	response = getPage(response.Prev)
+	if response.Results != 2 || response.Data.([]any)[0].(map[string]any)["firstName"] != "user3" {
+		t.Fatalf("expected the previous page to start at user3 but got %+v", response.Data)
+	}
+}
+
 func TestGetUser(t *testing.T) {
 	tdb := setup(t)
 	defer tdb.teardown(t, tdb.client)
@@ -141,6 +286,53 @@ func TestGetUser(t *testing.T) {
 	}
 }
 
+func TestGetUserHidesInternalErrors(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	expectedUser := fixtures.AddUser(tdb.store, "James", "Harden",
+		"jamesHarden13@example.com", "qwerty123", false)
+
+	// The store of a disconnected client fails with a driver error
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(db.TestDBURI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Disconnect(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: myErrors.ErrorHandler})
+	userHandler := NewUserHandler(db.NewMongoTestUserStore(client))
+	app.Get("/:id", userHandler.HandleGetUser)
+
+	req := httptest.NewRequest(http.MethodGet, "/"+expectedUser.ID.Hex(), nil)
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status code 500 but got %d", resp.StatusCode)
+	}
+
+	var apiError myErrors.Error
+	if err := json.NewDecoder(resp.Body).Decode(&apiError); err != nil {
+		t.Fatal(err)
+	}
+
+	if apiError.ErrorCode != types.CodeInternal {
+		t.Errorf("expected errorCode %s but got %s", types.CodeInternal, apiError.ErrorCode)
+	}
+	if apiError.Message != "Internal Server Error" {
+		t.Errorf("expected a generic message but got %q", apiError.Message)
+	}
+	if len(apiError.RequestID) == 0 || apiError.RequestID != resp.Header.Get(fiber.HeaderXRequestID) {
+		t.Errorf("expected the request id %q to be returned in the header too", apiError.RequestID)
+	}
+}
+
 func TestUpdateUser(t *testing.T) {
 	tdb := setup(t)
 	defer tdb.teardown(t, tdb.client)
@@ -164,6 +356,7 @@ func TestUpdateUser(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodPut, targetURL, bytes.NewReader(b))
 	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("If-Match", versionETag(user.Version))
 
 	resp, err := app.Test(req)
 	if err != nil {
@@ -188,6 +381,74 @@ func TestUpdateUser(t *testing.T) {
 	}
 }
 
+func TestUpdateUserConditionally(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t, tdb.client)
+
+	app := fiber.New(fiber.Config{ErrorHandler: myErrors.ErrorHandler})
+	userHandler := NewUserHandler(tdb.store.User)
+	app.Get("/:id", userHandler.HandleGetUser)
+	app.Put("/:id", userHandler.HandlePutUser)
+
+	user := fixtures.AddUser(tdb.store, "James", "Harden",
+		"jamesHarden13@example.com", "qwerty123", false)
+
+	targetURL := "/" + user.ID.Hex()
+
+	send := func(method string, headers map[string]string) *http.Response {
+		b, _ := json.Marshal(types.UpdateUserParams{FirstName: "Jarden"})
+
+		req := httptest.NewRequest(method, targetURL, bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		for key, value := range headers {
+			req.Header.Add(key, value)
+		}
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	resp := send(http.MethodGet, nil)
+	etag := resp.Header.Get("ETag")
+	if etag != versionETag(user.Version) {
+		t.Fatalf("expected ETag %s but got %s", versionETag(user.Version), etag)
+	}
+
+	if resp := send(http.MethodGet, map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected status code 304 but got %d", resp.StatusCode)
+	}
+
+	if resp := send(http.MethodPut, nil); resp.StatusCode != http.StatusPreconditionRequired {
+		t.Fatalf("expected status code 428 but got %d", resp.StatusCode)
+	}
+
+	resp = send(http.MethodPut, map[string]string{"If-Match": etag})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code 200 but got %d", resp.StatusCode)
+	}
+	newETag := resp.Header.Get("ETag")
+	if newETag == etag {
+		t.Fatal("expected the update to change the ETag")
+	}
+
+	// Another update based on the version before the first one would overwrite it
+	if resp := send(http.MethodPut, map[string]string{"If-Match": etag}); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected status code 412 but got %d", resp.StatusCode)
+	}
+
+	resp = send(http.MethodGet, map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code 200 but got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") != newETag {
+		t.Fatalf("expected ETag %s but got %s", newETag, resp.Header.Get("ETag"))
+	}
+}
+
 func TestDeleteUser(t *testing.T) {
 	tdb := setup(t)
 	defer tdb.teardown(t, tdb.client)
@@ -205,6 +466,7 @@ func TestDeleteUser(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodDelete, targetURL, nil)
 	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("If-Match", versionETag(user.Version))
 
 	resp, err := app.Test(req)
 	if err != nil {
@@ -1,17 +1,327 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db"
 	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxPageLimit caps the page size clients can ask for
+	maxPageLimit = 100
 )
 
 type resourceResponse struct {
-	Results int   `json:"results"`
-	Page    int64 `json:"page"`
-	Data    any   `json:"data"`
+	Results int    `json:"results"`
+	Page    int64  `json:"page,omitempty"`
+	Total   *int64 `json:"total,omitempty"`
+	HasMore bool   `json:"hasMore"`
+	Next    string `json:"next,omitempty"`
+	Prev    string `json:"prev,omitempty"`
+	Data    any    `json:"data"`
+}
+
+// newPageResponse wraps a page of a list with its navigation links,
+// pages read by cursor have no page number
+func newPageResponse(c *fiber.Ctx, data any, results int, pagination *db.Pagination) *resourceResponse {
+	response := &resourceResponse{
+		Results: results,
+		HasMore: pagination.HasMore,
+		Data:    data,
+	}
+	if pagination.CountTotal {
+		response.Total = &pagination.Total
+	}
+	if len(pagination.Cursor) == 0 {
+		response.Page = pagination.Page
+	}
+	if len(pagination.NextCursor) > 0 {
+		response.Next = pageLink(c, pagination.NextCursor)
+	}
+	if len(pagination.PrevCursor) > 0 {
+		response.Prev = pageLink(c, pagination.PrevCursor)
+	}
+
+	return response
+}
+
+// pageLink links to the page of the cursor, keeping the other query parameters of the request
+func pageLink(c *fiber.Ctx, cursor string) string {
+	query, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+	query.Del("page")
+	query.Set("cursor", cursor)
+
+	return c.Path() + "?" + query.Encode()
+}
+
+// parseBody parses the JSON body into params, values of the wrong type are
+// reported as violations of their field
+func parseBody(c *fiber.Ctx, params any) error {
+	err := c.BodyParser(params)
+	if err == nil {
+		return nil
+	}
+
+	apiError := myErrors.ErrBadRequest()
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && len(typeError.Field) > 0 {
+		apiError.Violations = []types.Violation{{
+			Field:   typeError.Field,
+			Code:    types.ViolationInvalidType,
+			Message: fmt.Sprintf("%s should be %s", typeError.Field, typeError.Type),
+		}}
+	}
+
+	return apiError
+}
+
+// parseQuery parses the query string into params, every parameter
+// that can't be parsed is reported as a violation
+func parseQuery(c *fiber.Ctx, params any) error {
+	err := c.QueryParser(params)
+	if err == nil {
+		return nil
+	}
+
+	var multiError fiber.MultiError
+	if !errors.As(err, &multiError) {
+		return myErrors.ErrInvalidQuery()
+	}
+
+	keys := make([]string, 0, len(multiError))
+	for key := range multiError {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	violations := make([]types.Violation, 0, len(keys))
+	for _, key := range keys {
+		violations = append(violations, types.Violation{
+			Field:   key,
+			Code:    types.ViolationInvalidType,
+			Message: fmt.Sprintf("%s has an invalid value", key),
+		})
+	}
+
+	return myErrors.ErrInvalidQuery(violations...)
+}
+
+// invalidQuery reports the violations of a validation error as invalid query parameters
+func invalidQuery(err error) error {
+	var ve *types.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+
+	return myErrors.ErrInvalidQuery(ve.Violations...)
+}
+
+// fieldError reports err as an invalid value of the field
+func fieldError(field string, err error) error {
+	ve := &types.ValidationError{}
+	ve.Merge(field, err)
+
+	return ve.Err()
+}
+
+// checkPagination validates the pagination of a list request and caps its limit
+func checkPagination(pagination *db.Pagination) error {
+	ve := &types.ValidationError{}
+
+	if pagination.Page < 0 {
+		ve.Add("page", types.ViolationOutOfRange, "page should not be negative")
+	}
+	if pagination.Limit < 0 {
+		ve.Add("limit", types.ViolationOutOfRange, "limit should not be negative")
+	}
+	if len(pagination.Cursor) > 0 && pagination.Page > 1 {
+		ve.Add("cursor", types.ViolationInvalid, "page and cursor can't be given together")
+	}
+	if len(ve.Violations) > 0 {
+		return myErrors.ErrInvalidQuery(ve.Violations...)
+	}
+	if pagination.Limit > maxPageLimit {
+		pagination.Limit = maxPageLimit
+	}
+
+	return nil
+}
+
+// listError turns the errors of list stores into responses
+func listError(err error) error {
+	if errors.Is(err, db.ErrInvalidSort) {
+		return myErrors.ErrInvalidQuery(types.Violation{Field: "sort", Code: types.ViolationInvalid, Message: err.Error()})
+	}
+	if errors.Is(err, db.ErrInvalidCursor) {
+		return myErrors.ErrInvalidQuery(types.Violation{Field: "cursor", Code: types.ViolationInvalid, Message: err.Error()})
+	}
+
+	return err
+}
+
+// writeError turns the errors of version-checked writes into responses
+func writeError(err error) error {
+	if errors.Is(err, db.ErrVersionConflict) {
+		return myErrors.ErrPreconditionFailed()
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return myErrors.ErrResourceNotFound()
+	}
+
+	return err
+}
+
+// versionETag is the ETag of a version of a versioned resource
+func versionETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// sendVersioned sends the resource with the ETag of its version,
+// or just 304 when the If-None-Match header has that ETag
+func sendVersioned(c *fiber.Ctx, version int64, resource any) error {
+	etag := versionETag(version)
+	c.Set(fiber.HeaderETag, etag)
+
+	for _, candidate := range strings.Split(c.Get(fiber.HeaderIfNoneMatch), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return c.SendStatus(http.StatusNotModified)
+		}
+	}
+
+	return c.JSON(resource)
+}
+
+// ifMatchVersions are the versions the If-Match header makes a write conditional on.
+// Writes of versioned resources require it, so they can't overwrite changes made
+// since the resource was read. The header lists the ETags of the accepted versions,
+// * accepts any version and gives no versions. A done write bumps the version by one.
+func ifMatchVersions(c *fiber.Ctx) ([]int64, error) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if len(header) == 0 {
+		return nil, myErrors.ErrPreconditionRequired()
+	}
+	if header == "*" {
+		return nil, nil
+	}
+
+	var versions []int64
+	for _, etag := range strings.Split(header, ",") {
+		unquoted, err := strconv.Unquote(strings.TrimSpace(etag))
+		if err != nil {
+			return nil, myErrors.ErrPreconditionFailed()
+		}
+		version, err := strconv.ParseInt(unquoted, 10, 64)
+		if err != nil || version < 0 {
+			return nil, myErrors.ErrPreconditionFailed()
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// versionMatches reports whether the version is one of the versions of ifMatchVersions
+func versionMatches(versions []int64, version int64) bool {
+	if versions == nil {
+		return true
+	}
+
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setWrittenETag sets the ETag of the version a conditional write made. It's only known
+// when the write was based on a single version, otherwise the client has to read it again
+func setWrittenETag(c *fiber.Ctx, versions []int64) {
+	if len(versions) == 1 {
+		c.Set(fiber.HeaderETag, versionETag(versions[0]+1))
+	}
 }
 
 func getAuthUser(c *fiber.Ctx) (*types.User, bool) {
 	user, ok := c.Context().UserValue("user").(*types.User)
 	return user, ok
 }
+
+// checkStaffHotel lets admins and the staff of the hotel through
+func checkStaffHotel(c *fiber.Ctx, hotelID primitive.ObjectID) error {
+	user, ok := getAuthUser(c)
+	if !ok {
+		return myErrors.ErrUnauthorized()
+	}
+
+	if !user.WorksAt(hotelID) {
+		return myErrors.ErrForbidden()
+	}
+
+	return nil
+}
+
+// bookingHotelID returns the hotel of the booking, bookings of a room
+// made before bookings had a hotel only have the hotel of their room
+func bookingHotelID(ctx context.Context, store *db.Store, booking *types.Booking) (primitive.ObjectID, error) {
+	if !booking.HotelID.IsZero() || booking.RoomID.IsZero() {
+		return booking.HotelID, nil
+	}
+
+	room, err := store.Room.GetRoomByID(ctx, booking.RoomID)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return room.HotelID, nil
+}
+
+// setDisplayPrices converts room prices from their hotel's currency to the
+// requested one, rooms are left untouched when no currency is requested.
+func setDisplayPrices(ctx context.Context, hotelStore db.HotelStore, rates currency.RateProvider, rooms []*types.Room, to string) error {
+	if len(to) == 0 {
+		return nil
+	}
+
+	currencies := map[primitive.ObjectID]string{}
+	for _, room := range rooms {
+		from, ok := currencies[room.HotelID]
+		if !ok {
+			hotel, err := hotelStore.GetHotelByID(ctx, room.HotelID)
+			if err != nil {
+				return err
+			}
+
+			from = hotel.PriceCurrency()
+			currencies[room.HotelID] = from
+		}
+
+		price := types.Money{Amount: room.Price, Currency: from}
+
+		displayPrice, err := currency.Convert(ctx, rates, price, to)
+		if err != nil {
+			return invalidQuery(fieldError("currency", err))
+		}
+
+		room.DisplayPrice = &displayPrice
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+// Package blob stores binary objects such as photos by key.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Info describes a stored blob
+type Info struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore is implemented by storage backends. Keys are slash separated
+// paths like "hotels/<id>/<photo>.jpg", so they map to S3 object keys as well.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *Info, error)
+	Delete(ctx context.Context, key string) error
+}
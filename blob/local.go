@@ -0,0 +1,120 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalBlobStore keeps blobs as files under a root directory,
+// the content type is derived from the extension of the key
+type LocalBlobStore struct {
+	root string
+}
+
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalBlobStore{
+		root: root,
+	}, nil
+}
+
+// path returns the file of the key, keys can't escape the root directory
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key || strings.HasPrefix(key, "..") {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file first, so readers never see a partial blob
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *Info, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if stat.IsDir() {
+		f.Close()
+		return nil, nil, ErrNotFound
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return f, &Info{
+		Size:        stat.Size(),
+		ContentType: contentType,
+		ModTime:     stat.ModTime(),
+	}, nil
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Quote is the price of a stay, DisplayTotal is set when another currency was asked for
+type Quote struct {
+	types.PriceBreakdown
+	DisplayTotal *types.Money `json:"displayTotal,omitempty"`
+}
+
+// GetQuote prices a stay in the room without booking it, currency is optional
+func (c *Client) GetQuote(ctx context.Context, roomID primitive.ObjectID, params types.BookRoomParams, currency string) (*Quote, error) {
+	query := url.Values{
+		"fromDate":   {params.FromDate.Format(time.RFC3339)},
+		"tillDate":   {params.TillDate.Format(time.RFC3339)},
+		"numPersons": {strconv.Itoa(params.NumPersons)},
+	}
+	if len(params.PromoCode) > 0 {
+		query.Set("promoCode", params.PromoCode)
+	}
+	if params.LoyaltyPoints > 0 {
+		query.Set("loyaltyPoints", strconv.FormatInt(params.LoyaltyPoints, 10))
+	}
+	if len(currency) > 0 {
+		query.Set("currency", currency)
+	}
+
+	var quote Quote
+	if err := c.do(ctx, http.MethodGet, "/api/v1/room/"+roomID.Hex()+"/quote", query, nil, &quote); err != nil {
+		return nil, err
+	}
+
+	return &quote, nil
+}
+
+func (c *Client) BookRoom(ctx context.Context, roomID primitive.ObjectID, params types.BookRoomParams) (*types.Booking, error) {
+	var booking types.Booking
+	if err := c.do(ctx, http.MethodPost, "/api/v1/room/"+roomID.Hex()+"/book", nil, params, &booking); err != nil {
+		return nil, err
+	}
+
+	return &booking, nil
+}
+
+// BookRoomType books a room of the type, the room is assigned later
+func (c *Client) BookRoomType(ctx context.Context, hotelID, roomTypeID primitive.ObjectID, params types.BookRoomParams) (*types.Booking, error) {
+	var booking types.Booking
+	path := "/api/v1/hotel/" + hotelID.Hex() + "/roomtype/" + roomTypeID.Hex() + "/book"
+	if err := c.do(ctx, http.MethodPost, path, nil, params, &booking); err != nil {
+		return nil, err
+	}
+
+	return &booking, nil
+}
+
+func (c *Client) GetBooking(ctx context.Context, id primitive.ObjectID) (*types.Booking, error) {
+	var booking types.Booking
+	if err := c.do(ctx, http.MethodGet, "/api/v1/booking/"+id.Hex(), nil, nil, &booking); err != nil {
+		return nil, err
+	}
+
+	return &booking, nil
+}
+
+func (c *Client) CancelBooking(ctx context.Context, id primitive.ObjectID) error {
+	return c.do(ctx, http.MethodGet, "/api/v1/booking/"+id.Hex()+"/cancel", nil, nil, nil)
+}
+
+func (c *Client) GetFolio(ctx context.Context, bookingID primitive.ObjectID) (*types.Folio, error) {
+	var folio types.Folio
+	if err := c.do(ctx, http.MethodGet, "/api/v1/booking/"+bookingID.Hex()+"/folio", nil, nil, &folio); err != nil {
+		return nil, err
+	}
+
+	return &folio, nil
+}
+
+// GetBookings lists the bookings of every user, it's for admins only
+func (c *Client) GetBookings(ctx context.Context, options *ListOptions) (*Page[types.Booking], error) {
+	return getPage[types.Booking](ctx, c, "/api/v1/admin/booking", options.values())
+}
+
+// Bookings iterates over every booking of the list, it's for admins only
+func (c *Client) Bookings(options *ListOptions) *Iterator[types.Booking] {
+	return newIterator[types.Booking](c, "/api/v1/admin/booking", options)
+}
@@ -0,0 +1,193 @@
+// Package client is a typed Go client of the hotel reservation API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rtsoy/hotel-reservation/types"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	tokenHeader          = "X-Api-Token"
+	idempotencyKeyHeader = "Idempotency-Key"
+	ifMatchHeader        = "If-Match"
+)
+
+type (
+	idempotencyKeyContextKey struct{}
+	versionContextKey        struct{}
+)
+
+// WithIdempotencyKey sends the POST requests made with the context with the Idempotency-Key,
+// retrying them with the same key replays the first response instead of e.g. booking twice
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// withVersion makes the writes sent with the context conditional on the version of their resource
+func withVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, versionContextKey{}, version)
+}
+
+// Doer sends HTTP requests, *http.Client implements it
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type Client struct {
+	baseURL string
+	doer    Doer
+
+	mu    sync.RWMutex
+	token string
+}
+
+type Option func(*Client)
+
+// WithDoer sends the requests of the client with the doer instead of http.DefaultClient
+func WithDoer(doer Doer) Option {
+	return func(c *Client) {
+		c.doer = doer
+	}
+}
+
+// WithToken authenticates the requests of the client with the API token
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New creates a client of the API served at the base URL, e.g. http://localhost:5000
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		doer:    http.DefaultClient,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// SetToken authenticates the following requests with the API token
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.token
+}
+
+// ErrorCode returns the errorCode of an API error, or an empty string for other errors
+func ErrorCode(err error) string {
+	var apiError types.APIError
+	if errors.As(err, &apiError) {
+		return apiError.ErrorCode
+	}
+
+	return ""
+}
+
+// IsNotFound reports whether the API answered that the resource doesn't exist
+func IsNotFound(err error) bool {
+	var apiError types.APIError
+	return errors.As(err, &apiError) && apiError.Code == http.StatusNotFound
+}
+
+// IsPreconditionFailed reports whether a write was refused because the resource was changed
+// since the version it was based on, the resource should be read again before retrying
+func IsPreconditionFailed(err error) bool {
+	var apiError types.APIError
+	return errors.As(err, &apiError) && apiError.Code == http.StatusPreconditionFailed
+}
+
+// do sends the request and decodes the JSON response into out, unless it's nil.
+// The path may have a query string. Error responses are returned as types.APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		target += separator + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.Token(); len(token) > 0 {
+		req.Header.Set(tokenHeader, token)
+	}
+	if key, ok := ctx.Value(idempotencyKeyContextKey{}).(string); ok && method == http.MethodPost {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	if version, ok := ctx.Value(versionContextKey{}).(int64); ok {
+		req.Header.Set(ifMatchHeader, strconv.Quote(strconv.FormatInt(version, 10)))
+	}
+
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response of %s %s: %w", method, path, err)
+	}
+
+	return nil
+}
+
+func decodeError(resp *http.Response) error {
+	apiError := types.APIError{}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil || json.Unmarshal(b, &apiError) != nil || len(apiError.Message) == 0 {
+		// Not an error of the API, e.g. of a proxy in between
+		apiError = types.NewAPIError(resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if apiError.Code == 0 {
+		apiError.Code = resp.StatusCode
+	}
+
+	return apiError
+}
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rtsoy/hotel-reservation/api"
+	myErrors "github.com/rtsoy/hotel-reservation/api/errors"
+	"github.com/rtsoy/hotel-reservation/currency"
+	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/db/fixtures"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/ratelimit"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// appDoer sends the requests of the client to the Fiber app without a network
+type appDoer struct {
+	app *fiber.App
+}
+
+func (d appDoer) Do(req *http.Request) (*http.Response, error) {
+	return d.app.Test(req, -1)
+}
+
+func setup(t *testing.T) (*db.Store, *Client) {
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(db.TestDBURI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := client.Database(db.TestDBNAME).Drop(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	store := db.NewMongoTestStore(client)
+	if err := store.EnsureIndexes(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: myErrors.ErrorHandler})
+	api.RegisterRoutes(app, store, currency.NewStaticRateProvider(types.DefaultCurrency, nil), payment.NewFakeProvider(""), nil, ratelimit.NewMemoryStore())
+
+	return store, New("http://localhost", WithDoer(appDoer{app: app}))
+}
+
+func TestClientBookAndCancel(t *testing.T) {
+	store, c := setup(t)
+	ctx := context.Background()
+
+	var (
+		user  = fixtures.AddUser(store, "James", "Harden", "jamesHarden13@example.com", "qwerty123", false)
+		hotel = fixtures.AddHotel(store, "testHotel", "Testestan", nil, 4)
+		room  = fixtures.AddRoom(store, "medium", true, 10000, hotel.ID)
+	)
+
+	if _, err := c.GetHotel(ctx, hotel.ID); ErrorCode(err) != types.CodeNoToken {
+		t.Fatalf("expected a %s error without a token but got %v", types.CodeNoToken, err)
+	}
+
+	auth, err := c.Authenticate(ctx, user.Email, "qwerty123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.User.ID != user.ID || c.Token() != auth.Token {
+		t.Fatalf("expected the client to be authenticated as %s", user.ID.Hex())
+	}
+
+	if _, err := c.GetHotel(ctx, primitive.NewObjectID()); !IsNotFound(err) {
+		t.Fatalf("expected a not found error but got %v", err)
+	}
+
+	params := types.BookRoomParams{
+		FromDate:   time.Now().AddDate(0, 0, 3).UTC(),
+		TillDate:   time.Now().AddDate(0, 0, 5).UTC(),
+		NumPersons: 2,
+	}
+
+	bookCtx := WithIdempotencyKey(ctx, "book-1")
+
+	booking, err := c.BookRoom(bookCtx, room.ID, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if booking.RoomID != room.ID || booking.UserID != user.ID {
+		t.Fatalf("expected a booking of room %s by user %s", room.ID.Hex(), user.ID.Hex())
+	}
+
+	// A retry with the same key gets the same booking instead of a second one
+	retried, err := c.BookRoom(bookCtx, room.ID, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.ID != booking.ID {
+		t.Fatalf("expected the retry to return booking %s but got %s", booking.ID.Hex(), retried.ID.Hex())
+	}
+
+	if err := c.CancelBooking(ctx, booking.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	booking, err = c.GetBooking(ctx, booking.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !booking.Canceled {
+		t.Fatalf("expected the booking to be canceled")
+	}
+
+	// The room is free again, so it can be booked once more
+	if _, err := c.BookRoom(ctx, room.ID, params); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.BookRoom(ctx, room.ID, types.BookRoomParams{})
+	if ErrorCode(err) != types.CodeValidationFailed {
+		t.Fatalf("expected a %s error but got %v", types.CodeValidationFailed, err)
+	}
+}
+
+func TestClientIteratesPages(t *testing.T) {
+	store, c := setup(t)
+	ctx := context.Background()
+
+	user := fixtures.AddUser(store, "James", "Harden", "jamesHarden13@example.com", "qwerty123", false)
+	hotel := fixtures.AddHotel(store, "testHotel", "Testestan", nil, 4)
+
+	expected := map[primitive.ObjectID]bool{}
+	for i := 0; i < 5; i++ {
+		room := fixtures.AddRoom(store, "medium", i%2 == 0, int64(10000+i*1000), hotel.ID)
+		expected[room.ID] = true
+	}
+
+	if _, err := c.Authenticate(ctx, user.Email, "qwerty123"); err != nil {
+		t.Fatal(err)
+	}
+
+	it := c.Rooms(&ListOptions{Limit: 2, Sort: []string{"-price"}})
+
+	var lastPrice int64
+	seen := 0
+	for it.Next(ctx) {
+		room := it.Item()
+		if !expected[room.ID] {
+			t.Fatalf("unexpected room %s", room.ID.Hex())
+		}
+		if seen > 0 && room.Price > lastPrice {
+			t.Fatalf("expected rooms sorted by price descending but %d came after %d", room.Price, lastPrice)
+		}
+
+		lastPrice = room.Price
+		seen++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if seen != len(expected) {
+		t.Fatalf("expected to iterate over %d rooms but got %d", len(expected), seen)
+	}
+}
+
+func TestClientUpdateUserVersion(t *testing.T) {
+	store, c := setup(t)
+	ctx := context.Background()
+
+	user := fixtures.AddUser(store, "James", "Harden", "jamesHarden13@example.com", "qwerty123", false)
+
+	if _, err := c.Authenticate(ctx, user.Email, "qwerty123"); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := c.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UpdateUser(ctx, user.ID, read.Version, types.UpdateUserParams{FirstName: "Jarden"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The version read before the update is stale now
+	err = c.UpdateUser(ctx, user.ID, read.Version, types.UpdateUserParams{LastName: "Hames"})
+	if !IsPreconditionFailed(err) {
+		t.Fatalf("expected a precondition failed error but got %v", err)
+	}
+}
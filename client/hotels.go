@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) GetHotels(ctx context.Context, options *ListOptions) (*Page[types.Hotel], error) {
+	return getPage[types.Hotel](ctx, c, "/api/v1/hotel", options.values())
+}
+
+// Hotels iterates over every hotel of the list
+func (c *Client) Hotels(options *ListOptions) *Iterator[types.Hotel] {
+	return newIterator[types.Hotel](c, "/api/v1/hotel", options)
+}
+
+func (c *Client) GetHotel(ctx context.Context, id primitive.ObjectID) (*types.Hotel, error) {
+	var hotel types.Hotel
+	if err := c.do(ctx, http.MethodGet, "/api/v1/hotel/"+id.Hex(), nil, nil, &hotel); err != nil {
+		return nil, err
+	}
+
+	return &hotel, nil
+}
+
+// SearchHotels finds the hotels best matching the query by name and location
+func (c *Client) SearchHotels(ctx context.Context, q string, limit int64) (*Page[types.HotelSearchResult], error) {
+	options := &ListOptions{
+		Limit:   limit,
+		Filters: url.Values{"q": {q}},
+	}
+
+	return getPage[types.HotelSearchResult](ctx, c, "/api/v1/hotel/search", options.values())
+}
+
+func (c *Client) GetHotelRooms(ctx context.Context, hotelID primitive.ObjectID, options *ListOptions) (*Page[types.Room], error) {
+	return getPage[types.Room](ctx, c, "/api/v1/hotel/"+hotelID.Hex()+"/rooms", options.values())
+}
+
+func (c *Client) GetHotelReviews(ctx context.Context, hotelID primitive.ObjectID, options *ListOptions) (*Page[types.Review], error) {
+	return getPage[types.Review](ctx, c, "/api/v1/hotel/"+hotelID.Hex()+"/reviews", options.values())
+}
+
+func (c *Client) GetRooms(ctx context.Context, options *ListOptions) (*Page[types.Room], error) {
+	return getPage[types.Room](ctx, c, "/api/v1/room", options.values())
+}
+
+// Rooms iterates over every room of the list
+func (c *Client) Rooms(options *ListOptions) *Iterator[types.Room] {
+	return newIterator[types.Room](c, "/api/v1/room", options)
+}
+
+func (c *Client) PostReview(ctx context.Context, params types.CreateReviewParams) (*types.Review, error) {
+	var review types.Review
+	if err := c.do(ctx, http.MethodPost, "/api/v1/review", nil, params, &review); err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ListOptions page and filter the lists of the API
+type ListOptions struct {
+	Limit int64
+	Page  int64
+	// Cursor continues the list from the next or prev link of a page, Page is ignored then
+	Cursor string
+	// CountTotal asks for the Total of the list, which takes a query of its own
+	CountTotal bool
+	// Sort lists the fields to sort by, descending when prefixed with "-"
+	Sort []string
+	// Filters are the other query parameters of the list, e.g. city or fromPrice
+	Filters url.Values
+}
+
+func (o *ListOptions) values() url.Values {
+	values := url.Values{}
+	if o == nil {
+		return values
+	}
+
+	for key, value := range o.Filters {
+		values[key] = append([]string(nil), value...)
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.FormatInt(o.Limit, 10))
+	}
+	if len(o.Cursor) > 0 {
+		values.Set("cursor", o.Cursor)
+	} else if o.Page > 0 {
+		values.Set("page", strconv.FormatInt(o.Page, 10))
+	}
+	if o.CountTotal {
+		values.Set("total", "true")
+	}
+	if len(o.Sort) > 0 {
+		values.Set("sort", strings.Join(o.Sort, ","))
+	}
+
+	return values
+}
+
+// Page is a page of a list
+type Page[T any] struct {
+	Results int   `json:"results"`
+	Page    int64 `json:"page"`
+	// Total is only set when the list was read with CountTotal
+	Total   *int64 `json:"total"`
+	HasMore bool   `json:"hasMore"`
+	// Next and Prev link the following and preceding pages
+	Next string `json:"next"`
+	Prev string `json:"prev"`
+	Data []*T   `json:"data"`
+
+	client *Client
+}
+
+// NextPage reads the page following this one, it returns nil when this page is the last one
+func (p *Page[T]) NextPage(ctx context.Context) (*Page[T], error) {
+	if len(p.Next) == 0 {
+		return nil, nil
+	}
+
+	return getPage[T](ctx, p.client, p.Next, nil)
+}
+
+// PrevPage reads the page preceding this one, it returns nil when this page is the first one
+func (p *Page[T]) PrevPage(ctx context.Context) (*Page[T], error) {
+	if len(p.Prev) == 0 {
+		return nil, nil
+	}
+
+	return getPage[T](ctx, p.client, p.Prev, nil)
+}
+
+func getPage[T any](ctx context.Context, c *Client, path string, query url.Values) (*Page[T], error) {
+	page := &Page[T]{client: c}
+	if err := c.do(ctx, http.MethodGet, path, query, nil, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Iterator walks through every item of a list, reading its pages as it goes:
+//
+//	it := c.Hotels(nil)
+//	for it.Next(ctx) {
+//		hotel := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	client *Client
+	path   string
+	query  url.Values
+
+	page  *Page[T]
+	index int
+	err   error
+}
+
+func newIterator[T any](c *Client, path string, options *ListOptions) *Iterator[T] {
+	return &Iterator[T]{
+		client: c,
+		path:   path,
+		query:  options.values(),
+		index:  -1,
+	}
+}
+
+// Next advances to the next item, it returns false when the list is over or reading it failed
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	for it.page == nil || it.index+1 >= len(it.page.Data) {
+		var page *Page[T]
+		if it.page == nil {
+			page, it.err = getPage[T](ctx, it.client, it.path, it.query)
+		} else {
+			page, it.err = it.page.NextPage(ctx)
+		}
+		if it.err != nil || page == nil {
+			return false
+		}
+
+		it.page = page
+		it.index = -1
+	}
+
+	it.index++
+
+	return true
+}
+
+// Item is the current item
+func (it *Iterator[T]) Item() *T {
+	if it.page == nil || it.index < 0 {
+		return nil
+	}
+
+	return it.page.Data[it.index]
+}
+
+// Err is the error reading the list failed with
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
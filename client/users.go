@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+type AuthResponse struct {
+	User  *types.User `json:"user"`
+	Token string      `json:"token"`
+}
+
+// Authenticate signs the user in, the following requests of the client are sent with their token
+func (c *Client) Authenticate(ctx context.Context, email, password string) (*AuthResponse, error) {
+	params := map[string]string{
+		"email":    email,
+		"password": password,
+	}
+
+	var response AuthResponse
+	if err := c.do(ctx, http.MethodPost, "/api/auth", nil, params, &response); err != nil {
+		return nil, err
+	}
+
+	c.SetToken(response.Token)
+
+	return &response, nil
+}
+
+func (c *Client) CreateUser(ctx context.Context, params types.CreateUserParams) (*types.User, error) {
+	var user types.User
+	if err := c.do(ctx, http.MethodPost, "/api/v1/user", nil, params, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, id primitive.ObjectID) (*types.User, error) {
+	var user types.User
+	if err := c.do(ctx, http.MethodGet, "/api/v1/user/"+id.Hex(), nil, nil, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (c *Client) GetUsers(ctx context.Context, options *ListOptions) (*Page[types.User], error) {
+	return getPage[types.User](ctx, c, "/api/v1/user", options.values())
+}
+
+// Users iterates over every user of the list
+func (c *Client) Users(options *ListOptions) *Iterator[types.User] {
+	return newIterator[types.User](c, "/api/v1/user", options)
+}
+
+// UpdateUser updates the user if it's still at the version, see IsPreconditionFailed
+func (c *Client) UpdateUser(ctx context.Context, id primitive.ObjectID, version int64, params types.UpdateUserParams) error {
+	return c.do(withVersion(ctx, version), http.MethodPut, "/api/v1/user/"+id.Hex(), nil, params, nil)
+}
+
+// DeleteUser deletes the user if it's still at the version, see IsPreconditionFailed
+func (c *Client) DeleteUser(ctx context.Context, id primitive.ObjectID, version int64) error {
+	return c.do(withVersion(ctx, version), http.MethodDelete, "/api/v1/user/"+id.Hex(), nil, nil, nil)
+}
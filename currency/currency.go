@@ -0,0 +1,120 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/rtsoy/hotel-reservation/types"
+	"math/big"
+	"os"
+)
+
+// RateProvider returns how many units of currency `to` one unit of currency `from` is worth
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (*big.Rat, error)
+}
+
+// StaticRateProvider serves rates relative to a single base currency loaded once
+type StaticRateProvider struct {
+	base  string
+	rates map[string]*big.Rat
+}
+
+// rateFile is the format of the exchange rates file, rates are decimal strings
+// to avoid float rounding, e.g. {"base": "USD", "rates": {"EUR": "0.9172"}}
+type rateFile struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+func NewStaticRateProvider(base string, rates map[string]*big.Rat) *StaticRateProvider {
+	if rates == nil {
+		rates = map[string]*big.Rat{}
+	}
+	rates[base] = big.NewRat(1, 1)
+
+	return &StaticRateProvider{
+		base:  base,
+		rates: rates,
+	}
+}
+
+func NewStaticRateProviderFromFile(path string) (*StaticRateProvider, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file rateFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, err
+	}
+
+	if !types.IsCurrencyValid(file.Base) {
+		return nil, fmt.Errorf("invalid base currency %q", file.Base)
+	}
+
+	rates := map[string]*big.Rat{}
+	for currency, value := range file.Rates {
+		if !types.IsCurrencyValid(currency) {
+			return nil, fmt.Errorf("invalid currency %q", currency)
+		}
+
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate %q for %s", value, currency)
+		}
+
+		rates[currency] = rate
+	}
+
+	return NewStaticRateProvider(file.Base, rates), nil
+}
+
+func (p *StaticRateProvider) Rate(ctx context.Context, from, to string) (*big.Rat, error) {
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return nil, fmt.Errorf("unsupported currency %s", from)
+	}
+
+	toRate, ok := p.rates[to]
+	if !ok {
+		return nil, fmt.Errorf("unsupported currency %s", to)
+	}
+
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
+
+// Convert converts money to another currency rounding half away from zero to minor units
+func Convert(ctx context.Context, provider RateProvider, money types.Money, to string) (types.Money, error) {
+	if money.Currency == to {
+		return money, nil
+	}
+
+	rate, err := provider.Rate(ctx, money.Currency, to)
+	if err != nil {
+		return types.Money{}, err
+	}
+
+	amount := new(big.Rat).Mul(new(big.Rat).SetInt64(money.Amount), rate)
+
+	return types.Money{
+		Amount:   round(amount),
+		Currency: to,
+	}, nil
+}
+
+func round(r *big.Rat) int64 {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quo.Neg(quo)
+	}
+
+	return quo.Int64()
+}
@@ -6,7 +6,6 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
@@ -38,12 +37,15 @@ func NewMongoTestBookingStore(client *mongo.Client) *MongoBookingStore {
 
 func (s *MongoBookingStore) UpdateBooking(ctx context.Context, filter bson.M, update bson.M) error {
 	res, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
 
 	if res.MatchedCount == 0 {
 		return mongo.ErrNoDocuments
 	}
 
-	return err
+	return nil
 }
 
 func (s *MongoBookingStore) GetBookingByID(ctx context.Context, oid primitive.ObjectID) (*types.Booking, error) {
@@ -59,11 +61,17 @@ type BookingQueryParams struct {
 	Pagination
 
 	UserID     primitive.ObjectID
+	HotelID    primitive.ObjectID
+	RoomTypeID primitive.ObjectID
 	RoomID     primitive.ObjectID
 	NumPersons int
 	FromDate   time.Time
 	TillDate   time.Time
 	Canceled   *bool
+	// LoyaltyPending narrows the bookings down to checked out ones the points aren't earned for yet
+	LoyaltyPending bool `query:"-"`
+	// Sort lists the fields to sort by, see bookingSortFields
+	Sort []string
 }
 
 func (s *MongoBookingStore) GetBookings(ctx context.Context, queryParams *BookingQueryParams, pagination *Pagination) ([]*types.Booking, error) {
@@ -81,6 +89,12 @@ func (s *MongoBookingStore) GetBookings(ctx context.Context, queryParams *Bookin
 	if queryParams.UserID.Hex() != "000000000000000000000000" {
 		filter["userID"] = queryParams.UserID
 	}
+	if queryParams.HotelID.Hex() != "000000000000000000000000" {
+		filter["hotelID"] = queryParams.HotelID
+	}
+	if queryParams.RoomTypeID.Hex() != "000000000000000000000000" {
+		filter["roomTypeID"] = queryParams.RoomTypeID
+	}
 	if queryParams.RoomID.Hex() != "000000000000000000000000" {
 		filter["roomID"] = queryParams.RoomID
 	}
@@ -108,26 +122,20 @@ func (s *MongoBookingStore) GetBookings(ctx context.Context, queryParams *Bookin
 	if queryParams.Canceled != nil {
 		filter["canceled"] = queryParams.Canceled
 	}
+	if queryParams.LoyaltyPending {
+		filter["loyaltyPending"] = true
+	}
 
-	opts := &options.FindOptions{}
-
-	opts.SetSkip((pagination.Page - 1) * pagination.Limit)
-	opts.SetLimit(pagination.Limit)
-
-	cur, err := s.collection.Find(ctx, filter, opts)
+	sort, err := parseSort(queryParams.Sort, bookingSortFields)
 	if err != nil {
 		return nil, err
 	}
 
-	var bookings []*types.Booking
-	if err := cur.All(ctx, &bookings); err != nil {
+	bookings, err := findPage[types.Booking](ctx, s.collection, matchStage(filter), sort, pagination)
+	if err != nil {
 		return nil, err
 	}
 
-	if len(bookings) == 0 {
-		return nil, mongo.ErrNoDocuments
-	}
-
 	return bookings, nil
 }
 
@@ -14,25 +14,56 @@ var (
 )
 
 const (
-	bookingCollection = "bookings"
-	hotelCollection   = "hotels"
-	roomCollection    = "rooms"
-	userCollection    = "users"
+	bookingCollection     = "bookings"
+	counterCollection     = "counters"
+	folioCollection       = "folios"
+	hotelCollection       = "hotels"
+	idempotencyCollection = "idempotencyKeys"
+	invoiceCollection     = "invoices"
+	loyaltyCollection     = "loyaltyTransactions"
+	promoCodeCollection   = "promoCodes"
+	restrictionCollection = "restrictions"
+	reviewCollection      = "reviews"
+	roomBlockCollection   = "roomBlocks"
+	roomCollection        = "rooms"
+	userCollection        = "users"
 
 	defaultPaginationPage  = 1
 	defaultPaginationLimit = 10
 )
 
+// Pagination pages the lists of the stores. Lists return an empty slice,
+// not mongo.ErrNoDocuments, when nothing matches.
 type Pagination struct {
 	Limit int64
 	Page  int64
+	// Cursor continues from the page it was returned with, Page is ignored then
+	Cursor string
+
+	// CountTotal asks the store to count every matching document into Total,
+	// it's a query of its own so clients ask for it with ?total=true
+	CountTotal bool `query:"total"`
+
+	// Set by the stores after reading a page
+	Total      int64  `query:"-"`
+	HasMore    bool   `query:"-"`
+	NextCursor string `query:"-"`
+	PrevCursor string `query:"-"`
 }
 
 type Store struct {
-	User    UserStore
-	Hotel   HotelStore
-	Room    RoomStore
-	Booking BookingStore
+	User        UserStore
+	Hotel       HotelStore
+	Room        RoomStore
+	Booking     BookingStore
+	Restriction RestrictionStore
+	RoomBlock   RoomBlockStore
+	PromoCode   PromoCodeStore
+	Folio       FolioStore
+	Invoice     InvoiceStore
+	Loyalty     LoyaltyStore
+	Review      ReviewStore
+	Idempotency IdempotencyStore
 }
 
 func init() {
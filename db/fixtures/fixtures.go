@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/rtsoy/hotel-reservation/db"
 	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"log"
 	"time"
@@ -17,6 +18,7 @@ func AddBooking(store *db.Store, userID, roomID primitive.ObjectID, numPersons i
 		FromDate:   fromDate,
 		TillDate:   tillDate,
 		Canceled:   cancelled,
+		Status:     types.BookingConfirmed,
 	}
 
 	insertBooking, err := store.Booking.InsertBooking(context.Background(), booking)
@@ -27,12 +29,51 @@ func AddBooking(store *db.Store, userID, roomID primitive.ObjectID, numPersons i
 	return insertBooking
 }
 
-func AddRoom(store *db.Store, size string, seaside bool, price float64, hotelID primitive.ObjectID) *types.Room {
+func AddPromoCode(store *db.Store, params types.CreatePromoCodeParams) *types.PromoCode {
+	promoCode := types.NewPromoCodeFromParams(params)
+
+	insertPromoCode, err := store.PromoCode.InsertPromoCode(context.Background(), promoCode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return insertPromoCode
+}
+
+func AddRestriction(store *db.Store, hotelID primitive.ObjectID, params types.CreateRestrictionParams) *types.Restriction {
+	restriction := types.NewRestrictionFromParams(hotelID, params)
+
+	insertRestriction, err := store.Restriction.InsertRestriction(context.Background(), restriction)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return insertRestriction
+}
+
+func AddRoomBlock(store *db.Store, room *types.Room, createdBy primitive.ObjectID, reason string, fromDate, tillDate time.Time) *types.RoomBlock {
+	block := types.NewRoomBlockFromParams(room, createdBy, types.CreateRoomBlockParams{
+		Reason:   reason,
+		FromDate: fromDate,
+		TillDate: tillDate,
+	})
+
+	insertBlock, err := store.RoomBlock.InsertRoomBlock(context.Background(), block)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return insertBlock
+}
+
+func AddRoom(store *db.Store, size string, seaside bool, price int64, hotelID primitive.ObjectID) *types.Room {
 	room := &types.Room{
-		Size:    size,
-		Seaside: seaside,
-		Price:   price,
-		HotelID: hotelID,
+		Size:               size,
+		Seaside:            seaside,
+		Price:              price,
+		HotelID:            hotelID,
+		Amenities:          []string{},
+		HousekeepingStatus: types.HousekeepingClean,
 	}
 
 	insertRoom, err := store.Room.InsertRoom(context.Background(), room)
@@ -43,6 +84,36 @@ func AddRoom(store *db.Store, size string, seaside bool, price float64, hotelID
 	return insertRoom
 }
 
+func AddRoomType(store *db.Store, hotelID primitive.ObjectID, name string, inventory int, price int64, rooms []*types.Room) *types.RoomType {
+	params := types.CreateRoomTypeParams{
+		Name:      name,
+		Inventory: inventory,
+		Price:     price,
+	}
+	for _, room := range rooms {
+		params.RoomIDs = append(params.RoomIDs, room.ID)
+	}
+
+	roomType := types.NewRoomTypeFromParams(params)
+
+	if err := store.Hotel.AddRoomType(context.Background(), hotelID, roomType); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, room := range rooms {
+		filter := bson.M{"_id": room.ID}
+		update := bson.M{"$set": bson.M{"roomTypeID": roomType.ID}}
+		if err := store.Room.UpdateRoom(context.Background(), filter, update); err != nil {
+			log.Fatal(err)
+		}
+
+		room.RoomTypeID = roomType.ID
+		room.Version++
+	}
+
+	return roomType
+}
+
 func AddHotel(store *db.Store, name, location string, rooms []primitive.ObjectID, rating int) *types.Hotel {
 	roomIDs := rooms
 	if rooms == nil {
@@ -50,10 +121,17 @@ func AddHotel(store *db.Store, name, location string, rooms []primitive.ObjectID
 	}
 
 	hotel := &types.Hotel{
-		Name:     name,
-		Location: location,
-		Rooms:    roomIDs,
-		Rating:   rating,
+		Name:      name,
+		Location:  location,
+		Rooms:     roomIDs,
+		RoomTypes: []types.RoomType{},
+		Rating:    rating,
+		Currency:  types.DefaultCurrency,
+		Taxes:     []types.Tax{},
+		Fees:      []types.Fee{},
+
+		Amenities:    []string{},
+		Descriptions: map[string]string{},
 	}
 
 	insertHotel, err := store.Hotel.InsertHotel(context.Background(), hotel)
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FolioStore interface {
+	InsertFolio(context.Context, *types.Folio) (*types.Folio, error)
+	GetFolioByBookingID(context.Context, primitive.ObjectID) (*types.Folio, error)
+	AddFolioLines(context.Context, primitive.ObjectID, ...types.FolioLine) error
+}
+
+type MongoFolioStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoFolioStore(client *mongo.Client) *MongoFolioStore {
+	return &MongoFolioStore{
+		client:     client,
+		collection: client.Database(DBNAME).Collection(folioCollection),
+	}
+}
+
+func NewMongoTestFolioStore(client *mongo.Client) *MongoFolioStore {
+	return &MongoFolioStore{
+		client:     client,
+		collection: client.Database(TestDBNAME).Collection(folioCollection),
+	}
+}
+
+// EnsureIndexes allows a single folio per booking
+func (s *MongoFolioStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "bookingID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
+
+// AddFolioLines appends the lines to the folio, lines are never changed once posted
+func (s *MongoFolioStore) AddFolioLines(ctx context.Context, oid primitive.ObjectID, lines ...types.FolioLine) error {
+	update := bson.M{
+		"$push": bson.M{
+			"lines": bson.M{
+				"$each": lines,
+			},
+		},
+	}
+
+	res, err := s.collection.UpdateByID(ctx, oid, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (s *MongoFolioStore) GetFolioByBookingID(ctx context.Context, bookingID primitive.ObjectID) (*types.Folio, error) {
+	var folio types.Folio
+	if err := s.collection.FindOne(ctx, bson.M{"bookingID": bookingID}).Decode(&folio); err != nil {
+		return nil, err
+	}
+
+	return &folio, nil
+}
+
+func (s *MongoFolioStore) InsertFolio(ctx context.Context, folio *types.Folio) (*types.Folio, error) {
+	res, err := s.collection.InsertOne(ctx, folio)
+	if err != nil {
+		return nil, err
+	}
+
+	folio.ID = res.InsertedID.(primitive.ObjectID)
+
+	return folio, nil
+}
@@ -0,0 +1,260 @@
+package db
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/search"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"sort"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	// maxFuzzyCandidates is the number of hotels compared with the query for typos
+	maxFuzzyCandidates = 5000
+	// fuzzyPrefixLength is the number of first letters of a term a word has to start with to be compared
+	fuzzyPrefixLength = 2
+)
+
+// Field weights of the relevance, a match in the name counts the most
+var searchFieldWeights = map[string]float64{
+	"name":         3,
+	"location":     2,
+	"address.city": 2,
+	"descriptions": 1,
+}
+
+type HotelSearchParams struct {
+	Q     string
+	Limit int64
+}
+
+// SearchHotels finds hotels by full-text search, case-insensitive prefixes
+// and, if that's not enough, names and locations spelled with typos.
+// Results are ordered by relevance.
+func (s *MongoHotelStore) SearchHotels(ctx context.Context, params *HotelSearchParams) ([]*types.HotelSearchResult, error) {
+	if params.Limit <= 0 {
+		params.Limit = defaultSearchLimit
+	}
+	if params.Limit > maxSearchLimit {
+		params.Limit = maxSearchLimit
+	}
+
+	textScores, err := s.searchText(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	hotels, err := s.searchPrefix(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := map[primitive.ObjectID]*types.Hotel{}
+	for _, hotel := range hotels {
+		candidates[hotel.ID] = hotel
+	}
+	for _, result := range textScores {
+		candidates[result.hotel.ID] = result.hotel
+	}
+
+	if int64(len(candidates)) < params.Limit {
+		hotels, err := s.searchFuzzy(ctx, params, candidates)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hotel := range hotels {
+			candidates[hotel.ID] = hotel
+		}
+	}
+
+	results := make([]*types.HotelSearchResult, 0, len(candidates))
+	for _, hotel := range candidates {
+		results = append(results, rankHotel(params.Q, hotel, textScores[hotel.ID].score))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+
+		return results[i].Hotel.Name < results[j].Hotel.Name
+	})
+
+	if int64(len(results)) > params.Limit {
+		results = results[:params.Limit]
+	}
+
+	return results, nil
+}
+
+type textSearchResult struct {
+	hotel *types.Hotel
+	score float64
+}
+
+func (s *MongoHotelStore) searchText(ctx context.Context, params *HotelSearchParams) (map[primitive.ObjectID]textSearchResult, error) {
+	meta := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"textScore": meta}).
+		SetSort(bson.M{"textScore": meta}).
+		SetLimit(params.Limit)
+
+	cur, err := s.collection.Find(ctx, bson.M{"$text": bson.M{"$search": params.Q}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		types.Hotel `bson:",inline"`
+		TextScore   float64 `bson:"textScore"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	results := make(map[primitive.ObjectID]textSearchResult, len(docs))
+	for i := range docs {
+		results[docs[i].ID] = textSearchResult{
+			hotel: &docs[i].Hotel,
+			score: docs[i].TextScore,
+		}
+	}
+
+	return results, nil
+}
+
+// searchPrefix matches words of the name and location starting with the query, ignoring case
+func (s *MongoHotelStore) searchPrefix(ctx context.Context, params *HotelSearchParams) ([]*types.Hotel, error) {
+	regex := primitive.Regex{
+		Pattern: `(^|\s)` + regexp.QuoteMeta(params.Q),
+		Options: "i",
+	}
+
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"name": regex},
+			bson.M{"location": regex},
+			bson.M{"address.city": regex},
+		},
+	}
+
+	cur, err := s.collection.Find(ctx, filter, options.Find().SetLimit(params.Limit))
+	if err != nil {
+		return nil, err
+	}
+
+	var hotels []*types.Hotel
+	if err := cur.All(ctx, &hotels); err != nil {
+		return nil, err
+	}
+
+	return hotels, nil
+}
+
+// searchFuzzy compares the names and locations of hotels with the query in Go,
+// tolerating a few typos, and loads the hotels that were not found yet.
+// Only hotels with words starting like every term are compared, found on the
+// searchTerms index, so typos in the first letters are not tolerated.
+func (s *MongoHotelStore) searchFuzzy(ctx context.Context, params *HotelSearchParams, found map[primitive.ObjectID]*types.Hotel) ([]*types.Hotel, error) {
+	terms := search.Tokenize(params.Q)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	prefixes := make(bson.A, 0, len(terms))
+	for _, term := range terms {
+		if runes := []rune(term); len(runes) > fuzzyPrefixLength {
+			term = string(runes[:fuzzyPrefixLength])
+		}
+		prefixes = append(prefixes, primitive.Regex{Pattern: "^" + regexp.QuoteMeta(term)})
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"name": 1, "location": 1, "address.city": 1}).
+		SetLimit(maxFuzzyCandidates)
+
+	cur, err := s.collection.Find(ctx, bson.M{"searchTerms": bson.M{"$all": prefixes}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*types.Hotel
+	if err := cur.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	ids := bson.A{}
+	for _, candidate := range candidates {
+		if _, ok := found[candidate.ID]; ok {
+			continue
+		}
+		if int64(len(found)+len(ids)) >= params.Limit {
+			break
+		}
+
+		text := candidate.Name + " " + candidate.Location + " " + candidate.Address.City
+		if search.Score(params.Q, text) > 0 {
+			ids = append(ids, candidate.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cur, err = s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	var hotels []*types.Hotel
+	if err := cur.All(ctx, &hotels); err != nil {
+		return nil, err
+	}
+
+	return hotels, nil
+}
+
+// rankHotel scores the best matching field of the hotel by its weight, the full-text
+// score breaks ties, and highlights the matches in every field
+func rankHotel(query string, hotel *types.Hotel, textScore float64) *types.HotelSearchResult {
+	fields := map[string]string{
+		"name":         hotel.Name,
+		"location":     hotel.Location,
+		"address.city": hotel.Address.City,
+	}
+	for language, description := range hotel.Descriptions {
+		fields["descriptions."+language] = description
+	}
+
+	result := &types.HotelSearchResult{
+		Hotel:      hotel,
+		Score:      textScore / 100,
+		Highlights: map[string]string{},
+	}
+
+	var best float64
+	for field, text := range fields {
+		weight, ok := searchFieldWeights[field]
+		if !ok {
+			weight = searchFieldWeights["descriptions"]
+		}
+
+		if score := weight * search.Score(query, text); score > best {
+			best = score
+		}
+		if highlighted, ok := search.Highlight(query, text); ok {
+			result.Highlights[field] = highlighted
+		}
+	}
+
+	result.Score += best
+
+	return result
+}
@@ -2,18 +2,24 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"github.com/rtsoy/hotel-reservation/search"
 	"github.com/rtsoy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
 )
 
 type HotelStore interface {
 	InsertHotel(context.Context, *types.Hotel) (*types.Hotel, error)
 	UpdateHotel(context.Context, bson.M, bson.M) error
+	AddRoomType(context.Context, primitive.ObjectID, *types.RoomType) error
 	GetHotels(context.Context, *HotelQueryParams, *Pagination) ([]*types.Hotel, error)
 	GetHotelByID(context.Context, primitive.ObjectID) (*types.Hotel, error)
+	GetHotelsByIDs(context.Context, []primitive.ObjectID) ([]*types.Hotel, error)
+	SearchHotels(context.Context, *HotelSearchParams) ([]*types.HotelSearchResult, error)
 }
 
 type MongoHotelStore struct {
@@ -43,12 +49,98 @@ func (s *MongoHotelStore) GetHotelByID(ctx context.Context, oid primitive.Object
 	return &hotel, nil
 }
 
+// GetHotelsByIDs reads the hotels of the IDs at once, see findByIDs
+func (s *MongoHotelStore) GetHotelsByIDs(ctx context.Context, oids []primitive.ObjectID) ([]*types.Hotel, error) {
+	return findByIDs[types.Hotel](ctx, s.collection, oids)
+}
+
 type HotelQueryParams struct {
 	Pagination
 
-	Rating   int
-	Name     string
-	Location string
+	Rating         int
+	Name           string
+	Location       string
+	MinReviewScore float64
+	City           string
+	Country        string
+	Amenities      []string
+	PetsAllowed    *bool
+	SmokingAllowed *bool
+	// Language narrows the search down to hotels described in the language
+	Language string
+	// Sort lists the fields to sort by, see hotelSortFields
+	Sort []string
+	// SortByReviewScore orders the best rated hotels first when no Sort is given
+	SortByReviewScore bool
+
+	// Lat and Lng search for hotels around the point, closest first,
+	// within RadiusKm when it's set
+	Lat      *float64
+	Lng      *float64
+	RadiusKm float64
+	// BBox is the bounding box minLng,minLat,maxLng,maxLat
+	BBox []float64 `query:"bbox"`
+}
+
+// Validate checks the params the filter can't use as they are,
+// e.g. the language is part of a field path, so it can't be anything but a code
+func (p HotelQueryParams) Validate() error {
+	ve := &types.ValidationError{}
+
+	if len(p.Language) > 0 && !types.IsLanguageValid(p.Language) {
+		ve.Add("language", types.ViolationInvalid, "language should be an ISO 639-1 code")
+	}
+	if (p.Lat == nil) != (p.Lng == nil) {
+		ve.Add("lat", types.ViolationRequired, "lat and lng should be given together")
+	}
+	if p.Lat != nil && (*p.Lat < -90 || *p.Lat > 90) {
+		ve.Add("lat", types.ViolationOutOfRange, "lat should be between -90 and 90")
+	}
+	if p.Lng != nil && (*p.Lng < -180 || *p.Lng > 180) {
+		ve.Add("lng", types.ViolationOutOfRange, "lng should be between -180 and 180")
+	}
+	if p.RadiusKm < 0 || (p.RadiusKm > 0 && !p.IsProximitySearch()) {
+		ve.Add("radiusKm", types.ViolationInvalid, "radiusKm should be positive and given with lat and lng")
+	}
+	if len(p.BBox) != 0 && len(p.BBox) != 4 {
+		ve.Add("bbox", types.ViolationInvalid, "bbox should be minLng,minLat,maxLng,maxLat")
+	}
+	if len(p.BBox) == 4 {
+		minLng, minLat, maxLng, maxLat := p.BBox[0], p.BBox[1], p.BBox[2], p.BBox[3]
+		if minLng < -180 || maxLng > 180 || minLat < -90 || maxLat > 90 {
+			ve.Add("bbox", types.ViolationOutOfRange, "bbox longitudes should be between -180 and 180 and latitudes between -90 and 90")
+		} else if minLng >= maxLng || minLat >= maxLat {
+			ve.Add("bbox", types.ViolationInvalid, "bbox should be minLng,minLat,maxLng,maxLat with the minimums below the maximums")
+		}
+	}
+
+	return ve.Err()
+}
+
+// bboxPolygon turns minLng,minLat,maxLng,maxLat into a counterclockwise GeoJSON
+// polygon. The strict winding CRS lets the box cover more than a hemisphere
+func bboxPolygon(bbox []float64) bson.M {
+	minLng, minLat, maxLng, maxLat := bbox[0], bbox[1], bbox[2], bbox[3]
+
+	return bson.M{
+		"type": "Polygon",
+		"coordinates": bson.A{bson.A{
+			bson.A{minLng, minLat},
+			bson.A{maxLng, minLat},
+			bson.A{maxLng, maxLat},
+			bson.A{minLng, maxLat},
+			bson.A{minLng, minLat},
+		}},
+		"crs": bson.M{
+			"type":       "name",
+			"properties": bson.M{"name": "urn:x-mongodb:crs:strictwinding:EPSG:4326"},
+		},
+	}
+}
+
+// IsProximitySearch reports whether the hotels are searched around a point
+func (p HotelQueryParams) IsProximitySearch() bool {
+	return p.Lat != nil && p.Lng != nil
 }
 
 func (s *MongoHotelStore) GetHotels(ctx context.Context, queryParams *HotelQueryParams, pagination *Pagination) ([]*types.Hotel, error) {
@@ -72,40 +164,238 @@ func (s *MongoHotelStore) GetHotels(ctx context.Context, queryParams *HotelQuery
 	if len(queryParams.Location) > 1 {
 		filter["location"] = queryParams.Location
 	}
+	if len(queryParams.City) > 0 {
+		filter["address.city"] = queryParams.City
+	}
+	if len(queryParams.Country) > 0 {
+		filter["address.country"] = queryParams.Country
+	}
+	if len(queryParams.Amenities) > 0 {
+		filter["amenities"] = bson.M{
+			"$all": queryParams.Amenities,
+		}
+	}
+	if queryParams.PetsAllowed != nil {
+		filter["policies.petsAllowed"] = *queryParams.PetsAllowed
+	}
+	if queryParams.SmokingAllowed != nil {
+		filter["policies.smokingAllowed"] = *queryParams.SmokingAllowed
+	}
+	if len(queryParams.Language) > 0 {
+		filter["descriptions."+queryParams.Language] = bson.M{
+			"$exists": true,
+		}
+	}
+	if queryParams.MinReviewScore > 0 {
+		filter["reviewScore"] = bson.M{
+			"$gte": queryParams.MinReviewScore,
+		}
+	}
+
+	if len(queryParams.BBox) == 4 {
+		filter["geo"] = bson.M{
+			"$geoWithin": bson.M{
+				"$geometry": bboxPolygon(queryParams.BBox),
+			},
+		}
+	}
 
-	opts := &options.FindOptions{}
+	sort, err := parseSort(queryParams.Sort, hotelSortFields)
+	if err != nil {
+		return nil, err
+	}
+	if sort == nil && queryParams.SortByReviewScore {
+		sort = bson.D{{Key: "reviewScore", Value: -1}, {Key: "reviewCount", Value: -1}, {Key: "_id", Value: 1}}
+	}
+	if sortsBy(sort, "distanceKm") && !queryParams.IsProximitySearch() {
+		return nil, fmt.Errorf("%w: distance needs lat and lng", ErrInvalidSort)
+	}
 
-	opts.SetSkip((pagination.Page - 1) * pagination.Limit)
-	opts.SetLimit(pagination.Limit)
+	pipeline := matchStage(filter)
+	if queryParams.IsProximitySearch() {
+		pipeline = mongo.Pipeline{
+			{{Key: "$geoNear", Value: s.geoNear(queryParams, filter)}},
+		}
+		// Hotels are sorted by distance unless another order is asked
+		if sort == nil {
+			sort = bson.D{{Key: "distanceKm", Value: 1}, {Key: "_id", Value: 1}}
+		}
+	}
 
-	cur, err := s.collection.Find(ctx, filter, opts)
+	hotels, err := findPage[types.Hotel](ctx, s.collection, pipeline, sort, pagination)
 	if err != nil {
 		return nil, err
 	}
 
+	return hotels, nil
+}
+
+// geoNear sorts the hotels matching the filter by distance from the point of the query
+// and adds their distance in kilometers
+func (s *MongoHotelStore) geoNear(queryParams *HotelQueryParams, filter bson.M) bson.M {
+	geoNear := bson.M{
+		"near":               types.NewGeoPoint(*queryParams.Lat, *queryParams.Lng),
+		"distanceField":      "distanceKm",
+		"distanceMultiplier": 0.001,
+		"spherical":          true,
+		"key":                "geo",
+		"query":              filter,
+	}
+	if queryParams.RadiusKm > 0 {
+		geoNear["maxDistance"] = queryParams.RadiusKm * 1000
+	}
+
+	return geoNear
+}
+
+// searchIndexName is the name of the text index, a collection can only have one
+const searchIndexName = "hotel_search"
+
+// EnsureIndexes creates the indexes hotel searches rely on, replacing an outdated
+// text index, and fills the search fields of hotels stored before they existed
+func (s *MongoHotelStore) EnsureIndexes(ctx context.Context) error {
+	specs, err := s.collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if _, err := spec.KeysDocument.LookupErr("_fts"); err == nil && spec.Name != searchIndexName {
+			if _, err := s.collection.Indexes().DropOne(ctx, spec.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "geo", Value: "2dsphere"}},
+		},
+		{
+			// No language is set, words are not stemmed in any language
+			Keys: bson.D{
+				{Key: "name", Value: "text"},
+				{Key: "location", Value: "text"},
+				{Key: "address.city", Value: "text"},
+				{Key: "searchDescriptions", Value: "text"},
+			},
+			Options: options.Index().
+				SetName(searchIndexName).
+				SetDefaultLanguage("none").
+				SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "location", Value: 5}, {Key: "address.city", Value: 5}}),
+		},
+		{
+			Keys: bson.D{{Key: "searchTerms", Value: 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	cur, err := s.collection.Find(ctx, bson.M{"searchTerms": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+
 	var hotels []*types.Hotel
 	if err := cur.All(ctx, &hotels); err != nil {
-		return nil, err
+		return err
 	}
 
-	if len(hotels) == 0 {
-		return nil, mongo.ErrNoDocuments
+	for _, hotel := range hotels {
+		if err := s.updateSearchFields(ctx, hotel); err != nil {
+			return err
+		}
 	}
 
-	return hotels, nil
+	return nil
 }
 
+// UpdateHotel bumps the version of the hotel, a filter with MatchVersion makes the update version-checked
 func (s *MongoHotelStore) UpdateHotel(ctx context.Context, filter bson.M, update bson.M) error {
-	res, err := s.collection.UpdateOne(ctx, filter, update)
+	if err := updateVersioned(ctx, s.collection, filter, update); err != nil {
+		return err
+	}
 
-	if res.MatchedCount == 0 {
-		return mongo.ErrNoDocuments
+	if !updatesSearchedFields(update) {
+		return nil
 	}
 
+	hotel, err := s.GetHotelByID(ctx, filter["_id"].(primitive.ObjectID))
+	if err != nil {
+		return err
+	}
+
+	return s.updateSearchFields(ctx, hotel)
+}
+
+// AddRoomType appends the room type to the hotel. Hotels created before room types
+// have no roomTypes or a null one, $push fails on null, so it's made an empty array first.
+func (s *MongoHotelStore) AddRoomType(ctx context.Context, hotelID primitive.ObjectID, roomType *types.RoomType) error {
+	filter := bson.M{"_id": hotelID, "roomTypes": nil}
+	update := bson.M{"$set": bson.M{"roomTypes": bson.A{}}}
+	if _, err := s.collection.UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+
+	return updateVersioned(ctx, s.collection, bson.M{"_id": hotelID}, bson.M{"$push": bson.M{"roomTypes": roomType}})
+}
+
+// updatesSearchedFields reports whether the update changes a field the search fields are made of
+func updatesSearchedFields(update bson.M) bool {
+	set, ok := update["$set"].(bson.M)
+	if !ok {
+		return false
+	}
+
+	for key := range set {
+		field, _, _ := strings.Cut(key, ".")
+		switch field {
+		case "name", "location", "address", "descriptions":
+			return true
+		}
+	}
+
+	return false
+}
+
+// setSearchFields fills the fields of the hotel the search indexes are built on
+func setSearchFields(hotel *types.Hotel) {
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, term := range search.Tokenize(hotel.Name + " " + hotel.Location + " " + hotel.Address.City) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	descriptions := make([]string, 0, len(hotel.Descriptions))
+	for _, description := range hotel.Descriptions {
+		descriptions = append(descriptions, description)
+	}
+
+	hotel.SearchTerms = terms
+	hotel.SearchDescriptions = descriptions
+}
+
+// updateSearchFields stores the search fields of the hotel
+func (s *MongoHotelStore) updateSearchFields(ctx context.Context, hotel *types.Hotel) error {
+	setSearchFields(hotel)
+
+	update := bson.M{
+		"$set": bson.M{
+			"searchTerms":        hotel.SearchTerms,
+			"searchDescriptions": hotel.SearchDescriptions,
+		},
+	}
+	_, err := s.collection.UpdateByID(ctx, hotel.ID, update)
+
 	return err
 }
 
 func (s *MongoHotelStore) InsertHotel(ctx context.Context, hotel *types.Hotel) (*types.Hotel, error) {
+	setSearchFields(hotel)
+
 	res, err := s.collection.InsertOne(ctx, hotel)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	// DefaultIdempotencyKeyTTL is how long responses are kept for retries when no window is configured
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+	// DefaultIdempotencyKeyLease is how long a request holds its key when no lease is configured,
+	// it should outlast the slowest request
+	DefaultIdempotencyKeyLease = time.Minute
+)
+
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(context.Context, *types.IdempotencyRecord) (*types.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, record *types.IdempotencyRecord, statusCode int, contentType string, body []byte) error
+	DeleteIdempotencyKey(context.Context, *types.IdempotencyRecord) error
+}
+
+type MongoIdempotencyStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+	ttl        time.Duration
+	lease      time.Duration
+}
+
+// NewMongoIdempotencyStore keeps the responses of idempotent requests for ttl and
+// lets retries take over keys of requests that didn't complete within lease.
+// DefaultIdempotencyKeyTTL and DefaultIdempotencyKeyLease are used when they are not positive.
+func NewMongoIdempotencyStore(client *mongo.Client, ttl, lease time.Duration) *MongoIdempotencyStore {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyKeyTTL
+	}
+	if lease <= 0 {
+		lease = DefaultIdempotencyKeyLease
+	}
+
+	return &MongoIdempotencyStore{
+		client:     client,
+		collection: client.Database(DBNAME).Collection(idempotencyCollection),
+		ttl:        ttl,
+		lease:      lease,
+	}
+}
+
+func NewMongoTestIdempotencyStore(client *mongo.Client, ttl, lease time.Duration) *MongoIdempotencyStore {
+	store := NewMongoIdempotencyStore(client, ttl, lease)
+	store.collection = client.Database(TestDBNAME).Collection(idempotencyCollection)
+
+	return store
+}
+
+// EnsureIndexes makes keys unique per user and lets MongoDB remove expired keys
+func (s *MongoIdempotencyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+
+	return err
+}
+
+// ReserveIdempotencyKey stores the record of a new request, unless its key was used before.
+// The record of the earlier request is returned then, and nil when the key is reserved.
+// A retry reserves the key of the same request again once its lease ran out without a response.
+func (s *MongoIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, record *types.IdempotencyRecord) (*types.IdempotencyRecord, error) {
+	// MongoDB keeps milliseconds, the lease is compared with the stored one later
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	// Expired keys are free again, even before the TTL monitor removes them
+	expired := bson.M{
+		"userID":    record.UserID,
+		"key":       record.Key,
+		"expiresAt": bson.M{"$lte": now},
+	}
+	if _, err := s.collection.DeleteMany(ctx, expired); err != nil {
+		return nil, err
+	}
+
+	record.ID = primitive.NilObjectID
+	record.Completed = false
+	record.CreatedAt = now
+	record.ExpiresAt = now.Add(s.ttl)
+	record.LockedUntil = now.Add(s.lease)
+
+	res, err := s.collection.InsertOne(ctx, record)
+	if err == nil {
+		record.ID = res.InsertedID.(primitive.ObjectID)
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	// Keys reserved before leases were introduced have no lockedUntil and are taken over as well
+	abandoned := bson.M{
+		"userID":      record.UserID,
+		"key":         record.Key,
+		"requestHash": record.RequestHash,
+		"completed":   false,
+		"lockedUntil": bson.M{"$not": bson.M{"$gt": now}},
+	}
+	update := bson.M{"$set": bson.M{"lockedUntil": record.LockedUntil}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var existing types.IdempotencyRecord
+	err = s.collection.FindOneAndUpdate(ctx, abandoned, update, opts).Decode(&existing)
+	if err == nil {
+		record.ID = existing.ID
+		record.CreatedAt = existing.CreatedAt
+		record.ExpiresAt = existing.ExpiresAt
+		return nil, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	filter := bson.M{"userID": record.UserID, "key": record.Key}
+	if err := s.collection.FindOne(ctx, filter).Decode(&existing); err != nil {
+		return nil, err
+	}
+
+	return &existing, nil
+}
+
+// leaseFilter matches the record while its request still holds the key,
+// the request a retry took the key over from can't complete or free it anymore
+func leaseFilter(record *types.IdempotencyRecord) bson.M {
+	return bson.M{
+		"_id":         record.ID,
+		"completed":   false,
+		"lockedUntil": record.LockedUntil,
+	}
+}
+
+// CompleteIdempotencyKey stores the response to the request of the key
+func (s *MongoIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, record *types.IdempotencyRecord, statusCode int, contentType string, body []byte) error {
+	update := bson.M{
+		"$set": bson.M{
+			"completed":   true,
+			"statusCode":  statusCode,
+			"contentType": contentType,
+			"body":        body,
+		},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, leaseFilter(record), update)
+
+	return err
+}
+
+// DeleteIdempotencyKey frees the key, so the request can be retried
+func (s *MongoIdempotencyStore) DeleteIdempotencyKey(ctx context.Context, record *types.IdempotencyRecord) error {
+	_, err := s.collection.DeleteOne(ctx, leaseFilter(record))
+
+	return err
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type InvoiceStore interface {
+	InsertInvoice(context.Context, *types.Invoice) (*types.Invoice, error)
+	GetInvoices(context.Context, *InvoiceQueryParams, *Pagination) ([]*types.Invoice, error)
+	UpdateInvoice(context.Context, bson.M, bson.M) error
+	NextInvoiceNumber(context.Context, primitive.ObjectID) (int64, error)
+}
+
+type MongoInvoiceStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func NewMongoInvoiceStore(client *mongo.Client) *MongoInvoiceStore {
+	return &MongoInvoiceStore{
+		client:     client,
+		collection: client.Database(DBNAME).Collection(invoiceCollection),
+		counters:   client.Database(DBNAME).Collection(counterCollection),
+	}
+}
+
+func NewMongoTestInvoiceStore(client *mongo.Client) *MongoInvoiceStore {
+	return &MongoInvoiceStore{
+		client:     client,
+		collection: client.Database(TestDBNAME).Collection(invoiceCollection),
+		counters:   client.Database(TestDBNAME).Collection(counterCollection),
+	}
+}
+
+// EnsureIndexes keeps concurrent requests from issuing the same revision of the invoice of a booking twice
+func (s *MongoInvoiceStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "bookingID", Value: 1}, {Key: "revision", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"revision": bson.M{"$exists": true}}),
+	})
+
+	return err
+}
+
+// NextInvoiceNumber atomically increments the invoice counter of the hotel, so invoices and
+// credit notes of a hotel are numbered without duplicates. A number is lost when the invoice
+// it was taken for is not stored.
+func (s *MongoInvoiceStore) NextInvoiceNumber(ctx context.Context, hotelID primitive.ObjectID) (int64, error) {
+	filter := bson.M{"_id": "invoice:" + hotelID.Hex()}
+	update := bson.M{
+		"$inc": bson.M{
+			"seq": 1,
+		},
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	if err := s.counters.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter); err != nil {
+		return 0, err
+	}
+
+	return counter.Seq, nil
+}
+
+func (s *MongoInvoiceStore) UpdateInvoice(ctx context.Context, filter bson.M, update bson.M) error {
+	res, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+type InvoiceQueryParams struct {
+	Pagination
+
+	HotelID   primitive.ObjectID
+	BookingID primitive.ObjectID
+	Kind      string
+}
+
+// GetInvoices returns the invoices ordered from the latest issued
+func (s *MongoInvoiceStore) GetInvoices(ctx context.Context, queryParams *InvoiceQueryParams, pagination *Pagination) ([]*types.Invoice, error) {
+	// Default Pagination Values
+	if pagination.Page == 0 {
+		pagination.Page = int64(defaultPaginationPage)
+	}
+	if pagination.Limit == 0 {
+		pagination.Limit = int64(defaultPaginationLimit)
+	}
+
+	// Check for empty values in filter
+	filter := bson.M{}
+
+	if !queryParams.HotelID.IsZero() {
+		filter["hotelID"] = queryParams.HotelID
+	}
+	if !queryParams.BookingID.IsZero() {
+		filter["bookingID"] = queryParams.BookingID
+	}
+	if len(queryParams.Kind) > 0 {
+		filter["kind"] = queryParams.Kind
+	}
+
+	invoices, err := findPage[types.Invoice](ctx, s.collection, matchStage(filter), bson.D{{Key: "issuedAt", Value: -1}, {Key: "_id", Value: -1}}, pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+func (s *MongoInvoiceStore) InsertInvoice(ctx context.Context, invoice *types.Invoice) (*types.Invoice, error) {
+	res, err := s.collection.InsertOne(ctx, invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice.ID = res.InsertedID.(primitive.ObjectID)
+
+	return invoice, nil
+}
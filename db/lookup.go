@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// findByIDs reads the documents of the IDs with a single query, in no particular order.
+// IDs that don't exist are skipped, so the result may be shorter than ids.
+func findByIDs[T any](ctx context.Context, coll *mongo.Collection, ids []primitive.ObjectID) ([]*T, error) {
+	docs := []*T{}
+	if len(ids) == 0 {
+		return docs, nil
+	}
+
+	cur, err := coll.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+var ErrInsufficientLoyaltyPoints = errors.New("insufficient loyalty points")
+
+// pendingLoyaltyField lists, on the user, the ledger entries applied to the balance
+// but not marked as applied yet, so applying an entry again changes nothing
+const pendingLoyaltyField = "pendingLoyaltyTransactions"
+
+// LoyaltyStore keeps the ledger of loyalty transactions together
+// with the balance cached on the user
+type LoyaltyStore interface {
+	RecordTransaction(context.Context, *types.LoyaltyTransaction) (*types.LoyaltyTransaction, error)
+	ApplyPendingTransactions(ctx context.Context, olderThan time.Duration) error
+	GetTransactions(context.Context, *LoyaltyQueryParams, *Pagination) ([]*types.LoyaltyTransaction, error)
+}
+
+type MongoLoyaltyStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+	users      *mongo.Collection
+}
+
+func NewMongoLoyaltyStore(client *mongo.Client) *MongoLoyaltyStore {
+	return &MongoLoyaltyStore{
+		client:     client,
+		collection: client.Database(DBNAME).Collection(loyaltyCollection),
+		users:      client.Database(DBNAME).Collection(userCollection),
+	}
+}
+
+func NewMongoTestLoyaltyStore(client *mongo.Client) *MongoLoyaltyStore {
+	return &MongoLoyaltyStore{
+		client:     client,
+		collection: client.Database(TestDBNAME).Collection(loyaltyCollection),
+		users:      client.Database(TestDBNAME).Collection(userCollection),
+	}
+}
+
+// EnsureIndexes makes every type of transaction happen once per booking,
+// e.g. points are earned once for a stay however often the earning is retried
+func (s *MongoLoyaltyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "bookingID", Value: 1}, {Key: "type", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"bookingID": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: "pending", Value: 1}, {Key: "createdAt", Value: 1}},
+		},
+	})
+
+	return err
+}
+
+// RecordTransaction appends the transaction to the ledger and applies it to the balance of the user.
+// The entry is written first and stays pending until it's applied, so a failure in between leaves
+// an entry ApplyPendingTransactions finishes rather than a balance without its entry.
+// Burns are part of the update filter, so the balance can never become negative,
+// and only earned points count towards the lifetime points that decide the tier.
+func (s *MongoLoyaltyStore) RecordTransaction(ctx context.Context, transaction *types.LoyaltyTransaction) (*types.LoyaltyTransaction, error) {
+	transaction.Pending = true
+
+	res, err := s.collection.InsertOne(ctx, transaction)
+	if err != nil {
+		return nil, err
+	}
+	transaction.ID = res.InsertedID.(primitive.ObjectID)
+
+	if err := s.apply(ctx, transaction); err != nil {
+		return nil, err
+	}
+	transaction.Pending = false
+
+	return transaction, nil
+}
+
+// ApplyPendingTransactions applies the ledger entries left pending for longer than olderThan,
+// e.g. by a crash between writing an entry and applying it
+func (s *MongoLoyaltyStore) ApplyPendingTransactions(ctx context.Context, olderThan time.Duration) error {
+	filter := bson.M{
+		"pending":   true,
+		"createdAt": bson.M{"$lt": time.Now().UTC().Add(-olderThan)},
+	}
+
+	cur, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var transactions []*types.LoyaltyTransaction
+	if err := cur.All(ctx, &transactions); err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		err := s.apply(ctx, transaction)
+		if err != nil && !errors.Is(err, ErrInsufficientLoyaltyPoints) && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply changes the balance of the user by the pending transaction once, then marks it as applied.
+// Each step can be repeated, so an entry can be applied again after any of them failed.
+func (s *MongoLoyaltyStore) apply(ctx context.Context, transaction *types.LoyaltyTransaction) error {
+	filter := bson.M{
+		"_id":               transaction.UserID,
+		pendingLoyaltyField: bson.M{"$ne": transaction.ID},
+	}
+	inc := bson.M{
+		"loyaltyPoints": transaction.Points,
+	}
+
+	if transaction.Points < 0 {
+		filter["loyaltyPoints"] = bson.M{
+			"$gte": -transaction.Points,
+		}
+	}
+	if transaction.Type == types.LoyaltyEarn {
+		inc["lifetimePoints"] = transaction.Points
+	}
+
+	// The balance isn't part of what the user edits, so it doesn't bump the version of the user
+	// and doesn't make writes based on the version read before fail
+	update := bson.M{
+		"$inc":  inc,
+		"$push": bson.M{pendingLoyaltyField: transaction.ID},
+	}
+	res, err := s.users.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		applied, err := s.applied(ctx, transaction)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			// The entry never changed the balance, so it's removed, it was never part of the ledger
+			if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": transaction.ID, "pending": true}); err != nil {
+				return err
+			}
+
+			if transaction.Points < 0 {
+				return ErrInsufficientLoyaltyPoints
+			}
+
+			return mongo.ErrNoDocuments
+		}
+	}
+
+	if _, err := s.collection.UpdateByID(ctx, transaction.ID, bson.M{"$set": bson.M{"pending": false}}); err != nil {
+		return err
+	}
+
+	_, err = s.users.UpdateOne(ctx, bson.M{"_id": transaction.UserID},
+		bson.M{"$pull": bson.M{pendingLoyaltyField: transaction.ID}})
+
+	return err
+}
+
+// applied tells whether the transaction changed the balance already, it's either
+// still listed on the user or marked as applied in the ledger
+func (s *MongoLoyaltyStore) applied(ctx context.Context, transaction *types.LoyaltyTransaction) (bool, error) {
+	filter := bson.M{"_id": transaction.UserID, pendingLoyaltyField: transaction.ID}
+	count, err := s.users.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	filter = bson.M{"_id": transaction.ID, "pending": false}
+	count, err = s.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+
+	return count > 0, err
+}
+
+type LoyaltyQueryParams struct {
+	Pagination
+
+	UserID    primitive.ObjectID
+	BookingID primitive.ObjectID
+	Type      string
+}
+
+// GetTransactions returns the ledger entries from the latest
+func (s *MongoLoyaltyStore) GetTransactions(ctx context.Context, queryParams *LoyaltyQueryParams, pagination *Pagination) ([]*types.LoyaltyTransaction, error) {
+	// Default Pagination Values
+	if pagination.Page == 0 {
+		pagination.Page = int64(defaultPaginationPage)
+	}
+	if pagination.Limit == 0 {
+		pagination.Limit = int64(defaultPaginationLimit)
+	}
+
+	// Entries not applied yet aren't part of the ledger
+	filter := bson.M{"pending": bson.M{"$ne": true}}
+
+	if !queryParams.UserID.IsZero() {
+		filter["userID"] = queryParams.UserID
+	}
+	if !queryParams.BookingID.IsZero() {
+		filter["bookingID"] = queryParams.BookingID
+	}
+	if len(queryParams.Type) > 0 {
+		filter["type"] = queryParams.Type
+	}
+
+	transactions, err := findPage[types.LoyaltyTransaction](ctx, s.collection, matchStage(filter), bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}, pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// minorUnits converts a price in major units stored as a double to minor units (cents),
+// prices already in minor units are stored as integers and kept as they are
+func minorUnits(price string) bson.M {
+	return bson.M{
+		"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$type": price}, "double"}},
+			bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{price, 100}}, 0}}},
+			price,
+		},
+	}
+}
+
+// MigratePricesToMinorUnits converts the room and room type prices stored in major units
+// before money was kept in minor units. It only touches prices stored as doubles,
+// so it's safe to run more than once. It returns the number of rooms and hotels updated.
+func MigratePricesToMinorUnits(ctx context.Context, client *mongo.Client) (int64, int64, error) {
+	database := client.Database(DBNAME)
+
+	rooms, err := database.Collection(roomCollection).UpdateMany(ctx,
+		bson.M{"price": bson.M{"$type": "double"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"price": minorUnits("$price")}}}},
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	roomTypes := bson.M{
+		"$map": bson.M{
+			"input": "$roomTypes",
+			"as":    "roomType",
+			"in": bson.M{
+				"$mergeObjects": bson.A{"$$roomType", bson.M{"price": minorUnits("$$roomType.price")}},
+			},
+		},
+	}
+	hotels, err := database.Collection(hotelCollection).UpdateMany(ctx,
+		bson.M{"roomTypes.price": bson.M{"$type": "double"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"roomTypes": roomTypes}}}},
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rooms.ModifiedCount, hotels.ModifiedCount, nil
+}
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor is the position of a document in a sorted list, it is handed to clients
+// as an opaque string and continues the list right after (or before) the document
+type pageCursor struct {
+	Sort   []string `bson:"s"`
+	Values bson.A   `bson:"v"`
+	Before bool     `bson:"b"`
+}
+
+func matchStage(filter bson.M) mongo.Pipeline {
+	return mongo.Pipeline{{{Key: "$match", Value: filter}}}
+}
+
+// findPage reads a page of the documents the pipeline results in, in the sort order.
+// Pages are read after or before the cursor of the pagination when it's given,
+// otherwise by page number. The sort should end with _id, so the order is strict.
+func findPage[T any](ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline, sort bson.D, pagination *Pagination) ([]*T, error) {
+	if sort == nil {
+		sort = bson.D{{Key: "_id", Value: 1}}
+	}
+
+	var cursor *pageCursor
+	if len(pagination.Cursor) > 0 {
+		var err error
+		if cursor, err = decodeCursor(pagination.Cursor, sort); err != nil {
+			return nil, err
+		}
+	}
+
+	if pagination.CountTotal {
+		total, err := countPipeline(ctx, coll, pipeline)
+		if err != nil {
+			return nil, err
+		}
+		pagination.Total = total
+	}
+
+	before := cursor != nil && cursor.Before
+
+	stages := append(mongo.Pipeline{}, pipeline...)
+	if cursor != nil {
+		stages = append(stages, bson.D{{Key: "$match", Value: keysetFilter(sort, cursor.Values, before)}})
+	}
+	if before {
+		stages = append(stages, bson.D{{Key: "$sort", Value: reverseSort(sort)}})
+	} else {
+		stages = append(stages, bson.D{{Key: "$sort", Value: sort}})
+	}
+	if cursor == nil && pagination.Page > 1 {
+		stages = append(stages, bson.D{{Key: "$skip", Value: (pagination.Page - 1) * pagination.Limit}})
+	}
+	// One more document tells whether another page follows
+	stages = append(stages, bson.D{{Key: "$limit", Value: pagination.Limit + 1}})
+
+	cur, err := coll.Aggregate(ctx, stages)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []bson.Raw
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	more := int64(len(docs)) > pagination.Limit
+	if more {
+		docs = docs[:pagination.Limit]
+	}
+	if before {
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+
+	// Reading backwards, "more" means more documents before the page,
+	// whether documents follow it is looked up separately
+	pagination.HasMore = more
+	if before && len(docs) > 0 {
+		if pagination.HasMore, err = hasAfter(ctx, coll, pipeline, sort, docs[len(docs)-1]); err != nil {
+			return nil, err
+		}
+	}
+	pagination.NextCursor = ""
+	pagination.PrevCursor = ""
+
+	if len(docs) > 0 {
+		if pagination.HasMore {
+			if pagination.NextCursor, err = encodeCursor(sort, docs[len(docs)-1], false); err != nil {
+				return nil, err
+			}
+		}
+		if (before && more) || (!before && (cursor != nil || pagination.Page > 1)) {
+			if pagination.PrevCursor, err = encodeCursor(sort, docs[0], true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	results := make([]*T, 0, len(docs))
+	for _, doc := range docs {
+		var result T
+		if err := bson.Unmarshal(doc, &result); err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+
+	return results, nil
+}
+
+func countPipeline(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline) (int64, error) {
+	stages := append(mongo.Pipeline{}, pipeline...)
+	stages = append(stages, bson.D{{Key: "$count", Value: "total"}})
+
+	cur, err := coll.Aggregate(ctx, stages)
+	if err != nil {
+		return 0, err
+	}
+
+	var counts []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cur.All(ctx, &counts); err != nil {
+		return 0, err
+	}
+
+	if len(counts) == 0 {
+		return 0, nil
+	}
+
+	return counts[0].Total, nil
+}
+
+// hasAfter reports whether a document of the pipeline is sorted after the document
+func hasAfter(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline, sort bson.D, doc bson.Raw) (bool, error) {
+	stages := append(mongo.Pipeline{}, pipeline...)
+	stages = append(stages,
+		bson.D{{Key: "$match", Value: keysetFilter(sort, sortValues(sort, doc), false)}},
+		bson.D{{Key: "$limit", Value: 1}},
+	)
+
+	cur, err := coll.Aggregate(ctx, stages)
+	if err != nil {
+		return false, err
+	}
+	defer cur.Close(ctx)
+
+	return cur.Next(ctx), cur.Err()
+}
+
+// keysetFilter matches the documents sorted after (or before) the values,
+// e.g. for price desc, _id asc: price < v0 or (price == v0 and _id > v1)
+func keysetFilter(sort bson.D, values bson.A, before bool) bson.M {
+	or := bson.A{}
+
+	for i, e := range sort {
+		cond, ok := keysetCondition(e.Key, isDescending(e) != before, values[i])
+		if !ok {
+			continue
+		}
+
+		// Equal to null also matches a missing field, as they are sorted the same
+		for j := 0; j < i; j++ {
+			cond[sort[j].Key] = values[j]
+		}
+
+		or = append(or, cond)
+	}
+
+	if len(or) == 0 {
+		return bson.M{"_id": bson.M{"$exists": false}}
+	}
+
+	return bson.M{"$or": or}
+}
+
+// keysetCondition matches the values of the field sorted after the value, or before it when less.
+// Null and missing fields are sorted before any other value, but comparisons with null never match,
+// so they are matched explicitly. It returns false when nothing is sorted there.
+func keysetCondition(key string, less bool, value any) (bson.M, bool) {
+	switch {
+	case isNull(value) && less:
+		return nil, false
+	case isNull(value):
+		return bson.M{key: bson.M{"$ne": nil}}, true
+	case less:
+		return bson.M{"$or": bson.A{
+			bson.M{key: bson.M{"$lt": value}},
+			bson.M{key: nil},
+		}}, true
+	default:
+		return bson.M{key: bson.M{"$gt": value}}, true
+	}
+}
+
+func isNull(value any) bool {
+	switch v := value.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return true
+	case bson.RawValue:
+		return v.Type == bsontype.Null || v.Type == bsontype.Undefined
+	default:
+		return false
+	}
+}
+
+func reverseSort(sort bson.D) bson.D {
+	reversed := make(bson.D, 0, len(sort))
+	for _, e := range sort {
+		order := -1
+		if isDescending(e) {
+			order = 1
+		}
+		reversed = append(reversed, bson.E{Key: e.Key, Value: order})
+	}
+
+	return reversed
+}
+
+func isDescending(e bson.E) bool {
+	order, ok := e.Value.(int)
+	return ok && order < 0
+}
+
+func sortKeys(sort bson.D) []string {
+	keys := make([]string, 0, len(sort))
+	for _, e := range sort {
+		keys = append(keys, fmt.Sprintf("%s:%v", e.Key, e.Value))
+	}
+
+	return keys
+}
+
+// sortValues are the values of the document the sort compares
+func sortValues(sort bson.D, doc bson.Raw) bson.A {
+	values := make(bson.A, 0, len(sort))
+	for _, e := range sort {
+		value, err := doc.LookupErr(strings.Split(e.Key, ".")...)
+		if err != nil {
+			// Missing fields are sorted as null
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, value)
+	}
+
+	return values
+}
+
+func encodeCursor(sort bson.D, doc bson.Raw, before bool) (string, error) {
+	b, err := bson.Marshal(pageCursor{
+		Sort:   sortKeys(sort),
+		Values: sortValues(sort, doc),
+		Before: before,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string, sort bson.D) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor pageCursor
+	if err := bson.Unmarshal(b, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	keys := sortKeys(sort)
+	if len(cursor.Sort) != len(keys) || len(cursor.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: the sort was changed", ErrInvalidCursor)
+	}
+	for i := range keys {
+		if cursor.Sort[i] != keys[i] {
+			return nil, fmt.Errorf("%w: the sort was changed", ErrInvalidCursor)
+		}
+	}
+
+	return &cursor, nil
+}
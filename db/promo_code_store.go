@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrPromoCodeLimitReached = errors.New("promo code usage limit reached")
+
+type PromoCodeStore interface {
+	InsertPromoCode(context.Context, *types.PromoCode) (*types.PromoCode, error)
+	GetPromoCodes(context.Context, *PromoCodeQueryParams, *Pagination) ([]*types.PromoCode, error)
+	GetPromoCodeByCode(context.Context, string) (*types.PromoCode, error)
+	RedeemPromoCode(context.Context, *types.PromoCode, primitive.ObjectID) error
+	ReleasePromoCode(context.Context, primitive.ObjectID, primitive.ObjectID) error
+}
+
+type MongoPromoCodeStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoPromoCodeStore(client *mongo.Client) *MongoPromoCodeStore {
+	return &MongoPromoCodeStore{
+		client:     client,
+		collection: client.Database(DBNAME).Collection(promoCodeCollection),
+	}
+}
+
+func NewMongoTestPromoCodeStore(client *mongo.Client) *MongoPromoCodeStore {
+	return &MongoPromoCodeStore{
+		client:     client,
+		collection: client.Database(TestDBNAME).Collection(promoCodeCollection),
+	}
+}
+
+// EnsureIndexes makes codes unique, so two promo codes can't be created with the same code
+func (s *MongoPromoCodeStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
+
+// RedeemPromoCode counts a redemption of the code by the user. The limits are part
+// of the update filter, so concurrent bookings can never exceed them.
+func (s *MongoPromoCodeStore) RedeemPromoCode(ctx context.Context, promoCode *types.PromoCode, userID primitive.ObjectID) error {
+	userRedemptions := "userRedemptions." + userID.Hex()
+
+	filter := bson.M{"_id": promoCode.ID}
+	if promoCode.MaxRedemptions > 0 {
+		filter["redemptions"] = bson.M{
+			"$lt": promoCode.MaxRedemptions,
+		}
+	}
+	if promoCode.MaxRedemptionsPerUser > 0 {
+		filter[userRedemptions] = bson.M{
+			"$not": bson.M{"$gte": promoCode.MaxRedemptionsPerUser},
+		}
+	}
+
+	update := bson.M{
+		"$inc": bson.M{
+			"redemptions":   1,
+			userRedemptions: 1,
+		},
+	}
+
+	res, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrPromoCodeLimitReached
+	}
+
+	return nil
+}
+
+// ReleasePromoCode gives back a redemption, e.g. when the booking failed or was canceled
+func (s *MongoPromoCodeStore) ReleasePromoCode(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) error {
+	userRedemptions := "userRedemptions." + userID.Hex()
+
+	filter := bson.M{
+		"_id":           oid,
+		"redemptions":   bson.M{"$gt": 0},
+		userRedemptions: bson.M{"$gt": 0},
+	}
+	update := bson.M{
+		"$inc": bson.M{
+			"redemptions":   -1,
+			userRedemptions: -1,
+		},
+	}
+
+	res, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (s *MongoPromoCodeStore) GetPromoCodeByCode(ctx context.Context, code string) (*types.PromoCode, error) {
+	var promoCode types.PromoCode
+	if err := s.collection.FindOne(ctx, bson.M{"code": code}).Decode(&promoCode); err != nil {
+		return nil, err
+	}
+
+	return &promoCode, nil
+}
+
+type PromoCodeQueryParams struct {
+	Pagination
+
+	Code    string
+	Type    string
+	HotelID primitive.ObjectID
+}
+
+func (s *MongoPromoCodeStore) GetPromoCodes(ctx context.Context, queryParams *PromoCodeQueryParams, pagination *Pagination) ([]*types.PromoCode, error) {
+	// Default Pagination Values
+	if pagination.Page == 0 {
+		pagination.Page = int64(defaultPaginationPage)
+	}
+	if pagination.Limit == 0 {
+		pagination.Limit = int64(defaultPaginationLimit)
+	}
+
+	// Check for empty values in filter
+	filter := bson.M{}
+
+	if len(queryParams.Code) > 0 {
+		filter["code"] = types.NormalizePromoCode(queryParams.Code)
+	}
+	if len(queryParams.Type) > 0 {
+		filter["type"] = queryParams.Type
+	}
+	if !queryParams.HotelID.IsZero() {
+		filter["hotelIDs"] = queryParams.HotelID
+	}
+
+	promoCodes, err := findPage[types.PromoCode](ctx, s.collection, matchStage(filter), nil, pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	return promoCodes, nil
+}
+
+func (s *MongoPromoCodeStore) InsertPromoCode(ctx context.Context, promoCode *types.PromoCode) (*types.PromoCode, error) {
+	res, err := s.collection.InsertOne(ctx, promoCode)
+	if err != nil {
+		return nil, err
+	}
+
+	promoCode.ID = res.InsertedID.(primitive.ObjectID)
+
+	return promoCode, nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type RestrictionStore interface {
+	InsertRestriction(context.Context, *types.Restriction) (*types.Restriction, error)
+	GetRestrictions(context.Context, *RestrictionQueryParams, *Pagination) ([]*types.Restriction, error)
+	DeleteRestriction(context.Context, primitive.ObjectID, ...int64) error
+}
+
+type MongoRestrictionStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoRestrictionStore(client *mongo.Client) *MongoRestrictionStore {
+	return &MongoRestrictionStore{
+		client:     client,
+		collection: client.Database(DBNAME).Collection(restrictionCollection),
+	}
+}
+
+func NewMongoTestRestrictionStore(client *mongo.Client) *MongoRestrictionStore {
+	return &MongoRestrictionStore{
+		client:     client,
+		collection: client.Database(TestDBNAME).Collection(restrictionCollection),
+	}
+}
+
+// DeleteRestriction deletes the restriction if it's still at one of the versions, see MatchVersion
+func (s *MongoRestrictionStore) DeleteRestriction(ctx context.Context, oid primitive.ObjectID, versions ...int64) error {
+	return deleteVersioned(ctx, s.collection, oid, versions...)
+}
+
+type RestrictionQueryParams struct {
+	Pagination
+
+	HotelID  primitive.ObjectID
+	RoomID   primitive.ObjectID
+	FromDate time.Time
+	TillDate time.Time
+	// Stay narrows the restrictions overlapping FromDate and TillDate down to the ones that can refuse
+	// the stay: those covering the arrival day and the closed to departure ones covering the departure day
+	Stay bool `query:"-"`
+}
+
+func (s *MongoRestrictionStore) GetRestrictions(ctx context.Context, queryParams *RestrictionQueryParams, pagination *Pagination) ([]*types.Restriction, error) {
+	// Default Pagination Values
+	if pagination.Page == 0 {
+		pagination.Page = int64(defaultPaginationPage)
+	}
+	if pagination.Limit == 0 {
+		pagination.Limit = int64(defaultPaginationLimit)
+	}
+
+	// Check for empty values in filter
+	filter := bson.M{}
+
+	if !queryParams.HotelID.IsZero() {
+		filter["hotelID"] = queryParams.HotelID
+	}
+	// Hotel-wide restrictions have no roomID and apply to every room
+	if !queryParams.RoomID.IsZero() {
+		filter["roomID"] = bson.M{
+			"$in": bson.A{queryParams.RoomID, nil},
+		}
+	}
+	if !queryParams.FromDate.IsZero() {
+		filter["tillDate"] = bson.M{
+			"$gte": queryParams.FromDate,
+		}
+	}
+	if !queryParams.TillDate.IsZero() {
+		filter["fromDate"] = bson.M{
+			"$lte": queryParams.TillDate,
+		}
+	}
+	if queryParams.Stay && !queryParams.FromDate.IsZero() && !queryParams.TillDate.IsZero() {
+		arrival := coveringDay(queryParams.FromDate)
+		departure := coveringDay(queryParams.TillDate)
+		departure["closedToDeparture"] = true
+
+		delete(filter, "tillDate")
+		delete(filter, "fromDate")
+		filter["$or"] = bson.A{arrival, departure}
+	}
+
+	restrictions, err := findPage[types.Restriction](ctx, s.collection, matchStage(filter), nil, pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// coveringDay matches the restrictions whose dates cover the day of the date, like Restriction.Check
+func coveringDay(date time.Time) bson.M {
+	date = date.UTC()
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	return bson.M{
+		"fromDate": bson.M{"$lt": day.AddDate(0, 0, 1)},
+		"tillDate": bson.M{"$gte": day},
+	}
+}
+
+func (s *MongoRestrictionStore) InsertRestriction(ctx context.Context, restriction *types.Restriction) (*types.Restriction, error) {
+	res, err := s.collection.InsertOne(ctx, restriction)
+	if err != nil {
+		return nil, err
+	}
+
+	restriction.ID = res.InsertedID.(primitive.ObjectID)
+
+	return restriction, nil
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReviewStore interface {
+	InsertReview(context.Context, *types.Review) (*types.Review, error)
+	GetReviews(context.Context, *ReviewQueryParams, *Pagination) ([]*types.Review, error)
+	GetReviewByID(context.Context, primitive.ObjectID) (*types.Review, error)
+	UpdateReview(context.Context, bson.M, bson.M) error
+	GetReviewStats(context.Context, primitive.ObjectID) (*types.ReviewStats, error)
+}
+
+type MongoReviewStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoReviewStore(client *mongo.Client) *MongoReviewStore {
+	return &MongoReviewStore{
+		client:     client,
+		collection: client.Database(DBNAME).Collection(reviewCollection),
+	}
+}
+
+func NewMongoTestReviewStore(client *mongo.Client) *MongoReviewStore {
+	return &MongoReviewStore{
+		client:     client,
+		collection: client.Database(TestDBNAME).Collection(reviewCollection),
+	}
+}
+
+// EnsureIndexes allows a single review per booking
+func (s *MongoReviewStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "bookingID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
+
+// GetReviewStats averages the overall and category scores of the approved reviews of the hotel
+func (s *MongoReviewStore) GetReviewStats(ctx context.Context, hotelID primitive.ObjectID) (*types.ReviewStats, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"hotelID": hotelID,
+			"status":  types.ReviewApproved,
+		}}},
+		{{Key: "$facet", Value: bson.M{
+			"overall": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":   nil,
+					"score": bson.M{"$avg": "$score"},
+					"count": bson.M{"$sum": 1},
+				}},
+			},
+			"categories": bson.A{
+				bson.M{"$project": bson.M{"scores": bson.M{"$objectToArray": "$scores"}}},
+				bson.M{"$unwind": "$scores"},
+				bson.M{"$group": bson.M{
+					"_id":   "$scores.k",
+					"score": bson.M{"$avg": "$scores.v"},
+				}},
+			},
+		}}},
+	}
+
+	cur, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Overall []struct {
+			Score float64 `bson:"score"`
+			Count int     `bson:"count"`
+		} `bson:"overall"`
+		Categories []struct {
+			Category string  `bson:"_id"`
+			Score    float64 `bson:"score"`
+		} `bson:"categories"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	stats := &types.ReviewStats{
+		CategoryScores: map[string]float64{},
+	}
+	if len(results) == 0 || len(results[0].Overall) == 0 {
+		return stats, nil
+	}
+
+	stats.Score = results[0].Overall[0].Score
+	stats.Count = results[0].Overall[0].Count
+	for _, category := range results[0].Categories {
+		stats.CategoryScores[category.Category] = category.Score
+	}
+
+	return stats, nil
+}
+
+func (s *MongoReviewStore) GetReviewByID(ctx context.Context, oid primitive.ObjectID) (*types.Review, error) {
+	var review types.Review
+	if err := s.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&review); err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// UpdateReview bumps the version of the review, a filter with MatchVersion makes the update version-checked
+func (s *MongoReviewStore) UpdateReview(ctx context.Context, filter bson.M, update bson.M) error {
+	return updateVersioned(ctx, s.collection, filter, update)
+}
+
+type ReviewQueryParams struct {
+	Pagination
+
+	HotelID   primitive.ObjectID
+	BookingID primitive.ObjectID
+	UserID    primitive.ObjectID
+	Status    string
+}
+
+// GetReviews returns the reviews from the latest
+func (s *MongoReviewStore) GetReviews(ctx context.Context, queryParams *ReviewQueryParams, pagination *Pagination) ([]*types.Review, error) {
+	// Default Pagination Values
+	if pagination.Page == 0 {
+		pagination.Page = int64(defaultPaginationPage)
+	}
+	if pagination.Limit == 0 {
+		pagination.Limit = int64(defaultPaginationLimit)
+	}
+
+	// Check for empty values in filter
+	filter := bson.M{}
+
+	if !queryParams.HotelID.IsZero() {
+		filter["hotelID"] = queryParams.HotelID
+	}
+	if !queryParams.BookingID.IsZero() {
+		filter["bookingID"] = queryParams.BookingID
+	}
+	if !queryParams.UserID.IsZero() {
+		filter["userID"] = queryParams.UserID
+	}
+	if len(queryParams.Status) > 0 {
+		filter["status"] = queryParams.Status
+	}
+
+	reviews, err := findPage[types.Review](ctx, s.collection, matchStage(filter), bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}, pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+func (s *MongoReviewStore) InsertReview(ctx context.Context, review *types.Review) (*types.Review, error) {
+	res, err := s.collection.InsertOne(ctx, review)
+	if err != nil {
+		return nil, err
+	}
+
+	review.ID = res.InsertedID.(primitive.ObjectID)
+
+	return review, nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"github.com/rtsoy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type RoomBlockStore interface {
+	InsertRoomBlock(context.Context, *types.RoomBlock) (*types.RoomBlock, error)
+	GetRoomBlocks(context.Context, *RoomBlockQueryParams, *Pagination) ([]*types.RoomBlock, error)
+	DeleteRoomBlock(context.Context, primitive.ObjectID, ...int64) error
+}
+
+type MongoRoomBlockStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewMongoRoomBlockStore(client *mongo.Client) *MongoRoomBlockStore {
+	return &MongoRoomBlockStore{
+		client:     client,
+		collection: client.Database(DBNAME).Collection(roomBlockCollection),
+	}
+}
+
+func NewMongoTestRoomBlockStore(client *mongo.Client) *MongoRoomBlockStore {
+	return &MongoRoomBlockStore{
+		client:     client,
+		collection: client.Database(TestDBNAME).Collection(roomBlockCollection),
+	}
+}
+
+// DeleteRoomBlock deletes the room block if it's still at one of the versions, see MatchVersion
+func (s *MongoRoomBlockStore) DeleteRoomBlock(ctx context.Context, oid primitive.ObjectID, versions ...int64) error {
+	return deleteVersioned(ctx, s.collection, oid, versions...)
+}
+
+type RoomBlockQueryParams struct {
+	Pagination
+
+	RoomID   primitive.ObjectID
+	HotelID  primitive.ObjectID
+	FromDate time.Time
+	TillDate time.Time
+}
+
+func (s *MongoRoomBlockStore) GetRoomBlocks(ctx context.Context, queryParams *RoomBlockQueryParams, pagination *Pagination) ([]*types.RoomBlock, error) {
+	// Default Pagination Values
+	if pagination.Page == 0 {
+		pagination.Page = int64(defaultPaginationPage)
+	}
+	if pagination.Limit == 0 {
+		pagination.Limit = int64(defaultPaginationLimit)
+	}
+
+	// Check for empty values in filter
+	filter := bson.M{}
+
+	if !queryParams.RoomID.IsZero() {
+		filter["roomID"] = queryParams.RoomID
+	}
+	if !queryParams.HotelID.IsZero() {
+		filter["hotelID"] = queryParams.HotelID
+	}
+	// Blocks overlapping the [FromDate, TillDate] period
+	if !queryParams.FromDate.IsZero() {
+		filter["tillDate"] = bson.M{
+			"$gte": queryParams.FromDate,
+		}
+	}
+	if !queryParams.TillDate.IsZero() {
+		filter["fromDate"] = bson.M{
+			"$lte": queryParams.TillDate,
+		}
+	}
+
+	blocks, err := findPage[types.RoomBlock](ctx, s.collection, matchStage(filter), nil, pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+func (s *MongoRoomBlockStore) InsertRoomBlock(ctx context.Context, block *types.RoomBlock) (*types.RoomBlock, error) {
+	res, err := s.collection.InsertOne(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
+	block.ID = res.InsertedID.(primitive.ObjectID)
+
+	return block, nil
+}
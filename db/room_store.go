@@ -6,12 +6,15 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
 )
 
 type RoomStore interface {
 	InsertRoom(context.Context, *types.Room) (*types.Room, error)
 	GetRooms(context.Context, *RoomQueryParams, *Pagination) ([]*types.Room, error)
+	GetRoomByID(context.Context, primitive.ObjectID) (*types.Room, error)
+	GetRoomsByIDs(context.Context, []primitive.ObjectID) ([]*types.Room, error)
+	UpdateRoom(context.Context, bson.M, bson.M) error
 }
 
 type MongoRoomStore struct {
@@ -36,14 +39,41 @@ func NewMongoTestRoomStore(client *mongo.Client, hotelStore HotelStore) *MongoRo
 	}
 }
 
+// UpdateRoom bumps the version of the room, a filter with MatchVersion makes the update version-checked
+func (s *MongoRoomStore) UpdateRoom(ctx context.Context, filter bson.M, update bson.M) error {
+	return updateVersioned(ctx, s.collection, filter, update)
+}
+
+func (s *MongoRoomStore) GetRoomByID(ctx context.Context, oid primitive.ObjectID) (*types.Room, error) {
+	var room types.Room
+	if err := s.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&room); err != nil {
+		return nil, err
+	}
+
+	return &room, nil
+}
+
 type RoomQueryParams struct {
 	Pagination
 
-	Size      string
-	Seaside   *bool
-	FromPrice float64
-	ToPrice   float64
-	HotelID   primitive.ObjectID
+	Size       string
+	Seaside    *bool
+	FromPrice  int64
+	ToPrice    int64
+	HotelID    primitive.ObjectID
+	RoomTypeID primitive.ObjectID
+	Amenities  []string
+	// Sort lists the fields to sort by, see roomSortFields
+	Sort []string
+
+	// FromDate and TillDate narrow the search down to rooms
+	// that can be booked for the stay, they are not stored in rooms
+	FromDate time.Time
+	TillDate time.Time
+	// ExcludedHotelIDs and ExcludedRoomIDs are left out of the rooms,
+	// e.g. the ones stay restrictions don't allow the stay at
+	ExcludedHotelIDs []primitive.ObjectID `query:"-"`
+	ExcludedRoomIDs  []primitive.ObjectID `query:"-"`
 }
 
 func (s *MongoRoomStore) GetRooms(ctx context.Context, queryParams *RoomQueryParams, pagination *Pagination) ([]*types.Room, error) {
@@ -83,27 +113,81 @@ func (s *MongoRoomStore) GetRooms(ctx context.Context, queryParams *RoomQueryPar
 	if queryParams.HotelID.Hex() != "000000000000000000000000" {
 		filter["hotelID"] = queryParams.HotelID
 	}
+	if queryParams.RoomTypeID.Hex() != "000000000000000000000000" {
+		filter["roomTypeID"] = queryParams.RoomTypeID
+	}
+	if len(queryParams.Amenities) > 0 {
+		filter["amenities"] = bson.M{
+			"$all": queryParams.Amenities,
+		}
+	}
+	if len(queryParams.ExcludedHotelIDs) > 0 {
+		hotelFilter := bson.M{
+			"$nin": queryParams.ExcludedHotelIDs,
+		}
+		if !queryParams.HotelID.IsZero() {
+			hotelFilter["$eq"] = queryParams.HotelID
+		}
+		filter["hotelID"] = hotelFilter
+	}
+	if len(queryParams.ExcludedRoomIDs) > 0 {
+		filter["_id"] = bson.M{
+			"$nin": queryParams.ExcludedRoomIDs,
+		}
+	}
 
-	opts := &options.FindOptions{}
+	sort, err := parseSort(queryParams.Sort, roomSortFields)
+	if err != nil {
+		return nil, err
+	}
 
-	opts.SetSkip((pagination.Page - 1) * pagination.Limit)
-	opts.SetLimit(pagination.Limit)
+	pipeline := matchStage(filter)
+	if !queryParams.FromDate.IsZero() && !queryParams.TillDate.IsZero() {
+		pipeline = append(pipeline, unoccupiedStages(queryParams.FromDate, queryParams.TillDate)...)
+	}
 
-	cur, err := s.collection.Find(ctx, filter, opts)
+	rooms, err := findPage[types.Room](ctx, s.collection, pipeline, sort, pagination)
 	if err != nil {
 		return nil, err
 	}
 
-	var rooms []*types.Room
-	if err := cur.All(ctx, &rooms); err != nil {
-		return nil, err
+	return rooms, nil
+}
+
+// unoccupiedStages drop the rooms with active bookings or maintenance blocks overlapping the stay,
+// before the rooms are paged
+func unoccupiedStages(fromDate, tillDate time.Time) mongo.Pipeline {
+	overlapping := func(from string, match bson.M) bson.D {
+		match["$expr"] = bson.M{"$eq": bson.A{"$roomID", "$$roomID"}}
+		match["fromDate"] = bson.M{"$lte": tillDate}
+		match["tillDate"] = bson.M{"$gte": fromDate}
+
+		return bson.D{{Key: "$lookup", Value: bson.M{
+			"from": from,
+			"let":  bson.M{"roomID": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": match},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": from,
+		}}}
 	}
 
-	if len(rooms) == 0 {
-		return nil, mongo.ErrNoDocuments
+	return mongo.Pipeline{
+		overlapping(bookingCollection, bson.M{"canceled": false}),
+		overlapping(roomBlockCollection, bson.M{}),
+		{{Key: "$match", Value: bson.M{
+			bookingCollection:   bson.M{"$size": 0},
+			roomBlockCollection: bson.M{"$size": 0},
+		}}},
+		{{Key: "$unset", Value: bson.A{bookingCollection, roomBlockCollection}}},
 	}
+}
 
-	return rooms, nil
+// GetRoomsByIDs reads the rooms of the IDs at once, see findByIDs
+func (s *MongoRoomStore) GetRoomsByIDs(ctx context.Context, oids []primitive.ObjectID) ([]*types.Room, error) {
+	return findByIDs[types.Room](ctx, s.collection, oids)
 }
 
 func (s *MongoRoomStore) InsertRoom(ctx context.Context, room *types.Room) (*types.Room, error) {
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+// The fields each resource can be sorted by, keyed by their name in the sort query parameter.
+// createdAt sorts by _id, object ids start with their creation time.
+var (
+	hotelSortFields = map[string]string{
+		"name":        "name",
+		"rating":      "rating",
+		"reviewScore": "reviewScore",
+		"reviewCount": "reviewCount",
+		"distance":    "distanceKm",
+	}
+	roomSortFields = map[string]string{
+		"price":   "price",
+		"size":    "size",
+		"seaside": "seaside",
+	}
+	bookingSortFields = map[string]string{
+		"createdAt":  "_id",
+		"fromDate":   "fromDate",
+		"tillDate":   "tillDate",
+		"numPersons": "numPersons",
+		"total":      "price.total",
+	}
+	userSortFields = map[string]string{
+		"createdAt": "_id",
+		"firstName": "firstName",
+		"lastName":  "lastName",
+		"email":     "email",
+	}
+)
+
+// parseSort turns sort query values like "-price,size" into a sort document,
+// a leading "-" sorts the field descending. _id is appended as a tiebreaker,
+// so pages don't overlap when sorted values are equal. A nil document means no sort was asked.
+func parseSort(sort []string, fields map[string]string) (bson.D, error) {
+	var (
+		doc  bson.D
+		seen = map[string]bool{}
+	)
+
+	for _, value := range sort {
+		for _, name := range strings.Split(value, ",") {
+			// "+" is decoded to a space in query strings
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			order := 1
+			if strings.HasPrefix(name, "-") {
+				order = -1
+				name = name[1:]
+			}
+
+			field, ok := fields[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: can't sort by %q", ErrInvalidSort, name)
+			}
+			if seen[field] {
+				return nil, fmt.Errorf("%w: %q is given twice", ErrInvalidSort, name)
+			}
+			seen[field] = true
+
+			doc = append(doc, bson.E{Key: field, Value: order})
+		}
+	}
+
+	if doc != nil && !seen["_id"] {
+		doc = append(doc, bson.E{Key: "_id", Value: 1})
+	}
+
+	return doc, nil
+}
+
+func sortsBy(sort bson.D, field string) bool {
+	for _, e := range sort {
+		if e.Key == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// NewMongoStore creates every store of the database, see EnsureIndexes before using them
+func NewMongoStore(client *mongo.Client, idempotencyKeyTTL, idempotencyKeyLease time.Duration) *Store {
+	hotelStore := NewMongoHotelStore(client)
+
+	return &Store{
+		User:        NewMongoUserStore(client),
+		Hotel:       hotelStore,
+		Room:        NewMongoRoomStore(client, hotelStore),
+		Booking:     NewMongoBookingStore(client),
+		Restriction: NewMongoRestrictionStore(client),
+		RoomBlock:   NewMongoRoomBlockStore(client),
+		PromoCode:   NewMongoPromoCodeStore(client),
+		Folio:       NewMongoFolioStore(client),
+		Invoice:     NewMongoInvoiceStore(client),
+		Loyalty:     NewMongoLoyaltyStore(client),
+		Review:      NewMongoReviewStore(client),
+		Idempotency: NewMongoIdempotencyStore(client, idempotencyKeyTTL, idempotencyKeyLease),
+	}
+}
+
+// NewMongoTestStore creates every store of the test database
+func NewMongoTestStore(client *mongo.Client) *Store {
+	hotelStore := NewMongoTestHotelStore(client)
+
+	return &Store{
+		User:        NewMongoTestUserStore(client),
+		Hotel:       hotelStore,
+		Room:        NewMongoTestRoomStore(client, hotelStore),
+		Booking:     NewMongoTestBookingStore(client),
+		Restriction: NewMongoTestRestrictionStore(client),
+		RoomBlock:   NewMongoTestRoomBlockStore(client),
+		PromoCode:   NewMongoTestPromoCodeStore(client),
+		Folio:       NewMongoTestFolioStore(client),
+		Invoice:     NewMongoTestInvoiceStore(client),
+		Loyalty:     NewMongoTestLoyaltyStore(client),
+		Review:      NewMongoTestReviewStore(client),
+		Idempotency: NewMongoTestIdempotencyStore(client, DefaultIdempotencyKeyTTL, DefaultIdempotencyKeyLease),
+	}
+}
+
+// EnsureIndexes creates the indexes of every store that has any, the stores rely on them
+// for uniqueness and expiry, so they have to exist before the stores are used
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	stores := []any{
+		s.User, s.Hotel, s.Room, s.Booking, s.Restriction, s.RoomBlock,
+		s.PromoCode, s.Folio, s.Invoice, s.Loyalty, s.Review, s.Idempotency,
+	}
+
+	for _, store := range stores {
+		indexed, ok := store.(interface{ EnsureIndexes(context.Context) error })
+		if !ok {
+			continue
+		}
+		if err := indexed.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
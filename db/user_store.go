@@ -6,15 +6,15 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserStore interface {
 	GetUserByID(context.Context, primitive.ObjectID) (*types.User, error)
 	GetUserByEmail(context.Context, string) (*types.User, error)
+	GetUsersByIDs(context.Context, []primitive.ObjectID) ([]*types.User, error)
 	GetUsers(context.Context, *UserQueryParams, *Pagination) ([]*types.User, error)
 	InsertUser(context.Context, *types.User) (*types.User, error)
-	DeleteUser(context.Context, primitive.ObjectID) error
+	DeleteUser(context.Context, primitive.ObjectID, ...int64) error
 	UpdateUser(context.Context, bson.M, bson.M) error
 }
 
@@ -46,30 +46,14 @@ func (s *MongoUserStore) GetUserByEmail(ctx context.Context, email string) (*typ
 	return &user, nil
 }
 
+// UpdateUser bumps the version of the user, a filter with MatchVersion makes the update version-checked
 func (s *MongoUserStore) UpdateUser(ctx context.Context, filter bson.M, update bson.M) error {
-	res, err := s.collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return err
-	}
-
-	if res.MatchedCount == 0 {
-		return mongo.ErrNoDocuments
-	}
-
-	return nil
+	return updateVersioned(ctx, s.collection, filter, update)
 }
 
-func (s *MongoUserStore) DeleteUser(ctx context.Context, oid primitive.ObjectID) error {
-	res, err := s.collection.DeleteOne(ctx, bson.M{"_id": oid})
-	if err != nil {
-		return err
-	}
-
-	if res.DeletedCount == 0 {
-		return mongo.ErrNoDocuments
-	}
-
-	return nil
+// DeleteUser deletes the user if it's still at one of the versions, see MatchVersion
+func (s *MongoUserStore) DeleteUser(ctx context.Context, oid primitive.ObjectID, versions ...int64) error {
+	return deleteVersioned(ctx, s.collection, oid, versions...)
 }
 
 func (s *MongoUserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
@@ -90,6 +74,8 @@ type UserQueryParams struct {
 	LastName  string
 	Email     string
 	IsAdmin   *bool
+	// Sort lists the fields to sort by, see userSortFields
+	Sort []string
 }
 
 func (s *MongoUserStore) GetUsers(ctx context.Context, queryParams *UserQueryParams, pagination *Pagination) ([]*types.User, error) {
@@ -117,29 +103,25 @@ func (s *MongoUserStore) GetUsers(ctx context.Context, queryParams *UserQueryPar
 		filter["isAdmin"] = queryParams.IsAdmin
 	}
 
-	opts := &options.FindOptions{}
-
-	opts.SetSkip((pagination.Page - 1) * pagination.Limit)
-	opts.SetLimit(pagination.Limit)
-
-	cur, err := s.collection.Find(ctx, filter, opts)
+	sort, err := parseSort(queryParams.Sort, userSortFields)
 	if err != nil {
 		return nil, err
 	}
 
-	var users []*types.User
-	if err := cur.All(ctx, &users); err != nil {
+	users, err := findPage[types.User](ctx, s.collection, matchStage(filter), sort, pagination)
+	if err != nil {
 		return nil, err
 	}
 
-	if len(users) == 0 {
-		return nil, mongo.ErrNoDocuments
-	}
-
 	return users, nil
 
 }
 
+// GetUsersByIDs reads the users of the IDs at once, see findByIDs
+func (s *MongoUserStore) GetUsersByIDs(ctx context.Context, oids []primitive.ObjectID) ([]*types.User, error) {
+	return findByIDs[types.User](ctx, s.collection, oids)
+}
+
 func (s *MongoUserStore) GetUserByID(ctx context.Context, oid primitive.ObjectID) (*types.User, error) {
 	var user types.User
 	if err := s.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&user); err != nil {
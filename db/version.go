@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// versionField counts the writes of a document, so writes based on a stale read can be detected
+const versionField = "version"
+
+var ErrVersionConflict = errors.New("version conflict")
+
+// MatchVersion makes a write only apply to the versions of the document, the write fails
+// with ErrVersionConflict when the document was changed since one of them was read.
+// Without versions the write applies to any version, as long as the document exists.
+// Documents written before versioning have no version field and match version 0.
+func MatchVersion(filter bson.M, versions ...int64) bson.M {
+	matched := bson.M{}
+	for key, value := range filter {
+		matched[key] = value
+	}
+
+	if len(versions) == 0 {
+		return matched
+	}
+	if len(versions) == 1 && versions[0] != 0 {
+		matched[versionField] = versions[0]
+		return matched
+	}
+
+	in := bson.A{}
+	for _, version := range versions {
+		in = append(in, version)
+		if version == 0 {
+			in = append(in, nil)
+		}
+	}
+	matched[versionField] = bson.M{"$in": in}
+
+	return matched
+}
+
+// versioned adds the version bump to an update, every write of a versioned document should have it
+func versioned(update bson.M) bson.M {
+	bumped := bson.M{}
+	for key, value := range update {
+		bumped[key] = value
+	}
+
+	inc := bson.M{}
+	if existing, ok := update["$inc"].(bson.M); ok {
+		for key, value := range existing {
+			inc[key] = value
+		}
+	}
+	inc[versionField] = int64(1)
+	bumped["$inc"] = inc
+
+	return bumped
+}
+
+// updateVersioned updates the document matching the filter and bumps its version
+func updateVersioned(ctx context.Context, coll *mongo.Collection, filter bson.M, update bson.M) error {
+	res, err := coll.UpdateOne(ctx, filter, versioned(update))
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return notMatched(ctx, coll, filter)
+	}
+
+	return nil
+}
+
+// deleteVersioned deletes the document of the ID if it's still at one of the versions
+func deleteVersioned(ctx context.Context, coll *mongo.Collection, oid primitive.ObjectID, versions ...int64) error {
+	filter := MatchVersion(bson.M{"_id": oid}, versions...)
+
+	res, err := coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return notMatched(ctx, coll, filter)
+	}
+
+	return nil
+}
+
+// notMatched tells why a write matched nothing: the document matches the filter except for
+// its version, so it was changed in the meantime, or it doesn't match at all
+func notMatched(ctx context.Context, coll *mongo.Collection, filter bson.M) error {
+	if _, ok := filter[versionField]; !ok {
+		return mongo.ErrNoDocuments
+	}
+
+	unversioned := bson.M{}
+	for key, value := range filter {
+		if key != versionField {
+			unversioned[key] = value
+		}
+	}
+
+	count, err := coll.CountDocuments(ctx, unversioned, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVersionConflict
+	}
+
+	return mongo.ErrNoDocuments
+}
@@ -3,14 +3,20 @@ package main
 import (
 	"context"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/rtsoy/hotel-reservation/api"
 	"github.com/rtsoy/hotel-reservation/api/errors"
-	"github.com/rtsoy/hotel-reservation/api/middleware"
+	"github.com/rtsoy/hotel-reservation/blob"
+	"github.com/rtsoy/hotel-reservation/currency"
 	"github.com/rtsoy/hotel-reservation/db"
+	"github.com/rtsoy/hotel-reservation/payment"
+	"github.com/rtsoy/hotel-reservation/ratelimit"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -19,65 +25,86 @@ func main() {
 		log.Fatal(err)
 	}
 
-	var (
-		app = fiber.New(fiber.Config{
-			ErrorHandler: errors.ErrorHandler,
-		})
-
-		hotelStore   = db.NewMongoHotelStore(client)
-		roomStore    = db.NewMongoRoomStore(client, hotelStore)
-		userStore    = db.NewMongoUserStore(client)
-		bookingStore = db.NewMongoBookingStore(client)
-
-		store = &db.Store{
-			User:    userStore,
-			Hotel:   hotelStore,
-			Room:    roomStore,
-			Booking: bookingStore,
-		}
-
-		apiv1 = app.Group("/api/v1", middleware.JWTAuthentication(userStore))
-		auth  = app.Group("/api")
-		admin = apiv1.Group("/admin", middleware.AdminAuth)
-
-		userHandler    = api.NewUserHandler(userStore)
-		authHandler    = api.NewAuthHandler(userStore)
-		hotelHandler   = api.NewHotelHandler(store)
-		roomHandler    = api.NewRoomHandler(store)
-		bookingHandler = api.NewBookingHandler(store)
-	)
-
-	// Auth Handlers
-
-	auth.Post("/auth", authHandler.HandleAuthenticate)
-
-	// User Handlers
+	rates, err := currency.NewStaticRateProviderFromFile(os.Getenv("EXCHANGE_RATES_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	apiv1.Post("/user", userHandler.HandlePostUser)
-	apiv1.Get("/user", userHandler.HandleGetUsers)
-	apiv1.Get("/user/:id", userHandler.HandleGetUser)
-	apiv1.Put("/user/:id", userHandler.HandlePutUser)
-	apiv1.Delete("user/:id", userHandler.HandleDeleteUser)
+	// Webhooks are signed with the secret, without one anyone could forge them
+	// and mark bookings paid or canceled.
+	webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if len(webhookSecret) == 0 {
+		log.Fatal("PAYMENT_WEBHOOK_SECRET is not set")
+	}
 
-	// Hotel Handlers
+	// No real payment provider is integrated yet. The fake one approves any token and keeps
+	// payments in memory, they are lost on restart, so it has to be asked for explicitly.
+	var payments payment.PaymentProvider
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "fake":
+		log.Println("warning: using the fake payment provider, it's only meant for development")
+		payments = payment.NewFakeProvider(webhookSecret)
+	default:
+		log.Fatalf("PAYMENT_PROVIDER %q is not supported", provider)
+	}
 
-	apiv1.Get("/hotel", hotelHandler.HandleGetHotels)
-	apiv1.Get("/hotel/:id", hotelHandler.HandleGetHotel)
-	apiv1.Get("/hotel/:id/rooms", hotelHandler.HandleGetRooms)
+	blobs, err := blob.NewLocalBlobStore(os.Getenv("BLOB_STORAGE_DIR"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Room Handlers
+	// Responses to requests with an Idempotency-Key are replayed to retries within the window
+	var idempotencyKeyTTL time.Duration
+	if ttl := os.Getenv("IDEMPOTENCY_KEY_TTL"); len(ttl) > 0 {
+		if idempotencyKeyTTL, err = time.ParseDuration(ttl); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Retries take over keys of requests that got no response within the lease
+	var idempotencyKeyLease time.Duration
+	if lease := os.Getenv("IDEMPOTENCY_KEY_LEASE"); len(lease) > 0 {
+		if idempotencyKeyLease, err = time.ParseDuration(lease); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	apiv1.Get("/room", roomHandler.HandleGetRooms)
-	apiv1.Post("/room/:id/book", roomHandler.HandleBookRoom)
+	config := fiber.Config{
+		ErrorHandler: errors.ErrorHandler,
+		// Bodies past the default BodyLimit are streamed rather than rejected, so photo uploads
+		// can be larger, the routes limit them with middleware.BodyLimit
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	}
+	// Client IPs, which requests are rate limited by, are only taken from the header behind trusted proxies
+	if proxies := os.Getenv("TRUSTED_PROXIES"); len(proxies) > 0 {
+		config.EnableTrustedProxyCheck = true
+		config.TrustedProxies = strings.Split(proxies, ",")
+		config.ProxyHeader = os.Getenv("PROXY_HEADER")
+		if len(config.ProxyHeader) == 0 {
+			config.ProxyHeader = fiber.HeaderXForwardedFor
+		}
+		config.EnableIPValidation = true
+	}
 
-	// Bookings Handlers
+	app := fiber.New(config)
+	// Errors are logged with the ID of their request, clients get it in the X-Request-ID header
+	app.Use(requestid.New())
 
-	apiv1.Get("/booking/:id", bookingHandler.HandleGetBooking)
-	apiv1.Get("/booking/:id/cancel", bookingHandler.HandleCancelBooking)
+	store := db.NewMongoStore(client, idempotencyKeyTTL, idempotencyKeyLease)
+	if err := store.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 
-	// Admin Routes
+	// Loyalty points that couldn't be granted at the checkout are granted in the background
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := api.RetryLoyaltyEarnings(context.Background(), store, rates); err != nil {
+				log.Println("failed to retry loyalty earnings:", err)
+			}
+		}
+	}()
 
-	admin.Get("/booking", bookingHandler.HandleGetBookings)
+	api.RegisterRoutes(app, store, rates, payments, blobs, ratelimit.NewMemoryStore())
 
 	listenAddr := os.Getenv("LISTEN_ADDR")
 	log.Fatal(app.Listen(listenAddr))
@@ -0,0 +1,172 @@
+// Package openapi builds OpenAPI 3 documents, schemas are generated from Go types.
+package openapi
+
+import (
+	_ "embed"
+	"regexp"
+	"strings"
+)
+
+const Version = "3.0.3"
+
+// UI is the page of the interactive docs, it renders the document served at ./openapi.json
+//
+//go:embed ui.html
+var UI []byte
+
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lowercase HTTP methods to their operations
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// SecurityRequirement maps security schemes to their scopes
+type SecurityRequirement map[string][]string
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+	}
+}
+
+// Operation returns the operation of the method on the path, or nil
+func (d *Document) Operation(method, path string) *Operation {
+	return d.Paths[path][strings.ToLower(method)]
+}
+
+// AddOperation adds the operation of the method on the path,
+// the parameters of the path are added to it
+func (d *Document) AddOperation(method, path string, op *Operation) {
+	var params []*Parameter
+	for _, name := range PathParams(path) {
+		params = append(params, &Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	op.Parameters = append(params, op.Parameters...)
+	if op.Responses == nil {
+		op.Responses = map[string]*Response{}
+	}
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+var (
+	routeParamRegex = regexp.MustCompile(`:(\w+)`)
+	pathParamRegex  = regexp.MustCompile(`{(\w+)}`)
+)
+
+// Path turns a Fiber route path into an OpenAPI path, e.g. /user/:id into /user/{id}.
+// A wildcard is named path.
+func Path(route string) string {
+	path := routeParamRegex.ReplaceAllString(route, "{$1}")
+	return strings.ReplaceAll(path, "*", "{path}")
+}
+
+// PathParams lists the names of the parameters of an OpenAPI path, in order
+func PathParams(path string) []string {
+	var names []string
+	for _, match := range pathParamRegex.FindAllStringSubmatch(path, -1) {
+		names = append(names, match[1])
+	}
+
+	return names
+}
+
+// JSONContent describes a JSON body of the schema
+func JSONContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
@@ -0,0 +1,172 @@
+package openapi
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const componentsPrefix = "#/components/schemas/"
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+// SchemaOf returns the schema of the JSON encoding of the value's type.
+// Named structs are added to the components and referenced.
+func (d *Document) SchemaOf(v any) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+// ListOf returns the schema of a list of the value's type
+func (d *Document) ListOf(v any) *Schema {
+	return &Schema{Type: "array", Items: d.SchemaOf(v)}
+}
+
+// Ref references the component schema of the name
+func Ref(name string) *Schema {
+	return &Schema{Ref: componentsPrefix + name}
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case objectIDType:
+		return &Schema{Type: "string", Format: "objectid", Description: "24 hex characters"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return d.schemaOf(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return d.structSchema(t)
+		}
+
+		name := componentName(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// Registered before its fields, so recursive types end up referencing it
+			schema := &Schema{}
+			d.Components.Schemas[name] = schema
+			*schema = *d.structSchema(t)
+		}
+
+		return Ref(name)
+	default:
+		// Interfaces can hold any value
+		return &Schema{}
+	}
+}
+
+// structSchema describes the JSON object of the struct,
+// fields of embedded structs are promoted like encoding/json does
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && len(name) == 0 && fieldType.Kind() == reflect.Struct {
+			for key, property := range d.structSchema(fieldType).Properties {
+				schema.Properties[key] = property
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+		schema.Properties[name] = d.schemaOf(field.Type)
+	}
+
+	return schema
+}
+
+// QueryParams describes the query parameters Fiber parses into the value's struct type
+func (d *Document) QueryParams(v any) []*Parameter {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return d.queryParams(t)
+}
+
+func (d *Document) queryParams(t reflect.Type) []*Parameter {
+	var params []*Parameter
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := field.Tag.Get("query")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			params = append(params, d.queryParams(field.Type)...)
+			continue
+		}
+
+		if len(name) == 0 {
+			name = lowerFirst(field.Name)
+		}
+		params = append(params, &Parameter{
+			Name:   name,
+			In:     "query",
+			Schema: d.schemaOf(field.Type),
+		})
+	}
+
+	return params
+}
+
+func componentName(t reflect.Type) string {
+	r, size := utf8.DecodeRuneInString(t.Name())
+	return string(unicode.ToUpper(r)) + t.Name()[size:]
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
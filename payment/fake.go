@@ -0,0 +1,163 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// FakeTokenApproved is a payment method that is always authorized
+	FakeTokenApproved = "tok_approved"
+	// FakeTokenDeclined is a payment method that is always declined
+	FakeTokenDeclined = "tok_declined"
+)
+
+type fakePayment struct {
+	authorized int64
+	captured   int64
+	refunded   int64
+	voided     bool
+}
+
+// FakeProvider is an in-process PaymentProvider that keeps payments in memory.
+// Every token but FakeTokenDeclined is authorized.
+type FakeProvider struct {
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+	counter  int64
+	secret   []byte
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		payments: map[string]*fakePayment{},
+		secret:   []byte(webhookSecret),
+	}
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error) {
+	if req.Token == FakeTokenDeclined {
+		return nil, ErrDeclined
+	}
+	if req.Amount.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	paymentID := fmt.Sprintf("fake_pay_%d", atomic.AddInt64(&p.counter, 1))
+
+	p.mu.Lock()
+	p.payments[paymentID] = &fakePayment{authorized: req.Amount.Amount}
+	p.mu.Unlock()
+
+	return &Authorization{
+		PaymentID: paymentID,
+		Amount:    req.Amount,
+	}, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, paymentID string, amount int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+	if amount <= 0 || payment.voided || payment.captured+amount > payment.authorized {
+		return ErrInvalidAmount
+	}
+
+	payment.captured += amount
+
+	return nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, paymentID string, amount int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+	if amount <= 0 || payment.refunded+amount > payment.captured {
+		return ErrInvalidAmount
+	}
+
+	payment.refunded += amount
+
+	return nil
+}
+
+// Void releases the authorized amount that wasn't captured, nothing can be captured after
+func (p *FakeProvider) Void(ctx context.Context, paymentID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	payment.voided = true
+
+	return nil
+}
+
+// ParseWebhook verifies the hex encoded HMAC-SHA256 signature of the payload.
+// Without a secret anyone could sign payloads, so every payload is rejected then.
+func (p *FakeProvider) ParseWebhook(payload []byte, signature string) (*WebhookEvent, error) {
+	if len(p.secret) == 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, p.sign(payload)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// SignWebhook returns the signature the provider would send along with the payload
+func (p *FakeProvider) SignWebhook(payload []byte) string {
+	return hex.EncodeToString(p.sign(payload))
+}
+
+// Captured returns the captured and refunded amounts of a payment
+func (p *FakeProvider) Captured(paymentID string) (captured int64, refunded int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if payment, ok := p.payments[paymentID]; ok {
+		return payment.captured, payment.refunded
+	}
+
+	return 0, 0
+}
+
+// Voided reports whether the rest of the authorization of a payment was released
+func (p *FakeProvider) Voided(paymentID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	return ok && payment.voided
+}
+
+func (p *FakeProvider) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
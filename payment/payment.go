@@ -0,0 +1,52 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"github.com/rtsoy/hotel-reservation/types"
+)
+
+var (
+	ErrDeclined         = errors.New("payment declined")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrNotFound         = errors.New("payment not found")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+	EventRefundSucceeded = "refund.succeeded"
+)
+
+// PaymentProvider is a payment service provider. Amounts are authorized first
+// and captured later, possibly in several parts, captured amounts can be refunded.
+// Voiding releases the part of the authorization that won't be captured anymore.
+type PaymentProvider interface {
+	Authorize(context.Context, AuthorizeRequest) (*Authorization, error)
+	Capture(ctx context.Context, paymentID string, amount int64) error
+	Refund(ctx context.Context, paymentID string, amount int64) error
+	Void(ctx context.Context, paymentID string) error
+	ParseWebhook(payload []byte, signature string) (*WebhookEvent, error)
+}
+
+type AuthorizeRequest struct {
+	Amount types.Money
+	// Token is the payment method tokenized by the provider on the client side
+	Token string
+	// Reference links the payment to our booking
+	Reference string
+}
+
+type Authorization struct {
+	PaymentID string
+	Amount    types.Money
+}
+
+// WebhookEvent is an asynchronous notification about a payment
+type WebhookEvent struct {
+	Type      string `json:"type"`
+	PaymentID string `json:"paymentID"`
+	Reference string `json:"reference"`
+	Amount    int64  `json:"amount"`
+}
@@ -0,0 +1,143 @@
+// Package pdf writes simple text-only PDF documents without external dependencies.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pageWidth  = 595 // A4 in points
+	pageHeight = 842
+	margin     = 50
+	lineHeight = 16
+)
+
+type line struct {
+	text string
+	size int
+	x, y int
+}
+
+// Document is a list of text lines laid out top to bottom on A4 pages
+// using the standard Helvetica font.
+type Document struct {
+	pages [][]line
+	y     int
+}
+
+func New() *Document {
+	return &Document{
+		pages: [][]line{{}},
+		y:     pageHeight - margin,
+	}
+}
+
+// Heading adds a line of larger text
+func (d *Document) Heading(text string) {
+	d.add(line{text: text, size: 16, x: margin})
+	d.y -= lineHeight / 2
+}
+
+// Text adds a line of regular text
+func (d *Document) Text(text string) {
+	d.add(line{text: text, size: 10, x: margin})
+}
+
+// Row adds a line with the label on the left and the value aligned to the right margin
+func (d *Document) Row(label, value string) {
+	d.add(line{text: label, size: 10, x: margin})
+	d.y += lineHeight
+	d.add(line{text: value, size: 10, x: pageWidth - margin - textWidth(value, 10)})
+}
+
+// Space adds an empty line
+func (d *Document) Space() {
+	d.y -= lineHeight
+}
+
+func (d *Document) add(l line) {
+	if d.y < margin {
+		d.pages = append(d.pages, []line{})
+		d.y = pageHeight - margin
+	}
+
+	l.y = d.y
+	page := len(d.pages) - 1
+	d.pages[page] = append(d.pages[page], l)
+	d.y -= lineHeight
+}
+
+// WriteTo writes the document in PDF 1.4 format
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1 and 2 are the catalog and the page tree, 3 is the font,
+	// then every page is followed by its content stream
+	kids := make([]string, 0, len(d.pages))
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+i*2))
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		var content bytes.Buffer
+		for _, l := range page {
+			fmt.Fprintf(&content, "BT /F1 %d Tf %d %d Td (%s) Tj ET\n", l.size, l.x, l.y, escape(l.text))
+		}
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 5+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// escape makes the text safe for a PDF string literal, characters
+// outside of Latin-1 can't be shown by the standard fonts
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteRune(' ')
+		case r > 255:
+			b.WriteRune('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+
+	return b.String()
+}
+
+// textWidth approximates the width of Helvetica text, good enough for right alignment of amounts
+func textWidth(text string, size int) int {
+	return len([]rune(text)) * size * 556 / 1000
+}
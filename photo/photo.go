@@ -0,0 +1,142 @@
+// Package photo validates uploaded images and generates thumbnails in pure Go.
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	MaxSize = 5 << 20
+	// MaxUploadSize leaves room for the multipart overhead of an upload of a photo
+	MaxUploadSize = MaxSize + 1<<20
+	// maxPixels protects against small files decoding to huge images
+	maxPixels = 40_000_000
+
+	ThumbnailWidth = 320
+	jpegQuality    = 85
+)
+
+var (
+	ErrTooLarge        = errors.New("photo is too large")
+	ErrUnsupportedType = errors.New("photo should be a JPEG, PNG or GIF image")
+)
+
+// extensions of the supported content types
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Photo is a validated image
+type Photo struct {
+	Image       image.Image
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// Decode validates the size and type of the data by its content, not by the
+// name or content type sent by the client, and decodes the image
+func Decode(data []byte) (*Photo, error) {
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	return &Photo{
+		Image:       img,
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       config.Width,
+		Height:      config.Height,
+	}, nil
+}
+
+// Thumbnail scales the image down to the width keeping the aspect ratio,
+// every pixel of the thumbnail averages the pixels of the image it covers.
+// Images narrower than the width are not scaled up.
+func Thumbnail(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		width = bounds.Dx()
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height == 0 {
+		height = 1
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			thumb.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return thumb
+}
+
+// EncodeJPEG encodes thumbnails, transparent pixels become black
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery is the number of takes between removals of full buckets
+const sweepEvery = 1000
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// refill adds the tokens refilled since the last update
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens = math.Min(float64(b.limit.Requests), b.tokens+float64(elapsed)/float64(b.limit.refillInterval()))
+	b.updated = now
+}
+
+// MemoryStore keeps the buckets in memory, so limits apply per instance of the API
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	s.takes++
+	if s.takes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Requests), updated: now, limit: limit}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(limit.refillInterval()))
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(limit.Requests) - b.tokens) * float64(limit.refillInterval()))
+
+	return result, nil
+}
+
+// sweep removes the buckets that are full again, they are the same as new ones
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Requests) {
+			delete(s.buckets, key)
+		}
+	}
+}
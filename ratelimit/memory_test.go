@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store with a clock that only moves when the test advances it
+func newTestStore() (*MemoryStore, func(time.Duration)) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	return store, func(d time.Duration) { now = now.Add(d) }
+}
+
+func take(t *testing.T, store *MemoryStore, key string, limit Limit) Result {
+	t.Helper()
+
+	result, err := store.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	var (
+		store, advance = newTestStore()
+		limit          = Limit{Requests: 3, Per: 3 * time.Second}
+	)
+
+	for i := 0; i < limit.Requests; i++ {
+		result := take(t, store, "user:1", limit)
+		if !result.Allowed {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+		if result.Remaining != limit.Requests-i-1 {
+			t.Fatalf("expected %d remaining but got %d", limit.Requests-i-1, result.Remaining)
+		}
+		if expected := time.Duration(i+1) * time.Second; result.Reset != expected {
+			t.Fatalf("expected reset in %s but got %s", expected, result.Reset)
+		}
+	}
+
+	result := take(t, store, "user:1", limit)
+	if result.Allowed {
+		t.Fatalf("expected the request over the limit to be denied")
+	}
+	if result.RetryAfter != time.Second {
+		t.Fatalf("expected retry after 1s but got %s", result.RetryAfter)
+	}
+	if result.Reset != 3*time.Second {
+		t.Fatalf("expected reset in 3s but got %s", result.Reset)
+	}
+
+	// A token is refilled every second
+	advance(500 * time.Millisecond)
+	if result = take(t, store, "user:1", limit); result.Allowed {
+		t.Fatalf("expected the request to be denied before a token is refilled")
+	}
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected retry after 500ms but got %s", result.RetryAfter)
+	}
+
+	advance(500 * time.Millisecond)
+	if result = take(t, store, "user:1", limit); !result.Allowed {
+		t.Fatalf("expected the request to be allowed after a token is refilled")
+	}
+
+	// The bucket doesn't refill past the limit
+	advance(time.Hour)
+	if result = take(t, store, "user:1", limit); result.Remaining != limit.Requests-1 {
+		t.Fatalf("expected %d remaining but got %d", limit.Requests-1, result.Remaining)
+	}
+}
+
+func TestMemoryStoreKeys(t *testing.T) {
+	var (
+		store, _ = newTestStore()
+		limit    = PerMinute(1)
+	)
+
+	if result := take(t, store, "auth:user:1", limit); !result.Allowed {
+		t.Fatalf("expected the first request of user 1 to be allowed")
+	}
+	if result := take(t, store, "auth:user:1", limit); result.Allowed {
+		t.Fatalf("expected the second request of user 1 to be denied")
+	}
+
+	// Users and routes have separate buckets
+	for _, key := range []string{"auth:user:2", "search:user:1", "auth:ip:10.0.0.1"} {
+		if result := take(t, store, key, limit); !result.Allowed {
+			t.Fatalf("expected the first request of %s to be allowed", key)
+		}
+	}
+
+	// A changed limit starts a new bucket
+	if result := take(t, store, "auth:user:1", PerMinute(2)); !result.Allowed {
+		t.Fatalf("expected the request to be allowed under the new limit")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	var (
+		store, advance = newTestStore()
+		limit          = Limit{Requests: 2, Per: 2 * time.Second}
+	)
+
+	take(t, store, "user:1", limit)
+	advance(time.Second)
+	take(t, store, "user:2", limit)
+	take(t, store, "user:2", limit)
+
+	// The bucket of user 1 is full again, the one of user 2 isn't
+	advance(time.Second)
+	for store.takes < sweepEvery {
+		take(t, store, "user:3", PerMinute(sweepEvery))
+	}
+
+	if _, ok := store.buckets["user:1"]; ok {
+		t.Fatalf("expected the full bucket of user 1 to be swept")
+	}
+	if _, ok := store.buckets["user:2"]; !ok {
+		t.Fatalf("expected the bucket of user 2 to be kept")
+	}
+
+	// A swept bucket is the same as a full one
+	if result := take(t, store, "user:1", limit); result.Remaining != limit.Requests-1 {
+		t.Fatalf("expected %d remaining but got %d", limit.Requests-1, result.Remaining)
+	}
+}
+
+func TestMemoryStoreInvalidLimit(t *testing.T) {
+	store, _ := newTestStore()
+
+	for _, limit := range []Limit{{Requests: 0, Per: time.Minute}, {Requests: -1, Per: time.Minute}, {Requests: 1, Per: 0}} {
+		if _, err := store.Take(context.Background(), "user:1", limit); err != ErrInvalidLimit {
+			t.Fatalf("expected %v for limit %+v but got %v", ErrInvalidLimit, limit, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Package ratelimit throttles requests with token buckets.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("limit should allow a positive number of requests per a positive period")
+
+// Limit allows Requests per period, in bursts of up to Requests.
+// The bucket of a key holds Requests tokens and refills at Requests per Per.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func PerMinute(requests int) Limit {
+	return Limit{Requests: requests, Per: time.Minute}
+}
+
+// Validate rejects limits that would never refill their buckets
+func (l Limit) Validate() error {
+	if l.Requests <= 0 || l.Per <= 0 {
+		return ErrInvalidLimit
+	}
+
+	return nil
+}
+
+// refillInterval is the time it takes to refill a single token
+func (l Limit) refillInterval() time.Duration {
+	return l.Per / time.Duration(l.Requests)
+}
+
+// Result tells whether a request was allowed and how the bucket of its key stands
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when it's allowed now
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets of the keys, implementations backed by a shared
+// store such as Redis let several instances of the API share the limits
+type Store interface {
+	// Take takes a token from the bucket of the key if there's one left
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
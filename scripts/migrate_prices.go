@@ -0,0 +1,31 @@
+//go:build ignore
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/rtsoy/hotel-reservation/db"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+)
+
+// Converts the room prices stored in dollars before money was kept in minor units,
+// it has to run once before the API is upgraded
+func main() {
+	ctx := context.Background()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(db.DBURI))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+
+	rooms, hotels, err := db.MigratePricesToMinorUnits(ctx, client)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("migrated the prices of %d rooms and the room types of %d hotels\n", rooms, hotels)
+}
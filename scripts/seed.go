@@ -55,15 +55,15 @@ func main() {
 		// Rooms
 
 		smallRoom := fixtures.AddRoom(store, "small", fake.Bool(),
-			float64(fake.IntBetween(100, 500)), hotel.ID)
+			int64(fake.IntBetween(100, 500)*100), hotel.ID)
 		rooms = append(rooms, smallRoom)
 
 		mediumRoom := fixtures.AddRoom(store, "medium", fake.Bool(),
-			float64(fake.IntBetween(500, 1000)), hotel.ID)
+			int64(fake.IntBetween(500, 1000)*100), hotel.ID)
 		rooms = append(rooms, mediumRoom)
 
 		largeRoom := fixtures.AddRoom(store, "large", fake.Bool(),
-			float64(fake.IntBetween(1000, 2000)), hotel.ID)
+			int64(fake.IntBetween(1000, 2000)*100), hotel.ID)
 		rooms = append(rooms, largeRoom)
 	}
 
@@ -83,7 +83,7 @@ func main() {
 			NumPersons: numPersons,
 		}
 
-		isAvailable, err := api.IsRoomAvailableForBooking(context.Background(), store.Booking, room, params)
+		isAvailable, err := api.IsRoomAvailableForBooking(context.Background(), store, room, params)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -110,12 +110,10 @@ func init() {
 		log.Fatal(err)
 	}
 
-	store = &db.Store{}
-
-	store.User = db.NewMongoUserStore(client)
-	store.Hotel = db.NewMongoHotelStore(client)
-	store.Room = db.NewMongoRoomStore(client, store.Hotel)
-	store.Booking = db.NewMongoBookingStore(client)
+	store = db.NewMongoStore(client, db.DefaultIdempotencyKeyTTL, db.DefaultIdempotencyKeyLease)
+	if err := store.EnsureIndexes(ctx); err != nil {
+		log.Fatal(err)
+	}
 
 	fake = faker.New()
 }
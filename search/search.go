@@ -0,0 +1,174 @@
+// Package search scores and highlights free text matches, tolerating typos.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	exactScore  = 1.0
+	prefixScore = 0.8
+	fuzzyScore  = 0.6
+	// fuzzyPenalty lowers the score of a fuzzy match for every edit
+	fuzzyPenalty = 0.1
+
+	HighlightStart = "<em>"
+	HighlightEnd   = "</em>"
+)
+
+// Tokenize splits the text into lower case words
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isSeparator)
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Levenshtein returns the number of single rune edits turning a into b
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// maxEdits is the number of typos tolerated in a term, short terms must be spelled right
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// matchWord scores how well the word matches the query term, 0 means no match
+func matchWord(term, word string) float64 {
+	if word == term {
+		return exactScore
+	}
+	if strings.HasPrefix(word, term) {
+		return prefixScore
+	}
+
+	edits := maxEdits(term)
+	if edits == 0 {
+		return 0
+	}
+
+	// A typo in the part typed so far also counts, e.g. "hilto" for "hilton"
+	distance := Levenshtein(term, word)
+	if runes := []rune(word); len(runes) > len([]rune(term)) {
+		distance = minInt(distance, Levenshtein(term, string(runes[:len([]rune(term))])))
+	}
+	if distance > edits {
+		return 0
+	}
+
+	return fuzzyScore - fuzzyPenalty*float64(distance-1)
+}
+
+// Score returns how well the text matches the query between 0 and 1. Every term of the query
+// has to match a word of the text exactly, as a prefix or with a few typos.
+func Score(query, text string) float64 {
+	terms := Tokenize(query)
+	words := Tokenize(text)
+	if len(terms) == 0 || len(words) == 0 {
+		return 0
+	}
+
+	var total float64
+	for _, term := range terms {
+		best := 0.0
+		for _, word := range words {
+			if score := matchWord(term, word); score > best {
+				best = score
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+
+		total += best
+	}
+
+	return total / float64(len(terms))
+}
+
+// Highlight wraps the words of the text matching a term of the query in HighlightStart
+// and HighlightEnd, and reports whether anything matched. The rest of the text is
+// HTML escaped, so the highlighted text can be rendered as HTML.
+func Highlight(query, text string) (string, bool) {
+	terms := Tokenize(query)
+
+	var (
+		b       strings.Builder
+		matched bool
+		runes   = []rune(text)
+	)
+
+	for i := 0; i < len(runes); {
+		if isSeparator(runes[i]) {
+			b.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && !isSeparator(runes[j]) {
+			j++
+		}
+
+		word := string(runes[i:j])
+		if matchesAny(terms, strings.ToLower(word)) {
+			b.WriteString(HighlightStart + html.EscapeString(word) + HighlightEnd)
+			matched = true
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+
+		i = j
+	}
+
+	return b.String(), matched
+}
+
+func matchesAny(terms []string, word string) bool {
+	for _, term := range terms {
+		if matchWord(term, word) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
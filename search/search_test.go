@@ -0,0 +1,104 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Hilton Garden-Inn, Rome 2")
+
+	expected := []string{"hilton", "garden", "inn", "rome", "2"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("expected %v but got %v", expected, tokens)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"hilton", "hilton", 0},
+		{"hilton", "hiltno", 2},
+		{"hiltn", "hilton", 1},
+		{"", "inn", 3},
+		{"zürich", "zurich", 1},
+	}
+
+	for _, tt := range tests {
+		if distance := Levenshtein(tt.a, tt.b); distance != tt.expected {
+			t.Fatalf("expected distance %d between %s and %s but got %d", tt.expected, tt.a, tt.b, distance)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		text     string
+		expected float64
+	}{
+		{"exact", "hilton", "Hilton Garden Inn", exactScore},
+		{"prefix", "hil", "Hilton Garden Inn", prefixScore},
+		{"typo", "hiltn", "Hilton Garden Inn", fuzzyScore},
+		{"two typos", "hlitno", "Hilton Garden Inn", 0},
+		{"typo in a short term", "inm", "Hilton Garden Inn", 0},
+		{"every term matches", "hilton garden", "Hilton Garden Inn", exactScore},
+		{"a term doesn't match", "hilton paris", "Hilton Garden Inn", 0},
+		{"empty query", "", "Hilton Garden Inn", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if score := Score(tt.query, tt.text); score != tt.expected {
+				t.Fatalf("expected score %v but got %v", tt.expected, score)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		text            string
+		expected        string
+		expectedMatched bool
+	}{
+		{
+			name:            "matched words",
+			query:           "garden hiltn",
+			text:            "Hilton Garden Inn",
+			expected:        "<em>Hilton</em> <em>Garden</em> Inn",
+			expectedMatched: true,
+		},
+		{
+			name:            "no match",
+			query:           "paris",
+			text:            "Hilton Garden Inn",
+			expected:        "Hilton Garden Inn",
+			expectedMatched: false,
+		},
+		{
+			name:            "markup is escaped",
+			query:           "inn",
+			text:            `<script>alert("inn")</script> & Inn`,
+			expected:        "&lt;script&gt;alert(&#34;<em>inn</em>&#34;)&lt;/script&gt; &amp; <em>Inn</em>",
+			expectedMatched: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			highlighted, matched := Highlight(tt.query, tt.text)
+			if highlighted != tt.expected {
+				t.Fatalf("expected %q but got %q", tt.expected, highlighted)
+			}
+			if matched != tt.expectedMatched {
+				t.Fatalf("expected matched %t but got %t", tt.expectedMatched, matched)
+			}
+		})
+	}
+}
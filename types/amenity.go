@@ -0,0 +1,52 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// HotelAmenities are the facilities a hotel can list
+var HotelAmenities = []string{
+	"wifi", "parking", "pool", "gym", "spa", "restaurant", "bar",
+	"room_service", "airport_shuttle", "ev_charging", "beach_access", "kids_club",
+}
+
+// RoomAmenities are the facilities a room can list
+var RoomAmenities = []string{
+	"wifi", "air_conditioning", "tv", "minibar", "safe", "balcony",
+	"kitchenette", "bathtub", "coffee_machine", "workspace",
+}
+
+var (
+	languageRegex  = regexp.MustCompile("^[a-z]{2}$")
+	timeOfDayRegex = regexp.MustCompile("^([01][0-9]|2[0-3]):[0-5][0-9]$")
+)
+
+func (ve *ValidationError) checkAmenities(field string, amenities, known []string) {
+	for i, amenity := range amenities {
+		found := false
+		for _, k := range known {
+			if amenity == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ve.Add(fmt.Sprintf("%s[%d]", field, i), ViolationUnknown, "unknown amenity %s", amenity)
+		}
+	}
+}
+
+// IsLanguageValid reports whether the language is an ISO 639-1 code, as descriptions are keyed by
+func IsLanguageValid(language string) bool {
+	return languageRegex.MatchString(language)
+}
+
+// checkDescriptions checks that descriptions are keyed by ISO 639-1 language codes
+func (ve *ValidationError) checkDescriptions(field string, descriptions map[string]string) {
+	for language := range descriptions {
+		if !languageRegex.MatchString(language) {
+			ve.Add(field, ViolationInvalid, "description language should be an ISO 639-1 code, got %s", language)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package types
+
+import "net/http"
+
+// Machine-readable error codes, they are stable and clients can rely on them
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeMalformedBody        = "malformed_body"
+	CodeInvalidQuery         = "invalid_query"
+	CodeInvalidID            = "invalid_id"
+	CodeWrongCredentials     = "wrong_credentials"
+	CodeUnauthorized         = "unauthorized"
+	CodeNoToken              = "no_token"
+	CodeInvalidToken         = "invalid_token"
+	CodeTokenExpired         = "token_expired"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeDuplicate            = "duplicate"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMedia     = "unsupported_media_type"
+	CodeUnprocessable        = "unprocessable"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeTooManyRequests      = "too_many_requests"
+	CodeInternal             = "internal_error"
+	CodeServiceUnavailable   = "service_unavailable"
+	CodeTimeout              = "timeout"
+
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+
+	CodeBookingNotCancelable = "booking_not_cancelable"
+)
+
+// statusCodes are the error codes of errors that only have a status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusPreconditionRequired:  CodePreconditionRequired,
+	http.StatusTooManyRequests:       CodeTooManyRequests,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusServiceUnavailable:    CodeServiceUnavailable,
+	http.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// APIError is the JSON body of the error responses of the API
+type APIError struct {
+	Code       int         `json:"code"`
+	ErrorCode  string      `json:"errorCode"`
+	Message    string      `json:"message"`
+	RequestID  string      `json:"requestId,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+func (e APIError) Error() string {
+	return e.Message
+}
+
+// NewAPIError creates an error with the error code of its status
+func NewAPIError(code int, msg string) APIError {
+	errorCode, ok := statusCodes[code]
+	if !ok {
+		errorCode = CodeBadRequest
+		if code >= http.StatusInternalServerError {
+			errorCode = CodeInternal
+		}
+	}
+
+	return APIError{
+		Code:      code,
+		ErrorCode: errorCode,
+		Message:   msg,
+	}
+}
@@ -1,34 +1,85 @@
 package types
 
 import (
-	"fmt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
 
 type BookRoomParams struct {
-	FromDate   time.Time `json:"fromDate"`
-	TillDate   time.Time `json:"tillDate"`
-	NumPersons int       `json:"numPersons"`
+	FromDate      time.Time `json:"fromDate"`
+	TillDate      time.Time `json:"tillDate"`
+	NumPersons    int       `json:"numPersons"`
+	PromoCode     string    `json:"promoCode"`
+	PaymentToken  string    `json:"paymentToken"`
+	LoyaltyPoints int64     `json:"loyaltyPoints"`
 }
 
 func (brp BookRoomParams) Validate() error {
-	if brp.FromDate.After(brp.TillDate) {
-		return fmt.Errorf("From date cannot be after till date")
+	ve := &ValidationError{}
+
+	ve.checkDateRange("fromDate", brp.FromDate, "tillDate", brp.TillDate)
+	if !brp.FromDate.IsZero() && time.Now().After(brp.FromDate) {
+		ve.Add("fromDate", ViolationOutOfRange, "Cannot book a room in the past")
+	}
+	if brp.NumPersons < 0 {
+		ve.Add("numPersons", ViolationOutOfRange, "numPersons cannot be negative")
 	}
-	if time.Now().After(brp.FromDate) {
-		return fmt.Errorf("Cannot book a room in the past")
+	if brp.LoyaltyPoints < 0 {
+		ve.Add("loyaltyPoints", ViolationOutOfRange, "loyaltyPoints cannot be negative")
 	}
 
-	return nil
+	return ve.Err()
+}
+
+type AssignRoomParams struct {
+	RoomID primitive.ObjectID `json:"roomID"`
 }
 
+func (arp AssignRoomParams) Validate() error {
+	ve := &ValidationError{}
+
+	if arp.RoomID.IsZero() {
+		ve.Add("roomID", ViolationRequired, "roomID is required")
+	}
+
+	return ve.Err()
+}
+
+// Booking is made either for a concrete room or for a room type,
+// in the latter case RoomID stays empty until a room is assigned.
 type Booking struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	UserID     primitive.ObjectID `bson:"userID" json:"userID"`
-	RoomID     primitive.ObjectID `bson:"roomID" json:"roomID"`
-	NumPersons int                `bson:"numPersons" json:"numPersons"`
-	FromDate   time.Time          `bson:"fromDate" json:"fromDate"`
-	TillDate   time.Time          `bson:"tillDate" json:"tillDate"`
-	Canceled   bool               `bson:"canceled" json:"canceled"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID        primitive.ObjectID `bson:"userID" json:"userID"`
+	HotelID       primitive.ObjectID `bson:"hotelID,omitempty" json:"hotelID,omitempty"`
+	RoomTypeID    primitive.ObjectID `bson:"roomTypeID,omitempty" json:"roomTypeID,omitempty"`
+	RoomID        primitive.ObjectID `bson:"roomID,omitempty" json:"roomID,omitempty"`
+	NumPersons    int                `bson:"numPersons" json:"numPersons"`
+	FromDate      time.Time          `bson:"fromDate" json:"fromDate"`
+	TillDate      time.Time          `bson:"tillDate" json:"tillDate"`
+	Canceled      bool               `bson:"canceled" json:"canceled"`
+	CheckedOut    bool               `bson:"checkedOut" json:"checkedOut"`
+	Price         *PriceBreakdown    `bson:"price,omitempty" json:"price,omitempty"`
+	PromoCodeID   primitive.ObjectID `bson:"promoCodeID,omitempty" json:"promoCodeID,omitempty"`
+	LoyaltyPoints int64              `bson:"loyaltyPoints,omitempty" json:"loyaltyPoints,omitempty"`
+	Status        string             `bson:"status" json:"status"`
+	Payment       *BookingPayment    `bson:"payment,omitempty" json:"payment,omitempty"`
+	// LoyaltyPending is true from the checkout until the points for the stay are earned
+	LoyaltyPending bool `bson:"loyaltyPending,omitempty" json:"-"`
+}
+
+const (
+	BookingPending   = "pending"
+	BookingConfirmed = "confirmed"
+	BookingFailed    = "failed"
+)
+
+// BookingPayment tracks the money moved through the payment provider, in minor units
+type BookingPayment struct {
+	PaymentID  string `bson:"paymentID" json:"paymentID"`
+	Currency   string `bson:"currency" json:"currency"`
+	Authorized int64  `bson:"authorized" json:"authorized"`
+	Captured   int64  `bson:"captured" json:"captured"`
+	Refunded   int64  `bson:"refunded" json:"refunded"`
+	// Voided is the authorized amount released without being captured
+	Voided int64 `bson:"voided" json:"voided"`
 }
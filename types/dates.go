@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+// Nights returns the number of nights between two dates, ignoring the time of day.
+func Nights(fromDate, tillDate time.Time) int {
+	return int(truncateToDay(tillDate).Sub(truncateToDay(fromDate)).Hours() / 24)
+}
+
+func truncateToDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StayNights returns the first moment of every night between fromDate and tillDate.
+func StayNights(fromDate, tillDate time.Time) []time.Time {
+	var (
+		nights = []time.Time{}
+		last   = truncateToDay(tillDate)
+	)
+
+	for night := truncateToDay(fromDate); night.Before(last); night = night.AddDate(0, 0, 1) {
+		nights = append(nights, night)
+	}
+
+	return nights
+}
+
+// coversNight reports whether a stay from fromDate till tillDate includes the night.
+func coversNight(fromDate, tillDate, night time.Time) bool {
+	return !night.Before(truncateToDay(fromDate)) && night.Before(truncateToDay(tillDate))
+}
@@ -0,0 +1,250 @@
+package types
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	FolioRoom         = "room"
+	FolioDiscount     = "discount"
+	FolioTax          = "tax"
+	FolioFee          = "fee"
+	FolioExtra        = "extra"
+	FolioCancellation = "cancellation"
+	FolioPayment      = "payment"
+	FolioRefund       = "refund"
+
+	InvoiceKindInvoice    = "invoice"
+	InvoiceKindCreditNote = "credit_note"
+)
+
+// FolioLine is a charge or a payment posted to the folio, in minor units.
+// Discounts and cancellations are negative charges, refunds are negative payments.
+type FolioLine struct {
+	Type        string    `bson:"type" json:"type"`
+	Description string    `bson:"description" json:"description"`
+	Amount      int64     `bson:"amount" json:"amount"`
+	Date        time.Time `bson:"date" json:"date"`
+}
+
+func (fl FolioLine) IsPayment() bool {
+	return fl.Type == FolioPayment || fl.Type == FolioRefund
+}
+
+type CreateFolioExtraParams struct {
+	Description string `json:"description"`
+	Amount      int64  `json:"amount"`
+}
+
+func (cfep CreateFolioExtraParams) Validate() error {
+	ve := &ValidationError{}
+
+	if len(cfep.Description) == 0 {
+		ve.Add("description", ViolationRequired, "description is required")
+	}
+	if cfep.Amount <= 0 {
+		ve.Add("amount", ViolationOutOfRange, "amount should be positive")
+	}
+
+	return ve.Err()
+}
+
+// Folio is the account of a stay: everything charged to the guest and everything paid
+type Folio struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	BookingID primitive.ObjectID `bson:"bookingID" json:"bookingID"`
+	HotelID   primitive.ObjectID `bson:"hotelID" json:"hotelID"`
+	UserID    primitive.ObjectID `bson:"userID" json:"userID"`
+	Currency  string             `bson:"currency" json:"currency"`
+	Lines     []FolioLine        `bson:"lines" json:"lines"`
+}
+
+// NewFolioFromBooking posts the booked room nights, discounts, taxes, fees
+// and the captured deposit to a new folio.
+func NewFolioFromBooking(booking *Booking) *Folio {
+	folio := &Folio{
+		BookingID: booking.ID,
+		HotelID:   booking.HotelID,
+		UserID:    booking.UserID,
+		Currency:  DefaultCurrency,
+		Lines:     []FolioLine{},
+	}
+
+	price := booking.Price
+	if price == nil {
+		return folio
+	}
+
+	folio.Currency = price.Currency
+
+	for _, night := range StayNights(booking.FromDate, booking.TillDate) {
+		folio.Lines = append(folio.Lines, FolioLine{
+			Type:        FolioRoom,
+			Description: fmt.Sprintf("Room night %s", night.Format(DateLayout)),
+			Amount:      price.NightPrice,
+			Date:        night,
+		})
+	}
+
+	lines := []struct {
+		lineType   string
+		priceLines []PriceLine
+		sign       int64
+	}{
+		{FolioDiscount, price.Discounts, -1},
+		{FolioTax, price.Taxes, 1},
+		{FolioFee, price.Fees, 1},
+	}
+	for _, l := range lines {
+		for _, priceLine := range l.priceLines {
+			folio.Lines = append(folio.Lines, FolioLine{
+				Type:        l.lineType,
+				Description: priceLine.Name,
+				Amount:      l.sign * priceLine.Amount,
+				Date:        truncateToDay(booking.FromDate),
+			})
+		}
+	}
+
+	if booking.Payment != nil && booking.Payment.Captured > 0 {
+		folio.Lines = append(folio.Lines, NewPaymentFolioLine(booking.Payment.Captured))
+	}
+
+	return folio
+}
+
+func NewPaymentFolioLine(amount int64) FolioLine {
+	if amount < 0 {
+		return FolioLine{
+			Type:        FolioRefund,
+			Description: "Refund",
+			Amount:      amount,
+			Date:        time.Now().UTC(),
+		}
+	}
+
+	return FolioLine{
+		Type:        FolioPayment,
+		Description: "Payment",
+		Amount:      amount,
+		Date:        time.Now().UTC(),
+	}
+}
+
+// Charges returns every line that is not a payment
+func (f Folio) Charges() []FolioLine {
+	charges := []FolioLine{}
+	for _, line := range f.Lines {
+		if !line.IsPayment() {
+			charges = append(charges, line)
+		}
+	}
+
+	return charges
+}
+
+func (f Folio) ChargesTotal() int64 {
+	var total int64
+	for _, line := range f.Charges() {
+		total += line.Amount
+	}
+
+	return total
+}
+
+// LoyaltyEligibleTotal is the part of the charges that earns loyalty points, taxes and fees don't
+func (f Folio) LoyaltyEligibleTotal() int64 {
+	var total int64
+	for _, line := range f.Lines {
+		switch line.Type {
+		case FolioRoom, FolioDiscount, FolioExtra:
+			total += line.Amount
+		}
+	}
+
+	return total
+}
+
+func (f Folio) PaymentsTotal() int64 {
+	var total int64
+	for _, line := range f.Lines {
+		if line.IsPayment() {
+			total += line.Amount
+		}
+	}
+
+	return total
+}
+
+// Invoice is issued from the charges of a folio. A credit note reverses
+// a previous invoice when the stay changes or is canceled after invoicing.
+type Invoice struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Number            string             `bson:"number" json:"number"`
+	Kind              string             `bson:"kind" json:"kind"`
+	HotelID           primitive.ObjectID `bson:"hotelID" json:"hotelID"`
+	BookingID         primitive.ObjectID `bson:"bookingID" json:"bookingID"`
+	UserID            primitive.ObjectID `bson:"userID" json:"userID"`
+	Currency          string             `bson:"currency" json:"currency"`
+	Lines             []FolioLine        `bson:"lines" json:"lines"`
+	Total             int64              `bson:"total" json:"total"`
+	Paid              int64              `bson:"paid" json:"paid"`
+	BalanceDue        int64              `bson:"balanceDue" json:"balanceDue"`
+	IssuedAt          time.Time          `bson:"issuedAt" json:"issuedAt"`
+	CreditedInvoiceID primitive.ObjectID `bson:"creditedInvoiceID,omitempty" json:"creditedInvoiceID,omitempty"`
+	CreditedByNoteID  primitive.ObjectID `bson:"creditedByNoteID,omitempty" json:"creditedByNoteID,omitempty"`
+	// Revision counts the invoices of the booking, a booking has one invoice of each revision
+	Revision int64 `bson:"revision,omitempty" json:"revision,omitempty"`
+}
+
+func InvoiceNumber(kind string, seq int64) string {
+	prefix := "INV"
+	if kind == InvoiceKindCreditNote {
+		prefix = "CN"
+	}
+
+	return fmt.Sprintf("%s-%06d", prefix, seq)
+}
+
+func NewInvoiceFromFolio(folio *Folio, seq int64, revision int64) *Invoice {
+	invoice := &Invoice{
+		Revision:  revision,
+		Number:    InvoiceNumber(InvoiceKindInvoice, seq),
+		Kind:      InvoiceKindInvoice,
+		HotelID:   folio.HotelID,
+		BookingID: folio.BookingID,
+		UserID:    folio.UserID,
+		Currency:  folio.Currency,
+		Lines:     folio.Charges(),
+		Total:     folio.ChargesTotal(),
+		Paid:      folio.PaymentsTotal(),
+		IssuedAt:  time.Now().UTC(),
+	}
+	invoice.BalanceDue = invoice.Total - invoice.Paid
+
+	return invoice
+}
+
+// NewCreditNote reverses every line of the invoice
+func NewCreditNote(invoice *Invoice, seq int64) *Invoice {
+	lines := make([]FolioLine, 0, len(invoice.Lines))
+	for _, line := range invoice.Lines {
+		line.Amount = -line.Amount
+		lines = append(lines, line)
+	}
+
+	return &Invoice{
+		Number:            InvoiceNumber(InvoiceKindCreditNote, seq),
+		Kind:              InvoiceKindCreditNote,
+		HotelID:           invoice.HotelID,
+		BookingID:         invoice.BookingID,
+		UserID:            invoice.UserID,
+		Currency:          invoice.Currency,
+		Lines:             lines,
+		Total:             -invoice.Total,
+		IssuedAt:          time.Now().UTC(),
+		CreditedInvoiceID: invoice.ID,
+	}
+}
@@ -0,0 +1,14 @@
+package types
+
+// GeoPoint is a GeoJSON point, coordinates are [longitude, latitude]
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func NewGeoPoint(latitude, longitude float64) *GeoPoint {
+	return &GeoPoint{
+		Type:        "Point",
+		Coordinates: []float64{longitude, latitude},
+	}
+}
@@ -1,19 +1,340 @@
 package types
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
 
 type Hotel struct {
-	ID       primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
-	Name     string               `bson:"name" json:"name"`
-	Location string               `bson:"location" json:"location"`
-	Rooms    []primitive.ObjectID `bson:"rooms" json:"rooms"`
-	Rating   int                  `bson:"rating" json:"rating"`
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string               `bson:"name" json:"name"`
+	Location  string               `bson:"location" json:"location"`
+	Rooms     []primitive.ObjectID `bson:"rooms" json:"rooms"`
+	RoomTypes []RoomType           `bson:"roomTypes" json:"roomTypes"`
+	Rating    int                  `bson:"rating" json:"rating"`
+	Currency  string               `bson:"currency" json:"currency"`
+	Taxes     []Tax                `bson:"taxes" json:"taxes"`
+	Fees      []Fee                `bson:"fees" json:"fees"`
+
+	Address   Address       `bson:"address" json:"address"`
+	Geo       *GeoPoint     `bson:"geo,omitempty" json:"geo,omitempty"`
+	Amenities []string      `bson:"amenities" json:"amenities"`
+	Policies  HotelPolicies `bson:"policies" json:"policies"`
+	// Descriptions are keyed by ISO 639-1 language code
+	Descriptions map[string]string `bson:"descriptions" json:"descriptions"`
+	Photos       []Photo           `bson:"photos,omitempty" json:"photos"`
+
+	PaymentPolicy PaymentPolicy `bson:"paymentPolicy" json:"paymentPolicy"`
+
+	// Version is bumped by every write of the hotel, see db.MatchVersion
+	Version int64 `bson:"version" json:"version"`
+
+	// Computed from the approved reviews
+	ReviewScore    float64            `bson:"reviewScore" json:"reviewScore"`
+	ReviewCount    int                `bson:"reviewCount" json:"reviewCount"`
+	CategoryScores map[string]float64 `bson:"categoryScores,omitempty" json:"categoryScores,omitempty"`
+
+	// DistanceKm is set by proximity searches and is not stored
+	DistanceKm *float64 `bson:"distanceKm,omitempty" json:"distanceKm,omitempty"`
+
+	// Kept in sync by the hotel store for the search indexes: the lower case words
+	// of the name, location and city, and the descriptions in every language
+	SearchTerms        []string `bson:"searchTerms,omitempty" json:"-"`
+	SearchDescriptions []string `bson:"searchDescriptions,omitempty" json:"-"`
+}
+
+// PriceCurrency returns the currency room prices of the hotel are in
+func (h Hotel) PriceCurrency() string {
+	if len(h.Currency) == 0 {
+		return DefaultCurrency
+	}
+
+	return h.Currency
+}
+
+type Address struct {
+	Street     string  `bson:"street" json:"street"`
+	City       string  `bson:"city" json:"city"`
+	PostalCode string  `bson:"postalCode" json:"postalCode"`
+	Country    string  `bson:"country" json:"country"`
+	Latitude   float64 `bson:"latitude" json:"latitude"`
+	Longitude  float64 `bson:"longitude" json:"longitude"`
+}
+
+func (a Address) Validate() error {
+	ve := &ValidationError{}
+
+	if a.Latitude < -90 || a.Latitude > 90 {
+		ve.Add("latitude", ViolationOutOfRange, "latitude should be between -90 and 90")
+	}
+	if a.Longitude < -180 || a.Longitude > 180 {
+		ve.Add("longitude", ViolationOutOfRange, "longitude should be between -180 and 180")
+	}
+
+	return ve.Err()
+}
+
+// HotelPolicies are the house rules, check-in and check-out times are "HH:MM"
+type HotelPolicies struct {
+	PetsAllowed    bool   `bson:"petsAllowed" json:"petsAllowed"`
+	SmokingAllowed bool   `bson:"smokingAllowed" json:"smokingAllowed"`
+	CheckInFrom    string `bson:"checkInFrom" json:"checkInFrom"`
+	CheckOutUntil  string `bson:"checkOutUntil" json:"checkOutUntil"`
+}
+
+func (hp HotelPolicies) Validate() error {
+	ve := &ValidationError{}
+
+	if len(hp.CheckInFrom) > 0 && !timeOfDayRegex.MatchString(hp.CheckInFrom) {
+		ve.Add("checkInFrom", ViolationInvalid, "checkInFrom should be in HH:MM format")
+	}
+	if len(hp.CheckOutUntil) > 0 && !timeOfDayRegex.MatchString(hp.CheckOutUntil) {
+		ve.Add("checkOutUntil", ViolationInvalid, "checkOutUntil should be in HH:MM format")
+	}
+
+	return ve.Err()
+}
+
+// UpdateHotelParams updates the listing of the hotel, only the given fields are changed
+type UpdateHotelParams struct {
+	Name         string            `json:"name"`
+	Location     string            `json:"location"`
+	Address      *Address          `json:"address"`
+	Amenities    []string          `json:"amenities"`
+	Policies     *HotelPolicies    `json:"policies"`
+	Descriptions map[string]string `json:"descriptions"`
+}
+
+func (uhp UpdateHotelParams) Validate() error {
+	ve := &ValidationError{}
+
+	if uhp.Address != nil {
+		ve.Merge("address", uhp.Address.Validate())
+	}
+	ve.checkAmenities("amenities", uhp.Amenities, HotelAmenities)
+	if uhp.Policies != nil {
+		ve.Merge("policies", uhp.Policies.Validate())
+	}
+	ve.checkDescriptions("descriptions", uhp.Descriptions)
+
+	return ve.Err()
+}
+
+func (uhp UpdateHotelParams) ToBSON() bson.M {
+	m := bson.M{}
+
+	if len(uhp.Name) > 0 {
+		m["name"] = uhp.Name
+	}
+	if len(uhp.Location) > 0 {
+		m["location"] = uhp.Location
+	}
+	if uhp.Address != nil {
+		m["address"] = uhp.Address
+		if uhp.Address.Latitude != 0 || uhp.Address.Longitude != 0 {
+			m["geo"] = NewGeoPoint(uhp.Address.Latitude, uhp.Address.Longitude)
+		}
+	}
+	if uhp.Amenities != nil {
+		m["amenities"] = uhp.Amenities
+	}
+	if uhp.Policies != nil {
+		m["policies"] = uhp.Policies
+	}
+	if uhp.Descriptions != nil {
+		m["descriptions"] = uhp.Descriptions
+	}
+
+	return m
+}
+
+// Unset lists the fields removed by the update, an address without coordinates
+// drops the location of the hotel so it no longer shows up in geo searches
+func (uhp UpdateHotelParams) Unset() bson.M {
+	m := bson.M{}
+
+	if uhp.Address != nil && uhp.Address.Latitude == 0 && uhp.Address.Longitude == 0 {
+		m["geo"] = ""
+	}
+
+	return m
+}
+
+type UpdateHotelPricingParams struct {
+	Currency      string        `json:"currency"`
+	Taxes         []Tax         `json:"taxes"`
+	Fees          []Fee         `json:"fees"`
+	PaymentPolicy PaymentPolicy `json:"paymentPolicy"`
+}
+
+func (uhpp UpdateHotelPricingParams) Validate() error {
+	ve := &ValidationError{}
+
+	if !IsCurrencyValid(uhpp.Currency) {
+		ve.Add("currency", ViolationInvalid, "currency should be a supported ISO 4217 code with two decimal digits")
+	}
+	for i, tax := range uhpp.Taxes {
+		ve.Merge(fmt.Sprintf("taxes[%d]", i), tax.Validate())
+	}
+	for i, fee := range uhpp.Fees {
+		ve.Merge(fmt.Sprintf("fees[%d]", i), fee.Validate())
+	}
+	ve.Merge("paymentPolicy", uhpp.PaymentPolicy.Validate())
+
+	return ve.Err()
+}
+
+func (uhpp UpdateHotelPricingParams) ToBSON() bson.M {
+	m := bson.M{
+		"currency":      uhpp.Currency,
+		"taxes":         []Tax{},
+		"fees":          []Fee{},
+		"paymentPolicy": uhpp.PaymentPolicy,
+	}
+
+	if uhpp.Taxes != nil {
+		m["taxes"] = uhpp.Taxes
+	}
+	if uhpp.Fees != nil {
+		m["fees"] = uhpp.Fees
+	}
+
+	return m
+}
+
+// RoomType returns the hotel's room type with the given id.
+func (h Hotel) RoomType(oid primitive.ObjectID) (*RoomType, bool) {
+	for i := range h.RoomTypes {
+		if h.RoomTypes[i].ID == oid {
+			return &h.RoomTypes[i], true
+		}
+	}
+
+	return nil, false
+}
+
+type CreateRoomTypeParams struct {
+	Name      string               `json:"name"`
+	Inventory int                  `json:"inventory"`
+	Price     int64                `json:"price"`
+	RoomIDs   []primitive.ObjectID `json:"roomIDs"`
+}
+
+func (crtp CreateRoomTypeParams) Validate() error {
+	ve := &ValidationError{}
+
+	if len(crtp.Name) == 0 {
+		ve.Add("name", ViolationRequired, "name is required")
+	}
+	if crtp.Inventory < 0 {
+		ve.Add("inventory", ViolationOutOfRange, "inventory cannot be negative")
+	}
+	if crtp.Inventory == 0 && len(crtp.RoomIDs) == 0 {
+		ve.Add("inventory", ViolationRequired, "inventory or roomIDs is required")
+	}
+	if crtp.Price <= 0 {
+		ve.Add("price", ViolationOutOfRange, "price should be positive")
+	}
+
+	return ve.Err()
+}
+
+// RoomType is a category of rooms the hotel sells ("Deluxe Sea View"),
+// the physical room is assigned to a booking later.
+type RoomType struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Inventory int                `bson:"inventory" json:"inventory"`
+	Price     int64              `bson:"price" json:"price"`
+}
+
+func NewRoomTypeFromParams(params CreateRoomTypeParams) *RoomType {
+	inventory := params.Inventory
+	if inventory == 0 {
+		inventory = len(params.RoomIDs)
+	}
+
+	return &RoomType{
+		ID:        primitive.NewObjectID(),
+		Name:      params.Name,
+		Inventory: inventory,
+		Price:     params.Price,
+	}
+}
+
+// Availability returns how many rooms of the type are left on the worst night
+// of the stay given the overlapping bookings and blocks of that type.
+func (rt RoomType) Availability(fromDate, tillDate time.Time, bookings []*Booking, blocks []*RoomBlock) int {
+	available := rt.Inventory
+
+	for _, night := range StayNights(fromDate, tillDate) {
+		occupied := 0
+		for _, booking := range bookings {
+			if coversNight(booking.FromDate, booking.TillDate, night) {
+				occupied++
+			}
+		}
+		for _, block := range blocks {
+			// A block includes its last day
+			if coversNight(block.FromDate, block.TillDate.AddDate(0, 0, 1), night) {
+				occupied++
+			}
+		}
+
+		if left := rt.Inventory - occupied; left < available {
+			available = left
+		}
+	}
+
+	return available
 }
 
 type Room struct {
-	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Size    string             `bson:"size" json:"size"`
-	Seaside bool               `bson:"seaside" json:"seaside"`
-	Price   float64            `bson:"price" json:"price"`
-	HotelID primitive.ObjectID `bson:"hotelID" json:"hotelID"`
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Size       string             `bson:"size" json:"size"`
+	Seaside    bool               `bson:"seaside" json:"seaside"`
+	Price      int64              `bson:"price" json:"price"`
+	HotelID    primitive.ObjectID `bson:"hotelID" json:"hotelID"`
+	RoomTypeID primitive.ObjectID `bson:"roomTypeID,omitempty" json:"roomTypeID,omitempty"`
+	Amenities  []string           `bson:"amenities" json:"amenities"`
+	Photos     []Photo            `bson:"photos,omitempty" json:"photos"`
+
+	HousekeepingStatus string `bson:"housekeepingStatus" json:"housekeepingStatus"`
+
+	// Version is bumped by every write of the room, see db.MatchVersion
+	Version int64 `bson:"version" json:"version"`
+
+	// DisplayPrice is the price converted to the currency requested by the guest
+	DisplayPrice *Money `bson:"-" json:"displayPrice,omitempty"`
+}
+
+type UpdateRoomParams struct {
+	Amenities []string `json:"amenities"`
+}
+
+func (urp UpdateRoomParams) Validate() error {
+	ve := &ValidationError{}
+
+	if urp.Amenities == nil {
+		ve.Add("amenities", ViolationRequired, "amenities are required")
+	}
+	ve.checkAmenities("amenities", urp.Amenities, RoomAmenities)
+
+	return ve.Err()
+}
+
+func (urp UpdateRoomParams) ToBSON() bson.M {
+	return bson.M{
+		"amenities": urp.Amenities,
+	}
+}
+
+// HotelSearchResult is a hotel matching a search query, highlights
+// are the matching fields with the matched words marked
+type HotelSearchResult struct {
+	Hotel      *Hotel            `json:"hotel"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
 }
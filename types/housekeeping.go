@@ -0,0 +1,62 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	HousekeepingClean      = "clean"
+	HousekeepingDirty      = "dirty"
+	HousekeepingInspected  = "inspected"
+	HousekeepingOutOfOrder = "out_of_order"
+
+	HousekeepingTaskDeparture = "departure"
+	HousekeepingTaskStayover  = "stayover"
+)
+
+// housekeepingTransitions lists statuses a room can be moved to by staff
+var housekeepingTransitions = map[string][]string{
+	HousekeepingDirty:      {HousekeepingClean, HousekeepingOutOfOrder},
+	HousekeepingClean:      {HousekeepingDirty, HousekeepingInspected, HousekeepingOutOfOrder},
+	HousekeepingInspected:  {HousekeepingDirty, HousekeepingOutOfOrder},
+	HousekeepingOutOfOrder: {HousekeepingDirty},
+}
+
+type UpdateHousekeepingParams struct {
+	Status string `json:"status"`
+}
+
+func (uhp UpdateHousekeepingParams) Validate() error {
+	ve := &ValidationError{}
+
+	if _, ok := housekeepingTransitions[uhp.Status]; !ok {
+		ve.Add("status", ViolationInvalid, "status should be one of %s, %s, %s, %s", HousekeepingClean,
+			HousekeepingDirty, HousekeepingInspected, HousekeepingOutOfOrder)
+	}
+
+	return ve.Err()
+}
+
+// CanTransitionHousekeeping reports whether a room can go from one status to another.
+// Rooms without a status are considered clean.
+func CanTransitionHousekeeping(from, to string) bool {
+	if len(from) == 0 {
+		from = HousekeepingClean
+	}
+
+	for _, status := range housekeepingTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HousekeepingTask is a room that has to be serviced on a given day
+type HousekeepingTask struct {
+	RoomID             primitive.ObjectID `json:"roomID"`
+	BookingID          primitive.ObjectID `json:"bookingID"`
+	Type               string             `json:"type"`
+	HousekeepingStatus string             `json:"housekeepingStatus"`
+}
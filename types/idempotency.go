@@ -0,0 +1,26 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// IdempotencyRecord is the response to the first request sent with an Idempotency-Key,
+// retries with the same key get it replayed. Keys are scoped to their user.
+type IdempotencyRecord struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Key    string             `bson:"key" json:"key"`
+	UserID primitive.ObjectID `bson:"userID" json:"userID"`
+	// RequestHash tells retries apart from other requests reusing the key
+	RequestHash string `bson:"requestHash" json:"requestHash"`
+	// Completed is false while the first request is being handled
+	Completed bool `bson:"completed" json:"completed"`
+	// LockedUntil is when the lease of the request being handled runs out,
+	// a retry takes the key over after that, e.g. when the server crashed mid-request
+	LockedUntil time.Time `bson:"lockedUntil" json:"lockedUntil"`
+	StatusCode  int       `bson:"statusCode" json:"statusCode"`
+	ContentType string    `bson:"contentType" json:"contentType"`
+	Body        []byte    `bson:"body" json:"body"`
+	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt   time.Time `bson:"expiresAt" json:"expiresAt"`
+}
@@ -0,0 +1,109 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	LoyaltyEarn     = "earn"
+	LoyaltyBurn     = "burn"
+	LoyaltyReversal = "reversal"
+
+	// LoyaltyPointValue is the discount one point is worth, in minor units of DefaultCurrency
+	LoyaltyPointValue = 1
+	// loyaltyPointsPerUnit is the number of points earned per major unit of
+	// DefaultCurrency paid for a stay, before the tier bonus
+	loyaltyPointsPerUnit = 1
+)
+
+// LoyaltyTier is reached by the points earned over the lifetime of the account,
+// redeeming points never lowers the tier
+type LoyaltyTier struct {
+	Name      string   `json:"name"`
+	MinPoints int64    `json:"minPoints"`
+	EarnRate  int64    `json:"earnRate"` // in basis points, 12500 = 125% of the base points
+	Benefits  []string `json:"benefits"`
+}
+
+// LoyaltyTiers are ordered from the lowest tier
+var LoyaltyTiers = []LoyaltyTier{
+	{
+		Name:      "member",
+		MinPoints: 0,
+		EarnRate:  10000,
+		Benefits:  []string{"Points on every stay"},
+	},
+	{
+		Name:      "silver",
+		MinPoints: 1000,
+		EarnRate:  12500,
+		Benefits:  []string{"25% bonus points", "Late checkout on request"},
+	},
+	{
+		Name:      "gold",
+		MinPoints: 5000,
+		EarnRate:  15000,
+		Benefits:  []string{"50% bonus points", "Guaranteed late checkout", "Room upgrade on availability"},
+	},
+	{
+		Name:      "platinum",
+		MinPoints: 15000,
+		EarnRate:  20000,
+		Benefits:  []string{"100% bonus points", "Guaranteed late checkout", "Guaranteed room upgrade", "Welcome amenity"},
+	},
+}
+
+// LoyaltyTierFor returns the tier for the lifetime points and the next tier, which is nil for the top tier
+func LoyaltyTierFor(lifetimePoints int64) (LoyaltyTier, *LoyaltyTier) {
+	current := 0
+	for i, tier := range LoyaltyTiers {
+		if lifetimePoints >= tier.MinPoints {
+			current = i
+		}
+	}
+
+	if current == len(LoyaltyTiers)-1 {
+		return LoyaltyTiers[current], nil
+	}
+
+	return LoyaltyTiers[current], &LoyaltyTiers[current+1]
+}
+
+// LoyaltyPointsEarned returns the points for an amount paid in minor units of DefaultCurrency
+func LoyaltyPointsEarned(amount, lifetimePoints int64) int64 {
+	if amount <= 0 {
+		return 0
+	}
+
+	tier, _ := LoyaltyTierFor(lifetimePoints)
+
+	return amount / 100 * loyaltyPointsPerUnit * tier.EarnRate / basisPoints
+}
+
+// LoyaltyTransaction is an entry of the loyalty ledger. Applied entries are never changed,
+// points are given back by a reversal entry. An entry is written pending and only marked
+// as applied once its points changed the balance, a pending entry that can't be applied,
+// e.g. a burn of more points than the balance has, is removed. Points are negative for burns.
+type LoyaltyTransaction struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID      primitive.ObjectID `bson:"userID" json:"userID"`
+	BookingID   primitive.ObjectID `bson:"bookingID,omitempty" json:"bookingID,omitempty"`
+	Type        string             `bson:"type" json:"type"`
+	Points      int64              `bson:"points" json:"points"`
+	Description string             `bson:"description" json:"description"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	// Pending is true until the points are applied to the balance of the user
+	Pending bool `bson:"pending" json:"-"`
+}
+
+func NewLoyaltyTransaction(userID, bookingID primitive.ObjectID, transactionType string, points int64, description string) *LoyaltyTransaction {
+	return &LoyaltyTransaction{
+		UserID:      userID,
+		BookingID:   bookingID,
+		Type:        transactionType,
+		Points:      points,
+		Description: description,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
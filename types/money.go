@@ -0,0 +1,209 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultCurrency is used for hotels that have no currency configured
+const DefaultCurrency = "USD"
+
+const (
+	TaxPercentage        = "percentage"
+	TaxPerPersonPerNight = "per_person_per_night"
+
+	// basisPoints is 100% expressed in basis points
+	basisPoints = 10000
+)
+
+// supportedCurrencies are the ISO 4217 currencies with two decimal digits amounts can be in,
+// currencies with other exponents (e.g. JPY, KWD) would be off by a factor of ten or more
+var supportedCurrencies = map[string]bool{
+	"AED": true, "AUD": true, "BGN": true, "BRL": true, "CAD": true, "CHF": true,
+	"CNY": true, "CZK": true, "DKK": true, "EGP": true, "EUR": true, "GBP": true,
+	"HKD": true, "HUF": true, "ILS": true, "INR": true, "KZT": true, "MXN": true,
+	"MYR": true, "NOK": true, "NZD": true, "PHP": true, "PLN": true, "RON": true,
+	"RUB": true, "SAR": true, "SEK": true, "SGD": true, "THB": true, "TRY": true,
+	"UAH": true, "USD": true, "ZAR": true,
+}
+
+// Money is an amount in minor units (cents) of an ISO 4217 currency,
+// only currencies with two decimal digits are supported
+type Money struct {
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+}
+
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, m.Currency)
+}
+
+// IsCurrencyValid reports whether amounts can be in the currency
+func IsCurrencyValid(currency string) bool {
+	return supportedCurrencies[currency]
+}
+
+// Tax is either a percentage of the room price (Rate in basis points, 2000 = 20%)
+// or a fixed amount per person and night (Rate in minor units), e.g. a city tax.
+type Tax struct {
+	Name string `bson:"name" json:"name"`
+	Type string `bson:"type" json:"type"`
+	Rate int64  `bson:"rate" json:"rate"`
+}
+
+func (t Tax) Validate() error {
+	ve := &ValidationError{}
+
+	if len(t.Name) == 0 {
+		ve.Add("name", ViolationRequired, "tax name is required")
+	}
+	if t.Type != TaxPercentage && t.Type != TaxPerPersonPerNight {
+		ve.Add("type", ViolationInvalid, "tax type should be %s or %s", TaxPercentage, TaxPerPersonPerNight)
+	}
+	if t.Rate < 0 {
+		ve.Add("rate", ViolationOutOfRange, "tax rate cannot be negative")
+	}
+
+	return ve.Err()
+}
+
+// Fee is a fixed amount charged once per stay or for every night of it
+type Fee struct {
+	Name     string `bson:"name" json:"name"`
+	Amount   int64  `bson:"amount" json:"amount"`
+	PerNight bool   `bson:"perNight" json:"perNight"`
+}
+
+func (f Fee) Validate() error {
+	ve := &ValidationError{}
+
+	if len(f.Name) == 0 {
+		ve.Add("name", ViolationRequired, "fee name is required")
+	}
+	if f.Amount < 0 {
+		ve.Add("amount", ViolationOutOfRange, "fee amount cannot be negative")
+	}
+
+	return ve.Err()
+}
+
+type PriceLine struct {
+	Name   string `bson:"name" json:"name"`
+	Amount int64  `bson:"amount" json:"amount"`
+}
+
+// PriceBreakdown is the price of a stay, all amounts are in minor units of Currency
+type PriceBreakdown struct {
+	Currency   string      `bson:"currency" json:"currency"`
+	Nights     int         `bson:"nights" json:"nights"`
+	NightPrice int64       `bson:"nightPrice" json:"nightPrice"`
+	RoomTotal  int64       `bson:"roomTotal" json:"roomTotal"`
+	Discounts  []PriceLine `bson:"discounts" json:"discounts"`
+	Taxes      []PriceLine `bson:"taxes" json:"taxes"`
+	Fees       []PriceLine `bson:"fees" json:"fees"`
+	Total      int64       `bson:"total" json:"total"`
+}
+
+// NewPriceBreakdown prices a stay at the hotel. Discounts reduce the room total
+// (never below zero) and percentage taxes apply to the discounted room total only.
+func NewPriceBreakdown(hotel *Hotel, nightPrice int64, nights, numPersons int, discounts ...PriceLine) *PriceBreakdown {
+	breakdown := &PriceBreakdown{
+		Currency:   hotel.PriceCurrency(),
+		Nights:     nights,
+		NightPrice: nightPrice,
+		RoomTotal:  nightPrice * int64(nights),
+		Discounts:  []PriceLine{},
+		Taxes:      []PriceLine{},
+		Fees:       []PriceLine{},
+	}
+	breakdown.Total = breakdown.RoomTotal
+
+	for _, discount := range discounts {
+		if discount.Amount > breakdown.Total {
+			discount.Amount = breakdown.Total
+		}
+
+		breakdown.Discounts = append(breakdown.Discounts, discount)
+		breakdown.Total -= discount.Amount
+	}
+
+	for _, tax := range hotel.Taxes {
+		var amount int64
+		switch tax.Type {
+		case TaxPercentage:
+			amount = PercentOf(breakdown.Total, tax.Rate)
+		case TaxPerPersonPerNight:
+			amount = tax.Rate * int64(numPersons) * int64(nights)
+		}
+
+		breakdown.Taxes = append(breakdown.Taxes, PriceLine{Name: tax.Name, Amount: amount})
+		breakdown.Total += amount
+	}
+
+	for _, fee := range hotel.Fees {
+		amount := fee.Amount
+		if fee.PerNight {
+			amount *= int64(nights)
+		}
+
+		breakdown.Fees = append(breakdown.Fees, PriceLine{Name: fee.Name, Amount: amount})
+		breakdown.Total += amount
+	}
+
+	return breakdown
+}
+
+// PercentOf returns rate basis points of amount rounded half away from zero
+func PercentOf(amount, rate int64) int64 {
+	product := amount * rate
+	if product < 0 {
+		return -((-product + basisPoints/2) / basisPoints)
+	}
+
+	return (product + basisPoints/2) / basisPoints
+}
+
+// PaymentPolicy defines how much of the total is captured as a deposit when
+// booking, and how much is kept when the guest cancels late. Rates are in basis points.
+type PaymentPolicy struct {
+	DepositRate             int64 `bson:"depositRate" json:"depositRate"`
+	FreeCancellationDays    int   `bson:"freeCancellationDays" json:"freeCancellationDays"`
+	CancellationPenaltyRate int64 `bson:"cancellationPenaltyRate" json:"cancellationPenaltyRate"`
+}
+
+func (pp PaymentPolicy) Validate() error {
+	ve := &ValidationError{}
+
+	if pp.DepositRate < 0 || pp.DepositRate > basisPoints {
+		ve.Add("depositRate", ViolationOutOfRange, "depositRate should be between 0 and %d basis points", basisPoints)
+	}
+	if pp.CancellationPenaltyRate < 0 || pp.CancellationPenaltyRate > basisPoints {
+		ve.Add("cancellationPenaltyRate", ViolationOutOfRange, "cancellationPenaltyRate should be between 0 and %d basis points", basisPoints)
+	}
+	if pp.FreeCancellationDays < 0 {
+		ve.Add("freeCancellationDays", ViolationOutOfRange, "freeCancellationDays cannot be negative")
+	}
+
+	return ve.Err()
+}
+
+// Deposit returns the amount captured when the booking is made
+func (pp PaymentPolicy) Deposit(total int64) int64 {
+	return PercentOf(total, pp.DepositRate)
+}
+
+// CancellationPenalty returns the amount kept when a stay starting at
+// fromDate is canceled at now
+func (pp PaymentPolicy) CancellationPenalty(total int64, fromDate, now time.Time) int64 {
+	if Nights(now, fromDate) >= pp.FreeCancellationDays {
+		return 0
+	}
+
+	return PercentOf(total, pp.CancellationPenaltyRate)
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// PhotoURLPrefix is the route photos are served from
+const PhotoURLPrefix = "/api/photo/"
+
+// Photo refers to an image and its thumbnail in the blob store
+type Photo struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	Key          string             `bson:"key" json:"-"`
+	ThumbnailKey string             `bson:"thumbnailKey" json:"-"`
+	URL          string             `bson:"url" json:"url"`
+	ThumbnailURL string             `bson:"thumbnailUrl" json:"thumbnailUrl"`
+	ContentType  string             `bson:"contentType" json:"contentType"`
+	Width        int                `bson:"width" json:"width"`
+	Height       int                `bson:"height" json:"height"`
+	Size         int64              `bson:"size" json:"size"`
+	UploadedAt   time.Time          `bson:"uploadedAt" json:"uploadedAt"`
+}
+
+// NewPhoto stores the photo of an owner (e.g. "hotels", hotelID)
+// under <owner>/<ownerID>/<photoID><ext>
+func NewPhoto(owner string, ownerID primitive.ObjectID, ext, contentType string, width, height int, size int64) *Photo {
+	id := primitive.NewObjectID()
+	key := fmt.Sprintf("%s/%s/%s%s", owner, ownerID.Hex(), id.Hex(), ext)
+	thumbnailKey := fmt.Sprintf("%s/%s/%s_thumb.jpg", owner, ownerID.Hex(), id.Hex())
+
+	return &Photo{
+		ID:           id,
+		Key:          key,
+		ThumbnailKey: thumbnailKey,
+		URL:          PhotoURLPrefix + key,
+		ThumbnailURL: PhotoURLPrefix + thumbnailKey,
+		ContentType:  contentType,
+		Width:        width,
+		Height:       height,
+		Size:         size,
+		UploadedAt:   time.Now().UTC(),
+	}
+}
+
+type ReorderPhotosParams struct {
+	PhotoIDs []primitive.ObjectID `json:"photoIDs"`
+}
+
+// Validate checks that the params list every photo exactly once
+func (rpp ReorderPhotosParams) Validate(photos []Photo) error {
+	ve := &ValidationError{}
+
+	if len(rpp.PhotoIDs) != len(photos) {
+		ve.Add("photoIDs", ViolationInvalid, "photoIDs should list all %d photos", len(photos))
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	for i, id := range rpp.PhotoIDs {
+		if seen[id] {
+			ve.Add(fmt.Sprintf("photoIDs[%d]", i), ViolationDuplicate, "photo %s is listed twice", id.Hex())
+		}
+		seen[id] = true
+	}
+	for _, photo := range photos {
+		if !seen[photo.ID] {
+			ve.Add("photoIDs", ViolationRequired, "photo %s is missing", photo.ID.Hex())
+		}
+	}
+
+	return ve.Err()
+}
+
+// Reorder returns the photos in the order of the ids, the ids should be validated first
+func (rpp ReorderPhotosParams) Reorder(photos []Photo) []Photo {
+	byID := make(map[primitive.ObjectID]Photo, len(photos))
+	for _, photo := range photos {
+		byID[photo.ID] = photo
+	}
+
+	reordered := make([]Photo, 0, len(photos))
+	for _, id := range rpp.PhotoIDs {
+		reordered = append(reordered, byID[id])
+	}
+
+	return reordered
+}
@@ -0,0 +1,171 @@
+package types
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+const (
+	PromoPercentage = "percentage"
+	PromoFixed      = "fixed"
+
+	minPromoCodeLen = 3
+)
+
+type CreatePromoCodeParams struct {
+	Code                  string               `json:"code"`
+	Type                  string               `json:"type"`
+	Value                 int64                `json:"value"`
+	Currency              string               `json:"currency"`
+	ValidFrom             time.Time            `json:"validFrom"`
+	ValidTill             time.Time            `json:"validTill"`
+	StayFrom              time.Time            `json:"stayFrom"`
+	StayTill              time.Time            `json:"stayTill"`
+	MinNights             int                  `json:"minNights"`
+	MaxRedemptions        int                  `json:"maxRedemptions"`
+	MaxRedemptionsPerUser int                  `json:"maxRedemptionsPerUser"`
+	HotelIDs              []primitive.ObjectID `json:"hotelIDs"`
+}
+
+func (cpcp CreatePromoCodeParams) Validate() error {
+	ve := &ValidationError{}
+
+	if len(strings.TrimSpace(cpcp.Code)) < minPromoCodeLen {
+		ve.Add("code", ViolationTooShort, "code length should be at least %d characters", minPromoCodeLen)
+	}
+
+	switch cpcp.Type {
+	case PromoPercentage:
+		if cpcp.Value <= 0 || cpcp.Value > basisPoints {
+			ve.Add("value", ViolationOutOfRange, "percentage value should be between 1 and %d basis points", basisPoints)
+		}
+	case PromoFixed:
+		if cpcp.Value <= 0 {
+			ve.Add("value", ViolationOutOfRange, "fixed value should be positive")
+		}
+		if !IsCurrencyValid(cpcp.Currency) {
+			ve.Add("currency", ViolationInvalid, "currency should be a supported ISO 4217 code with two decimal digits")
+		}
+	default:
+		ve.Add("type", ViolationInvalid, "type should be %s or %s", PromoPercentage, PromoFixed)
+	}
+
+	if !cpcp.ValidFrom.IsZero() && !cpcp.ValidTill.IsZero() && cpcp.ValidFrom.After(cpcp.ValidTill) {
+		ve.Add("validFrom", ViolationDateOrder, "validFrom cannot be after validTill")
+	}
+	if !cpcp.StayFrom.IsZero() && !cpcp.StayTill.IsZero() && cpcp.StayFrom.After(cpcp.StayTill) {
+		ve.Add("stayFrom", ViolationDateOrder, "stayFrom cannot be after stayTill")
+	}
+
+	limits := []struct {
+		field string
+		value int
+	}{
+		{"minNights", cpcp.MinNights},
+		{"maxRedemptions", cpcp.MaxRedemptions},
+		{"maxRedemptionsPerUser", cpcp.MaxRedemptionsPerUser},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			ve.Add(limit.field, ViolationOutOfRange, "%s cannot be negative", limit.field)
+		}
+	}
+
+	return ve.Err()
+}
+
+// PromoCode is a discount campaign code, zero limits and dates mean "unlimited".
+// Redemptions and UserRedemptions are counters updated atomically by the store.
+type PromoCode struct {
+	ID                    primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Code                  string               `bson:"code" json:"code"`
+	Type                  string               `bson:"type" json:"type"`
+	Value                 int64                `bson:"value" json:"value"`
+	Currency              string               `bson:"currency,omitempty" json:"currency,omitempty"`
+	ValidFrom             time.Time            `bson:"validFrom" json:"validFrom"`
+	ValidTill             time.Time            `bson:"validTill" json:"validTill"`
+	StayFrom              time.Time            `bson:"stayFrom" json:"stayFrom"`
+	StayTill              time.Time            `bson:"stayTill" json:"stayTill"`
+	MinNights             int                  `bson:"minNights" json:"minNights"`
+	MaxRedemptions        int                  `bson:"maxRedemptions" json:"maxRedemptions"`
+	MaxRedemptionsPerUser int                  `bson:"maxRedemptionsPerUser" json:"maxRedemptionsPerUser"`
+	HotelIDs              []primitive.ObjectID `bson:"hotelIDs" json:"hotelIDs"`
+	Redemptions           int                  `bson:"redemptions" json:"redemptions"`
+	UserRedemptions       map[string]int       `bson:"userRedemptions" json:"-"`
+}
+
+func NewPromoCodeFromParams(params CreatePromoCodeParams) *PromoCode {
+	hotelIDs := params.HotelIDs
+	if hotelIDs == nil {
+		hotelIDs = []primitive.ObjectID{}
+	}
+
+	return &PromoCode{
+		Code:                  NormalizePromoCode(params.Code),
+		Type:                  params.Type,
+		Value:                 params.Value,
+		Currency:              params.Currency,
+		ValidFrom:             params.ValidFrom,
+		ValidTill:             params.ValidTill,
+		StayFrom:              params.StayFrom,
+		StayTill:              params.StayTill,
+		MinNights:             params.MinNights,
+		MaxRedemptions:        params.MaxRedemptions,
+		MaxRedemptionsPerUser: params.MaxRedemptionsPerUser,
+		HotelIDs:              hotelIDs,
+		UserRedemptions:       map[string]int{},
+	}
+}
+
+// NormalizePromoCode makes codes case-insensitive
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Check returns an error explaining why the code cannot be applied to a stay at the hotel
+func (p PromoCode) Check(hotel *Hotel, fromDate, tillDate, now time.Time) error {
+	if !p.ValidFrom.IsZero() && now.Before(p.ValidFrom) {
+		return fmt.Errorf("Promo code %s is not active yet", p.Code)
+	}
+	if !p.ValidTill.IsZero() && now.After(p.ValidTill) {
+		return fmt.Errorf("Promo code %s has expired", p.Code)
+	}
+	if !p.StayFrom.IsZero() && fromDate.Before(p.StayFrom) || !p.StayTill.IsZero() && tillDate.After(p.StayTill) {
+		return fmt.Errorf("Promo code %s is not valid for the stay dates", p.Code)
+	}
+	if p.MinNights != 0 && Nights(fromDate, tillDate) < p.MinNights {
+		return fmt.Errorf("Promo code %s requires a stay of at least %d nights", p.Code, p.MinNights)
+	}
+	if p.Type == PromoFixed && p.Currency != hotel.PriceCurrency() {
+		return fmt.Errorf("Promo code %s is not valid for this hotel", p.Code)
+	}
+
+	if len(p.HotelIDs) == 0 {
+		return nil
+	}
+	for _, hotelID := range p.HotelIDs {
+		if hotelID == hotel.ID {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Promo code %s is not valid for this hotel", p.Code)
+}
+
+// Discount returns the discount line for a room total
+func (p PromoCode) Discount(roomTotal int64) PriceLine {
+	amount := p.Value
+	if p.Type == PromoPercentage {
+		amount = PercentOf(roomTotal, p.Value)
+	}
+	if amount > roomTotal {
+		amount = roomTotal
+	}
+
+	return PriceLine{
+		Name:   fmt.Sprintf("Promo code %s", p.Code),
+		Amount: amount,
+	}
+}
@@ -0,0 +1,126 @@
+package types
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// DateLayout formats the calendar days of stays, e.g. in messages and documents
+const DateLayout = "2006-01-02"
+
+type CreateRestrictionParams struct {
+	RoomID            primitive.ObjectID `json:"roomID"`
+	FromDate          time.Time          `json:"fromDate"`
+	TillDate          time.Time          `json:"tillDate"`
+	MinLOS            int                `json:"minLOS"`
+	MaxLOS            int                `json:"maxLOS"`
+	ClosedToArrival   bool               `json:"closedToArrival"`
+	ClosedToDeparture bool               `json:"closedToDeparture"`
+	MinAdvanceDays    int                `json:"minAdvanceDays"`
+	MaxAdvanceDays    int                `json:"maxAdvanceDays"`
+}
+
+func (crp CreateRestrictionParams) Validate() error {
+	ve := &ValidationError{}
+
+	ve.checkDateRange("fromDate", crp.FromDate, "tillDate", crp.TillDate)
+
+	limits := []struct {
+		field string
+		value int
+	}{
+		{"minLOS", crp.MinLOS},
+		{"maxLOS", crp.MaxLOS},
+		{"minAdvanceDays", crp.MinAdvanceDays},
+		{"maxAdvanceDays", crp.MaxAdvanceDays},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			ve.Add(limit.field, ViolationOutOfRange, "%s cannot be negative", limit.field)
+		}
+	}
+
+	if crp.MaxLOS != 0 && crp.MinLOS > crp.MaxLOS {
+		ve.Add("minLOS", ViolationOutOfRange, "minLOS cannot be greater than maxLOS")
+	}
+	if crp.MaxAdvanceDays != 0 && crp.MinAdvanceDays > crp.MaxAdvanceDays {
+		ve.Add("minAdvanceDays", ViolationOutOfRange, "minAdvanceDays cannot be greater than maxAdvanceDays")
+	}
+
+	return ve.Err()
+}
+
+// Restriction limits which stays can be booked for a hotel (or a single room
+// of it when RoomID is set) while the arrival date falls into [FromDate, TillDate].
+// Zero values mean "no restriction".
+type Restriction struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	HotelID           primitive.ObjectID `bson:"hotelID" json:"hotelID"`
+	RoomID            primitive.ObjectID `bson:"roomID,omitempty" json:"roomID,omitempty"`
+	FromDate          time.Time          `bson:"fromDate" json:"fromDate"`
+	TillDate          time.Time          `bson:"tillDate" json:"tillDate"`
+	MinLOS            int                `bson:"minLOS" json:"minLOS"`
+	MaxLOS            int                `bson:"maxLOS" json:"maxLOS"`
+	ClosedToArrival   bool               `bson:"closedToArrival" json:"closedToArrival"`
+	ClosedToDeparture bool               `bson:"closedToDeparture" json:"closedToDeparture"`
+	MinAdvanceDays    int                `bson:"minAdvanceDays" json:"minAdvanceDays"`
+	MaxAdvanceDays    int                `bson:"maxAdvanceDays" json:"maxAdvanceDays"`
+	// Version is bumped by every write of the restriction, see db.MatchVersion
+	Version int64 `bson:"version" json:"version"`
+}
+
+func NewRestrictionFromParams(hotelID primitive.ObjectID, params CreateRestrictionParams) *Restriction {
+	return &Restriction{
+		HotelID:           hotelID,
+		RoomID:            params.RoomID,
+		FromDate:          params.FromDate,
+		TillDate:          params.TillDate,
+		MinLOS:            params.MinLOS,
+		MaxLOS:            params.MaxLOS,
+		ClosedToArrival:   params.ClosedToArrival,
+		ClosedToDeparture: params.ClosedToDeparture,
+		MinAdvanceDays:    params.MinAdvanceDays,
+		MaxAdvanceDays:    params.MaxAdvanceDays,
+	}
+}
+
+// Check returns an error describing the rule that blocks a stay from
+// fromDate till tillDate booked at now, or nil if the stay is allowed.
+func (r Restriction) Check(fromDate, tillDate, now time.Time) error {
+	period := fmt.Sprintf("%s - %s", r.FromDate.Format(DateLayout), r.TillDate.Format(DateLayout))
+
+	if r.ClosedToDeparture && r.covers(tillDate) {
+		return fmt.Errorf("Departures are not allowed between %s", period)
+	}
+	if !r.covers(fromDate) {
+		return nil
+	}
+
+	if r.ClosedToArrival {
+		return fmt.Errorf("Arrivals are not allowed between %s", period)
+	}
+
+	nights := Nights(fromDate, tillDate)
+	if r.MinLOS != 0 && nights < r.MinLOS {
+		return fmt.Errorf("Minimum length of stay for arrivals between %s is %d nights", period, r.MinLOS)
+	}
+	if r.MaxLOS != 0 && nights > r.MaxLOS {
+		return fmt.Errorf("Maximum length of stay for arrivals between %s is %d nights", period, r.MaxLOS)
+	}
+
+	advance := Nights(now, fromDate)
+	if r.MinAdvanceDays != 0 && advance < r.MinAdvanceDays {
+		return fmt.Errorf("Arrivals between %s must be booked at least %d days in advance", period, r.MinAdvanceDays)
+	}
+	if r.MaxAdvanceDays != 0 && advance > r.MaxAdvanceDays {
+		return fmt.Errorf("Arrivals between %s cannot be booked more than %d days in advance", period, r.MaxAdvanceDays)
+	}
+
+	return nil
+}
+
+func (r Restriction) covers(date time.Time) bool {
+	day := truncateToDay(date)
+	return !day.Before(truncateToDay(r.FromDate)) && !day.After(truncateToDay(r.TillDate))
+}
@@ -0,0 +1,128 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"time"
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+
+	minReviewScore   = 1
+	maxReviewScore   = 5
+	maxReviewTextLen = 2000
+)
+
+// ReviewCategories are the aspects of a stay guests can score
+var ReviewCategories = []string{"cleanliness", "comfort", "location", "service", "value"}
+
+func isReviewCategory(category string) bool {
+	for _, c := range ReviewCategories {
+		if c == category {
+			return true
+		}
+	}
+
+	return false
+}
+
+type CreateReviewParams struct {
+	BookingID primitive.ObjectID `json:"bookingID"`
+	Scores    map[string]int     `json:"scores"`
+	Text      string             `json:"text"`
+}
+
+func (crp CreateReviewParams) Validate() error {
+	ve := &ValidationError{}
+
+	if crp.BookingID.IsZero() {
+		ve.Add("bookingID", ViolationRequired, "bookingID is required")
+	}
+	if len(crp.Scores) == 0 {
+		ve.Add("scores", ViolationRequired, "at least one score is required")
+	}
+	categories := make([]string, 0, len(crp.Scores))
+	for category := range crp.Scores {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		score := crp.Scores[category]
+		if !isReviewCategory(category) {
+			ve.Add("scores."+category, ViolationUnknown, "unknown score category %s", category)
+			continue
+		}
+		if score < minReviewScore || score > maxReviewScore {
+			ve.Add("scores."+category, ViolationOutOfRange, "%s score should be between %d and %d", category, minReviewScore, maxReviewScore)
+		}
+	}
+	if len(crp.Text) > maxReviewTextLen {
+		ve.Add("text", ViolationTooLong, "text length should be at most %d characters", maxReviewTextLen)
+	}
+
+	return ve.Err()
+}
+
+type ModerateReviewParams struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+func (mrp ModerateReviewParams) Validate() error {
+	ve := &ValidationError{}
+
+	if mrp.Status != ReviewApproved && mrp.Status != ReviewRejected {
+		ve.Add("status", ViolationInvalid, "status should be %s or %s", ReviewApproved, ReviewRejected)
+	}
+
+	return ve.Err()
+}
+
+// Review is left by the guest of a checked out booking. It counts
+// towards the hotel rating once it's approved by an admin.
+type Review struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	HotelID        primitive.ObjectID `bson:"hotelID" json:"hotelID"`
+	BookingID      primitive.ObjectID `bson:"bookingID" json:"bookingID"`
+	UserID         primitive.ObjectID `bson:"userID" json:"userID"`
+	Scores         map[string]int     `bson:"scores" json:"scores"`
+	Score          float64            `bson:"score" json:"score"`
+	Text           string             `bson:"text" json:"text"`
+	Status         string             `bson:"status" json:"status"`
+	ModerationNote string             `bson:"moderationNote,omitempty" json:"moderationNote,omitempty"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+	ModeratedAt    *time.Time         `bson:"moderatedAt,omitempty" json:"moderatedAt,omitempty"`
+	// Version is bumped by every write of the review, see db.MatchVersion
+	Version int64 `bson:"version" json:"version"`
+}
+
+// NewReviewFromParams makes the review of the booking, hotelID is the hotel of the booking
+// or of its room, bookings of a room made before bookings had a hotel don't have one
+func NewReviewFromParams(hotelID primitive.ObjectID, booking *Booking, params CreateReviewParams) *Review {
+	var total int
+	for _, score := range params.Scores {
+		total += score
+	}
+
+	return &Review{
+		HotelID:   hotelID,
+		BookingID: booking.ID,
+		UserID:    booking.UserID,
+		Scores:    params.Scores,
+		Score:     float64(total) / float64(len(params.Scores)),
+		Text:      params.Text,
+		Status:    ReviewPending,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// ReviewStats are the averages of the approved reviews of a hotel
+type ReviewStats struct {
+	Score          float64            `bson:"score" json:"score"`
+	Count          int                `bson:"count" json:"count"`
+	CategoryScores map[string]float64 `bson:"categoryScores" json:"categoryScores"`
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type CreateRoomBlockParams struct {
+	Reason   string    `json:"reason"`
+	FromDate time.Time `json:"fromDate"`
+	TillDate time.Time `json:"tillDate"`
+}
+
+func (crbp CreateRoomBlockParams) Validate() error {
+	ve := &ValidationError{}
+
+	if len(crbp.Reason) == 0 {
+		ve.Add("reason", ViolationRequired, "reason is required")
+	}
+	ve.checkDateRange("fromDate", crbp.FromDate, "tillDate", crbp.TillDate)
+
+	return ve.Err()
+}
+
+// RoomBlock takes a room out of service (maintenance, out of order...)
+// for a date range, it is treated as occupancy when checking availability.
+type RoomBlock struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	RoomID    primitive.ObjectID `bson:"roomID" json:"roomID"`
+	HotelID   primitive.ObjectID `bson:"hotelID" json:"hotelID"`
+	Reason    string             `bson:"reason" json:"reason"`
+	FromDate  time.Time          `bson:"fromDate" json:"fromDate"`
+	TillDate  time.Time          `bson:"tillDate" json:"tillDate"`
+	CreatedBy primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	// Version is bumped by every write of the block, see db.MatchVersion
+	Version int64 `bson:"version" json:"version"`
+}
+
+func NewRoomBlockFromParams(room *Room, createdBy primitive.ObjectID, params CreateRoomBlockParams) *RoomBlock {
+	return &RoomBlock{
+		RoomID:    room.ID,
+		HotelID:   room.HotelID,
+		Reason:    params.Reason,
+		FromDate:  params.FromDate,
+		TillDate:  params.TillDate,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+}
@@ -33,6 +33,42 @@ func (uup UpdateUserParams) ToBSON() bson.M {
 	return m
 }
 
+// UpdateStaffParams makes the user staff of the hotels, or no longer staff when IsStaff is false
+type UpdateStaffParams struct {
+	IsStaff  bool                 `json:"isStaff"`
+	HotelIDs []primitive.ObjectID `json:"hotelIDs"`
+}
+
+func (usp UpdateStaffParams) Validate() error {
+	ve := &ValidationError{}
+
+	if usp.IsStaff && len(usp.HotelIDs) == 0 {
+		ve.Add("hotelIDs", ViolationRequired, "hotelIDs is required for staff")
+	}
+	if !usp.IsStaff && len(usp.HotelIDs) > 0 {
+		ve.Add("hotelIDs", ViolationInvalid, "hotelIDs can only be given for staff")
+	}
+	for i, hotelID := range usp.HotelIDs {
+		if hotelID.IsZero() {
+			ve.Add(fmt.Sprintf("hotelIDs[%d]", i), ViolationInvalid, "hotelIDs[%d] is not a valid id", i)
+		}
+	}
+
+	return ve.Err()
+}
+
+func (usp UpdateStaffParams) ToBSON() bson.M {
+	hotelIDs := usp.HotelIDs
+	if hotelIDs == nil {
+		hotelIDs = []primitive.ObjectID{}
+	}
+
+	return bson.M{
+		"isStaff":       usp.IsStaff,
+		"staffHotelIDs": hotelIDs,
+	}
+}
+
 type CreateUserParams struct {
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
@@ -40,23 +76,23 @@ type CreateUserParams struct {
 	Password  string `json:"password"`
 }
 
-func (cup CreateUserParams) Validate() map[string]string {
-	errors := map[string]string{}
+func (cup CreateUserParams) Validate() error {
+	ve := &ValidationError{}
 
 	if len(cup.FirstName) < minFirstNameLen {
-		errors["firstName"] = fmt.Sprintf("firstName length should be at least %d characters", minFirstNameLen)
+		ve.Add("firstName", ViolationTooShort, "firstName length should be at least %d characters", minFirstNameLen)
 	}
 	if len(cup.LastName) < minLastNameLen {
-		errors["lastName"] = fmt.Sprintf("secondName length should be at least %d characters", minLastNameLen)
+		ve.Add("lastName", ViolationTooShort, "lastName length should be at least %d characters", minLastNameLen)
 	}
 	if len(cup.Password) < minPasswordLen {
-		errors["password"] = fmt.Sprintf("password length should be at least %d characters", minPasswordLen)
+		ve.Add("password", ViolationTooShort, "password length should be at least %d characters", minPasswordLen)
 	}
 	if !isEmailValid(cup.Email) {
-		errors["email"] = fmt.Sprintf("email is not valid")
+		ve.Add("email", ViolationInvalid, "email is not valid")
 	}
 
-	return errors
+	return ve.Err()
 }
 
 func IsPasswordValid(encpw, pw string) bool {
@@ -75,6 +111,31 @@ type User struct {
 	Email             string             `bson:"email" json:"email"`
 	EncryptedPassword string             `bson:"encryptedPassword" json:"-"`
 	IsAdmin           bool               `bson:"isAdmin" json:"isAdmin"`
+	IsStaff           bool               `bson:"isStaff" json:"isStaff"`
+	// StaffHotelIDs are the hotels a staff user works at
+	StaffHotelIDs  []primitive.ObjectID `bson:"staffHotelIDs,omitempty" json:"staffHotelIDs,omitempty"`
+	LoyaltyPoints  int64                `bson:"loyaltyPoints" json:"loyaltyPoints"`
+	LifetimePoints int64                `bson:"lifetimePoints" json:"lifetimePoints"`
+	// Version is bumped by every write of the user, see db.MatchVersion
+	Version int64 `bson:"version" json:"version"`
+}
+
+// WorksAt reports whether the user can do the work of the staff of the hotel, admins can at every hotel
+func (u *User) WorksAt(hotelID primitive.ObjectID) bool {
+	if u.IsAdmin {
+		return true
+	}
+	if !u.IsStaff {
+		return false
+	}
+
+	for _, staffHotelID := range u.StaffHotelIDs {
+		if staffHotelID == hotelID {
+			return true
+		}
+	}
+
+	return false
 }
 
 func NewUserFromParams(params CreateUserParams) (*User, error) {
@@ -0,0 +1,100 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Violation codes are machine-readable and stable, clients can rely on them
+const (
+	ViolationRequired    = "required"
+	ViolationInvalid     = "invalid"
+	ViolationInvalidType = "invalid_type"
+	ViolationOutOfRange  = "out_of_range"
+	ViolationTooShort    = "too_short"
+	ViolationTooLong     = "too_long"
+	ViolationDateOrder   = "date_order"
+	ViolationDuplicate   = "duplicate"
+	ViolationUnknown     = "unknown"
+)
+
+// Violation explains why the value of a field is invalid,
+// nested fields are dotted and list items indexed, e.g. taxes[0].rate
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every violation found in the params
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (ve *ValidationError) Error() string {
+	messages := make([]string, 0, len(ve.Violations))
+	for _, violation := range ve.Violations {
+		messages = append(messages, violation.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Add records a violation of the field
+func (ve *ValidationError) Add(field, code, format string, args ...any) {
+	ve.Violations = append(ve.Violations, Violation{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Merge records the violations of a nested value under the field
+func (ve *ValidationError) Merge(field string, err error) {
+	if err == nil {
+		return
+	}
+
+	var nested *ValidationError
+	if !errors.As(err, &nested) {
+		ve.Add(field, ViolationInvalid, "%s", err.Error())
+		return
+	}
+
+	for _, violation := range nested.Violations {
+		switch {
+		case len(violation.Field) == 0:
+			violation.Field = field
+		case strings.HasPrefix(violation.Field, "["):
+			violation.Field = field + violation.Field
+		default:
+			violation.Field = field + "." + violation.Field
+		}
+
+		ve.Violations = append(ve.Violations, violation)
+	}
+}
+
+// Err returns the validation error, or nil when nothing is violated
+func (ve *ValidationError) Err() error {
+	if len(ve.Violations) == 0 {
+		return nil
+	}
+
+	return ve
+}
+
+// checkDateRange records the violations of a required [from, till] date range
+func (ve *ValidationError) checkDateRange(fromField string, from time.Time, tillField string, till time.Time) {
+	if from.IsZero() {
+		ve.Add(fromField, ViolationRequired, "%s is required", fromField)
+	}
+	if till.IsZero() {
+		ve.Add(tillField, ViolationRequired, "%s is required", tillField)
+	}
+	if !from.IsZero() && !till.IsZero() && from.After(till) {
+		ve.Add(fromField, ViolationDateOrder, "%s cannot be after %s", fromField, tillField)
+	}
+}